@@ -2,10 +2,10 @@ package config
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"os"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 )
@@ -16,8 +16,13 @@ type SecretsManagerInterface interface {
 }
 
 // SecretManagerFunc allows for injecting a custom Secrets Manager function for testing.
-var SecretManagerFunc = func() (SecretsManagerInterface, error) {
-	cfg, err := loadAWSConfig(context.TODO())
+// An empty region uses the region of the AWS environment.
+var SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
+	var optFns []func(*config.LoadOptions) error
+	if region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	cfg, err := loadAWSConfig(context.TODO(), optFns...)
 	if err != nil {
 		return nil, err
 	}
@@ -28,30 +33,100 @@ var SecretManagerFunc = func() (SecretsManagerInterface, error) {
 // To replace it with a mock in tests.
 var loadAWSConfig = config.LoadDefaultConfig
 
+// CommandLineArgs are the arguments LoadConfig reads flags from. main sets
+// them to the process arguments; they are empty in tests.
+var CommandLineArgs []string
+
+// Defaults are the values used for settings no source provides.
+func Defaults() Config {
+	return Config{
+		FilesAPI:              "https://api.github.com/repos/%s/%s/commits/%s",
+		MongoDBDatabase:       "dashboard",
+		CommitsCollection:     "git_metrics",
+		ReleasesCollection:    "releases",
+		DeploymentsCollection: "deployments",
+		RollupsCollection:     "daily_rollups",
+		TeamsCollection:       "teams",
+		AnomaliesCollection:   "anomalies",
+		MigrationsCollection:  "migrations",
+		SecretsProvider:       ProviderAWS,
+		SecretName:            "git_metrics",
+		SecretVersionStage:    "AWSCURRENT",
+		SecretsDir:            "/var/run/secrets/git_metrics",
+		VaultMount:            "secret",
+		RefreshSeconds:        300,
+	}
+}
+
+// LoadConfig loads the configuration from CommandLineArgs and the process
+// environment.
 func LoadConfig() (*Config, error) {
-	secretName := "git_metrics"
+	return Load(CommandLineArgs, os.Environ())
+}
 
-	svc, err := SecretManagerFunc()
+// Load builds the configuration from layered sources, each overriding the
+// settings it provides of the ones before it:
+//
+//  1. the defaults;
+//  2. the secrets provider chosen by secrets_provider (see NewSecretProvider);
+//  3. the config file named by the -config flag or GIT_METRICS_CONFIG;
+//  4. GIT_METRICS_* environment variables;
+//  5. command-line flags.
+//
+// The secrets provider is configured by the sources after it, so a local
+// file can point at another secret or region, or turn the provider off.
+// The returned Version combines the version of the secrets and the config
+// file's modification time.
+func Load(args []string, environ []string) (*Config, error) {
+	flags, configFile, err := flagLayer(args)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return nil, err
 	}
-
-	input := &secretsmanager.GetSecretValueInput{
-		SecretId: aws.String(secretName),
+	env, err := envLayer(environ)
+	if err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		configFile, _ = env["config"].(string)
 	}
+	delete(env, "config")
 
-	result, err := svc.GetSecretValue(context.TODO(), input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	var versions []string
+	local := []layer{env, flags}
+	if configFile != "" {
+		file, err := fileLayer(configFile)
+		if err != nil {
+			return nil, err
+		}
+		local = append([]layer{file}, local...)
+		if info, err := os.Stat(configFile); err == nil {
+			versions = append(versions, "file:"+info.ModTime().UTC().Format(time.RFC3339Nano))
+		}
 	}
 
-	secretString := *result.SecretString
-	config := &Config{}
+	cfg := Defaults()
+	if err := applyLayers(&cfg, local...); err != nil {
+		return nil, err
+	}
 
-	err = json.Unmarshal([]byte(secretString), config)
+	var secrets layer
+	provider, err := NewSecretProviderFunc(&cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal secret string: %w", err)
+		return nil, err
+	}
+	if provider != nil {
+		values, version, err := provider.Secrets(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		secrets = values
+		versions = append(versions, "secret:"+version)
 	}
 
-	return config, nil
+	cfg = Defaults()
+	if err := applyLayers(&cfg, append([]layer{secrets}, local...)...); err != nil {
+		return nil, err
+	}
+	cfg.Version = strings.Join(versions, ",")
+	return &cfg, nil
 }
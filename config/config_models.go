@@ -1,8 +1,95 @@
 package config
 
+import "strings"
+
+// Config holds the settings of the service. The validate tag lists the
+// rules Validate checks, in order; see rules in validate.go.
 type Config struct {
-	GitHubToken string `json:"github_token"`
-	MongoDBURI  string `json:"mongodb_uri"`
-	// Region      string `json:"region"`
-	FilesAPI    string `json:"files_api"`
+	GitHubToken           string   `json:"github_token" validate:"required_without=tenants,github_token"`
+	MongoDBURI            string   `json:"mongodb_uri" validate:"required,mongodb_uri"`
+	MongoDBDatabase       string   `json:"mongodb_database" validate:"required,database"`
+	MongoDBPrefix         string   `json:"mongodb_prefix" validate:"database"`
+	CommitsCollection     string   `json:"commits_collection" validate:"required,collection"`
+	ReleasesCollection    string   `json:"releases_collection" validate:"required,collection"`
+	DeploymentsCollection string   `json:"deployments_collection" validate:"required,collection"`
+	RollupsCollection     string   `json:"rollups_collection" validate:"required,collection"`
+	TeamsCollection       string   `json:"teams_collection" validate:"required,collection"`
+	AnomaliesCollection   string   `json:"anomalies_collection" validate:"required,collection"`
+	MigrationsCollection  string   `json:"migrations_collection" validate:"required,collection"`
+	Region                string   `json:"region"`
+	FilesAPI              string   `json:"files_api" validate:"required,placeholders=3,url"`
+	TeamsFile             string   `json:"teams_file" validate:"file"`
+	TestPatterns          []string `json:"test_patterns" validate:"globs"`
+	ExporterMaxLabels     int      `json:"exporter_max_labels" validate:"min=0"`
+	ExporterCacheSeconds  int      `json:"exporter_cache_seconds" validate:"min=0"`
+	SecretsProvider       string   `json:"secrets_provider" validate:"oneof=aws vault file none"`
+	SecretName            string   `json:"secret_name"`
+	SecretVersionStage    string   `json:"secret_version_stage"`
+	SecretsDir            string   `json:"secrets_dir"`
+	VaultAddress          string   `json:"vault_address" validate:"url"`
+	VaultToken            string   `json:"vault_token"`
+	VaultNamespace        string   `json:"vault_namespace"`
+	VaultMount            string   `json:"vault_mount"`
+	RefreshSeconds        int      `json:"refresh_seconds" validate:"min=0"`
+	Tenants               []Tenant `json:"tenants" validate:"tenants"`
+
+	// Version identifies the state of the sources the configuration was
+	// loaded from, so a reload can tell whether anything changed.
+	Version string `json:"-"`
+}
+
+// Tenant is a business unit crawled with its own GitHub token into its own
+// database. Owners are the GitHub users and organizations the tenant may
+// sync; empty allows any. Database defaults to the tenant's name. TeamsFile
+// is imported into the tenant's database on startup.
+type Tenant struct {
+	Name        string   `json:"name"`
+	GitHubToken string   `json:"github_token"`
+	Owners      []string `json:"owners"`
+	Database    string   `json:"database"`
+	TeamsFile   string   `json:"teams_file"`
+}
+
+// DefaultTenant is the name of the single tenant of a configuration without
+// tenants.
+const DefaultTenant = "default"
+
+// TenantList returns the configured tenants with their defaults applied, or
+// a single DefaultTenant using github_token, teams_file and mongodb_database
+// when none are configured.
+func (c *Config) TenantList() []Tenant {
+	if len(c.Tenants) == 0 {
+		return []Tenant{{Name: DefaultTenant, GitHubToken: c.GitHubToken, Database: c.MongoDBDatabase, TeamsFile: c.TeamsFile}}
+	}
+	tenants := make([]Tenant, len(c.Tenants))
+	for i, tenant := range c.Tenants {
+		if tenant.Database == "" {
+			tenant.Database = tenant.Name
+		}
+		tenants[i] = tenant
+	}
+	return tenants
+}
+
+// Tenant returns the tenant with the given name.
+func (c *Config) Tenant(name string) (Tenant, bool) {
+	for _, tenant := range c.TenantList() {
+		if tenant.Name == name {
+			return tenant, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// AllowsOwner reports whether the tenant may sync the repositories of owner.
+func (t Tenant) AllowsOwner(owner string) bool {
+	if len(t.Owners) == 0 {
+		return true
+	}
+	for _, allowed := range t.Owners {
+		if strings.EqualFold(allowed, owner) {
+			return true
+		}
+	}
+	return false
 }
@@ -3,7 +3,10 @@ package config
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -44,7 +47,7 @@ func TestLoadConfig_Success(t *testing.T) {
 	// Override SecretManagerFunc to return the mock Secrets Manager
 	originalSecretManagerFunc := SecretManagerFunc
 	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
-	SecretManagerFunc = func() (SecretsManagerInterface, error) {
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
 		return mockSM, nil
 	}
 
@@ -73,7 +76,7 @@ func TestLoadConfig_SecretsManagerError(t *testing.T) {
 	// Override SecretManagerFunc to return the mock Secrets Manager
 	originalSecretManagerFunc := SecretManagerFunc
 	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
-	SecretManagerFunc = func() (SecretsManagerInterface, error) {
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
 		return mockSM, nil
 	}
 
@@ -103,7 +106,7 @@ func TestLoadConfig_UnmarshalError(t *testing.T) {
 	// Override SecretManagerFunc to return the mock Secrets Manager
 	originalSecretManagerFunc := SecretManagerFunc
 	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
-	SecretManagerFunc = func() (SecretsManagerInterface, error) {
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
 		return mockSM, nil
 	}
 
@@ -125,7 +128,7 @@ func TestLoadConfig_AWSConfigLoadingFailure(t *testing.T) {
 	// Override SecretManagerFunc to return an error when AWS config fails
 	originalSecretManagerFunc := SecretManagerFunc
 	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
-	SecretManagerFunc = func() (SecretsManagerInterface, error) {
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
 		return nil, errors.New("failed to load AWS config")
 	}
 
@@ -143,7 +146,7 @@ func TestSecretManagerFunc(t *testing.T) {
 
 		loadAWSConfig = mockLoadAWSConfig
 
-		svc, err := SecretManagerFunc()
+		svc, err := SecretManagerFunc("")
 		assert.NoError(t, err)
 		assert.NotNil(t, svc)
 	})
@@ -158,9 +161,106 @@ func TestSecretManagerFunc(t *testing.T) {
 			return aws.Config{}, errors.New("failed to load AWS config")
 		}
 
-		svc, err := SecretManagerFunc()
+		svc, err := SecretManagerFunc("")
 		assert.Error(t, err)
 		assert.Nil(t, svc)
 		assert.Contains(t, err.Error(), "failed to load AWS config")
 	})
 }
+
+func TestLoad_LayerPrecedence(t *testing.T) {
+	var gotSecret, gotStage, gotRegion string
+	originalSecretManagerFunc := SecretManagerFunc
+	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
+		gotRegion = region
+		return &MockSecretsManager{
+			GetSecretValueFunc: func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+				gotSecret = *params.SecretId
+				gotStage = *params.VersionStage
+				return &secretsmanager.GetSecretValueOutput{
+					SecretString: aws.String(`{"github_token":"secret_token","mongodb_uri":"secret_uri"}`),
+					VersionId:    aws.String("v7"),
+				}, nil
+			},
+		}, nil
+	}
+
+	file := filepath.Join(t.TempDir(), "git_metrics.yaml")
+	os.WriteFile(file, []byte("secret_name: staging/git_metrics\nregion: eu-west-1\nmongodb_uri: file_uri\nteams_file: file_teams.yaml\n"), 0o600)
+
+	cfg, err := Load(
+		[]string{"-config", file, "-exporter-max-labels", "10"},
+		[]string{"GIT_METRICS_TEAMS_FILE=env_teams.yaml", "GIT_METRICS_TEST_PATTERNS=spec/, *_check.go", "HOME=/root"},
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "staging/git_metrics", gotSecret)
+	assert.Equal(t, "AWSCURRENT", gotStage)
+	assert.Equal(t, "eu-west-1", gotRegion)
+	assert.Equal(t, "secret_token", cfg.GitHubToken)
+	assert.Equal(t, "file_uri", cfg.MongoDBURI)
+	assert.Equal(t, "env_teams.yaml", cfg.TeamsFile)
+	assert.Equal(t, []string{"spec/", "*_check.go"}, cfg.TestPatterns)
+	assert.Equal(t, 10, cfg.ExporterMaxLabels)
+	assert.Equal(t, Defaults().FilesAPI, cfg.FilesAPI)
+
+	info, _ := os.Stat(file)
+	assert.Equal(t, "file:"+info.ModTime().UTC().Format(time.RFC3339Nano)+",secret:v7", cfg.Version)
+}
+
+func TestLoad_WithoutSecretsProvider(t *testing.T) {
+	originalSecretManagerFunc := SecretManagerFunc
+	defer func() { SecretManagerFunc = originalSecretManagerFunc }()
+	SecretManagerFunc = func(region string) (SecretsManagerInterface, error) {
+		t.Fatal("Secrets Manager must not be called")
+		return nil, nil
+	}
+
+	cfg, err := Load([]string{"-github-token", "flag_token"}, []string{"GIT_METRICS_SECRETS_PROVIDER=none", "GIT_METRICS_GITHUB_TOKEN=env_token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "flag_token", cfg.GitHubToken)
+
+	_, err = Load(nil, []string{"GIT_METRICS_SECRETS_PROVIDER=keychain"})
+	assert.ErrorContains(t, err, `unknown secrets provider "keychain"`)
+}
+
+func TestConfig_TenantList(t *testing.T) {
+	cfg := Config{GitHubToken: "ghp_single", MongoDBDatabase: "metrics"}
+	assert.Equal(t, []Tenant{{Name: DefaultTenant, GitHubToken: "ghp_single", Database: "metrics"}}, cfg.TenantList())
+
+	cfg.Tenants = []Tenant{
+		{Name: "payments", GitHubToken: "ghp_payments", Owners: []string{"Payments-Org"}},
+		{Name: "retail", GitHubToken: "ghp_retail", Database: "retail_metrics"},
+	}
+	payments, ok := cfg.Tenant("payments")
+	assert.True(t, ok)
+	assert.Equal(t, "payments", payments.Database)
+	assert.True(t, payments.AllowsOwner("payments-org"))
+	assert.False(t, payments.AllowsOwner("retail-org"))
+
+	retail, _ := cfg.Tenant("retail")
+	assert.Equal(t, "retail_metrics", retail.Database)
+	assert.True(t, retail.AllowsOwner("anyone"))
+
+	_, ok = cfg.Tenant(DefaultTenant)
+	assert.False(t, ok)
+}
+
+func TestLoad_TenantsFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	os.WriteFile(file, []byte(`secrets_provider: none
+tenants:
+  - name: payments
+    github_token: ghp_payments
+    owners: [payments-org]
+`), 0o600)
+
+	cfg, err := Load([]string{"-config", file}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Tenant{{Name: "payments", GitHubToken: "ghp_payments", Owners: []string{"payments-org"}}}, cfg.Tenants)
+
+	// Tenants can't be given as a flag.
+	_, err = Load([]string{"-tenants", "payments"}, nil)
+	assert.ErrorContains(t, err, "flag provided but not defined: -tenants")
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Secrets providers.
+const (
+	ProviderAWS   = "aws"
+	ProviderVault = "vault"
+	ProviderFile  = "file"
+	ProviderNone  = "none"
+)
+
+// SecretProvider reads settings kept in a secret store.
+type SecretProvider interface {
+	// Secrets returns the settings of the secret, keyed by their JSON names,
+	// and an identifier of its current version.
+	Secrets(ctx context.Context) (map[string]interface{}, string, error)
+}
+
+// NewSecretProviderFunc allows for injecting a custom secret provider for testing.
+var NewSecretProviderFunc = NewSecretProvider
+
+// NewSecretProvider returns the provider chosen by cfg.SecretsProvider, or
+// nil for none.
+func NewSecretProvider(cfg *Config) (SecretProvider, error) {
+	switch cfg.SecretsProvider {
+	case ProviderAWS:
+		return &AWSSecretProvider{SecretName: cfg.SecretName, VersionStage: cfg.SecretVersionStage, Region: cfg.Region}, nil
+	case ProviderVault:
+		if cfg.VaultAddress == "" || cfg.VaultToken == "" {
+			return nil, fmt.Errorf("the vault secrets provider requires vault_address and vault_token")
+		}
+		return &VaultSecretProvider{
+			Address: cfg.VaultAddress, Token: cfg.VaultToken, Namespace: cfg.VaultNamespace,
+			Mount: cfg.VaultMount, Path: cfg.SecretName,
+		}, nil
+	case ProviderFile:
+		return &FileSecretProvider{Dir: cfg.SecretsDir}, nil
+	case ProviderNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown secrets provider %q, expected one of %s, %s, %s or %s",
+		cfg.SecretsProvider, ProviderAWS, ProviderVault, ProviderFile, ProviderNone)
+}
+
+// AWSSecretProvider reads the settings stored as a JSON object in an AWS
+// Secrets Manager secret. The version is the ID of the version in
+// VersionStage.
+type AWSSecretProvider struct {
+	SecretName   string
+	VersionStage string
+	Region       string
+}
+
+func (p *AWSSecretProvider) Secrets(ctx context.Context) (map[string]interface{}, string, error) {
+	svc, err := SecretManagerFunc(p.Region)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.SecretName),
+	}
+	if p.VersionStage != "" {
+		input.VersionStage = aws.String(p.VersionStage)
+	}
+
+	result, err := svc.GetSecretValue(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	secrets := map[string]interface{}{}
+	err = json.Unmarshal([]byte(*result.SecretString), &secrets)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal secret string: %w", err)
+	}
+
+	return secrets, aws.ToString(result.VersionId), nil
+}
+
+// FileSecretProvider reads settings from a directory holding one file per
+// setting, named like the setting, as Kubernetes mounts secrets. Trailing
+// newlines are trimmed and lists are comma-separated. Hidden files, such as
+// the ..data links Kubernetes maintains, and unknown settings are ignored.
+// The version is a hash of the settings read.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p *FileSecretProvider) Secrets(ctx context.Context) (map[string]interface{}, string, error) {
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	known := make(map[string]setting)
+	for _, s := range settings() {
+		if s.scalar() {
+			known[s.name] = s
+		}
+	}
+
+	names := []string{}
+	texts := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		s, ok := known[name]
+		if !ok || strings.HasPrefix(name, ".") {
+			continue
+		}
+		// Kubernetes mounts each key as a symlink, so entry.IsDir is false
+		// for them; stat the target instead.
+		path := filepath.Join(p.Dir, name)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		texts[s.name] = strings.TrimRight(string(data), "\r\n")
+		names = append(names, s.name)
+	}
+	sort.Strings(names)
+
+	secrets := map[string]interface{}{}
+	hash := sha256.New()
+	for _, name := range names {
+		value, err := known[name].parse(texts[name])
+		if err != nil {
+			return nil, "", fmt.Errorf("secret file %s: %w", name, err)
+		}
+		secrets[name] = value
+		fmt.Fprintf(hash, "%s=%s\n", name, texts[name])
+	}
+
+	return secrets, hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
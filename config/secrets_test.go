@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecretProvider(t *testing.T) {
+	cfg := Defaults()
+	provider, err := NewSecretProvider(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &AWSSecretProvider{SecretName: "git_metrics", VersionStage: "AWSCURRENT"}, provider)
+
+	cfg.SecretsProvider = ProviderVault
+	_, err = NewSecretProvider(&cfg)
+	assert.ErrorContains(t, err, "requires vault_address and vault_token")
+
+	cfg.VaultAddress, cfg.VaultToken = "http://127.0.0.1:8200", "root"
+	provider, err = NewSecretProvider(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &VaultSecretProvider{Address: "http://127.0.0.1:8200", Token: "root", Mount: "secret", Path: "git_metrics"}, provider)
+
+	cfg.SecretsProvider = ProviderFile
+	provider, err = NewSecretProvider(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &FileSecretProvider{Dir: "/var/run/secrets/git_metrics"}, provider)
+
+	cfg.SecretsProvider = ProviderNone
+	provider, err = NewSecretProvider(&cfg)
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	// Lay the directory out like a Kubernetes secret volume: the keys are
+	// links into a hidden, timestamped directory.
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2024_06_01_10_00_00.000000000")
+	os.Mkdir(data, 0o700)
+	os.WriteFile(filepath.Join(data, "github_token"), []byte("ghp_token\n"), 0o600)
+	os.WriteFile(filepath.Join(data, "test_patterns"), []byte("spec/,fixtures/"), 0o600)
+	os.WriteFile(filepath.Join(data, "unrelated"), []byte("x"), 0o600)
+	os.Symlink(filepath.Base(data), filepath.Join(dir, "..data"))
+	for _, name := range []string{"github_token", "test_patterns", "unrelated"} {
+		os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name))
+	}
+
+	provider := &FileSecretProvider{Dir: dir}
+	secrets, version, err := provider.Secrets(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"github_token": "ghp_token", "test_patterns": []string{"spec/", "fixtures/"}}, secrets)
+	assert.Len(t, version, 16)
+
+	_, same, _ := provider.Secrets(context.Background())
+	assert.Equal(t, version, same)
+	os.WriteFile(filepath.Join(data, "github_token"), []byte("ghp_rotated\n"), 0o600)
+	_, rotated, _ := provider.Secrets(context.Background())
+	assert.NotEqual(t, version, rotated)
+}
+
+func TestFileSecretProvider_Errors(t *testing.T) {
+	_, _, err := (&FileSecretProvider{Dir: filepath.Join(t.TempDir(), "missing")}).Secrets(context.Background())
+	assert.ErrorContains(t, err, "failed to read secrets directory")
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "exporter_max_labels"), []byte("lots"), 0o600)
+	_, _, err = (&FileSecretProvider{Dir: dir}).Secrets(context.Background())
+	assert.ErrorContains(t, err, `secret file exporter_max_labels: invalid exporter_max_labels "lots"`)
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variable of every setting, e.g.
+// GIT_METRICS_GITHUB_TOKEN for github_token.
+const EnvPrefix = "GIT_METRICS_"
+
+// layer holds the settings one source provides, keyed by their JSON names.
+type layer map[string]interface{}
+
+// setting describes a field of Config.
+type setting struct {
+	name  string
+	index int
+	kind  reflect.Type
+}
+
+// settings lists the fields of Config by their JSON names.
+func settings() []setting {
+	t := reflect.TypeOf(Config{})
+	result := make([]setting, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		result = append(result, setting{name: name, index: i, kind: t.Field(i).Type})
+	}
+	return result
+}
+
+// scalar reports whether the setting can be given as text in an
+// environment variable or flag; lists of structures can only be set in a
+// config file or secret.
+func (s setting) scalar() bool {
+	return s.kind.Kind() != reflect.Slice || s.kind.Elem().Kind() == reflect.String
+}
+
+// parse converts the text of an environment variable or flag to the type of
+// the setting. Lists are comma-separated.
+func (s setting) parse(text string) (interface{}, error) {
+	switch s.kind.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected an integer", s.name, text)
+		}
+		return n, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected true or false", s.name, text)
+		}
+		return b, nil
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return text, nil
+}
+
+// applyLayers sets the settings of each layer on cfg in order. Settings a
+// layer doesn't provide keep their value.
+func applyLayers(cfg *Config, layers ...layer) error {
+	for _, l := range layers {
+		if len(l) == 0 {
+			continue
+		}
+		data, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("failed to merge configuration: %w", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("failed to merge configuration: %w", err)
+		}
+	}
+	return nil
+}
+
+// fileLayer reads a YAML, JSON or TOML config file, chosen by its extension.
+func fileLayer(path string) (layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	file := layer{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".toml":
+		err = toml.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, expected .yaml, .yml, .json or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// envLayer reads the GIT_METRICS_* variables of environ. GIT_METRICS_CONFIG
+// is returned under "config".
+func envLayer(environ []string) (layer, error) {
+	values := make(map[string]string)
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if ok && strings.HasPrefix(key, EnvPrefix) {
+			values[strings.ToLower(strings.TrimPrefix(key, EnvPrefix))] = value
+		}
+	}
+
+	env := layer{}
+	if path, ok := values["config"]; ok {
+		env["config"] = path
+	}
+	for _, s := range settings() {
+		text, ok := values[s.name]
+		if !ok || !s.scalar() {
+			continue
+		}
+		value, err := s.parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s: %w", EnvPrefix, strings.ToUpper(s.name), err)
+		}
+		env[s.name] = value
+	}
+	return env, nil
+}
+
+// flagLayer parses a flag per setting, named like the setting with dashes,
+// e.g. -github-token, and the -config flag naming the config file. Only the
+// flags that are set are part of the layer.
+func flagLayer(args []string) (layer, string, error) {
+	fs := flag.NewFlagSet("git_metrics", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML, JSON or TOML config file")
+	byFlag := make(map[string]setting)
+	for _, s := range settings() {
+		if !s.scalar() {
+			continue
+		}
+		name := strings.ReplaceAll(s.name, "_", "-")
+		byFlag[name] = s
+		fs.String(name, "", "overrides "+s.name)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	flags := layer{}
+	var parseErr error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := byFlag[f.Name]
+		if !ok || parseErr != nil {
+			return
+		}
+		flags[s.name], parseErr = s.parse(f.Value.String())
+	})
+	if parseErr != nil {
+		return nil, "", parseErr
+	}
+	return flags, *configFile, nil
+}
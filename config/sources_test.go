@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLayer_Formats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"mongodb_uri": "mongodb://localhost", "exporter_max_labels": 20}`,
+		"config.toml": "mongodb_uri = \"mongodb://localhost\"\nexporter_max_labels = 20\n",
+		"config.yml":  "mongodb_uri: mongodb://localhost\nexporter_max_labels: 20\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o600)
+
+		file, err := fileLayer(path)
+		assert.NoError(t, err, name)
+		cfg := Config{}
+		assert.NoError(t, applyLayers(&cfg, file), name)
+		assert.Equal(t, Config{MongoDBURI: "mongodb://localhost", ExporterMaxLabels: 20}, cfg, name)
+	}
+}
+
+func TestFileLayer_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := fileLayer(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read config file")
+
+	ini := filepath.Join(dir, "config.ini")
+	os.WriteFile(ini, []byte("mongodb_uri=x"), 0o600)
+	_, err = fileLayer(ini)
+	assert.ErrorContains(t, err, `unsupported config file format ".ini"`)
+
+	broken := filepath.Join(dir, "config.json")
+	os.WriteFile(broken, []byte("{"), 0o600)
+	_, err = fileLayer(broken)
+	assert.ErrorContains(t, err, "failed to parse config file")
+}
+
+func TestEnvLayer(t *testing.T) {
+	env, err := envLayer([]string{"GIT_METRICS_CONFIG=/etc/git_metrics.toml", "GIT_METRICS_REGION=us-west-2", "GIT_METRICS_UNKNOWN=x", "REGION=ignored"})
+	assert.NoError(t, err)
+	assert.Equal(t, layer{"config": "/etc/git_metrics.toml", "region": "us-west-2"}, env)
+
+	_, err = envLayer([]string{"GIT_METRICS_EXPORTER_CACHE_SECONDS=soon"})
+	assert.ErrorContains(t, err, `GIT_METRICS_EXPORTER_CACHE_SECONDS: invalid exporter_cache_seconds "soon"`)
+}
+
+func TestFlagLayer(t *testing.T) {
+	flags, configFile, err := flagLayer([]string{"-config", "local.yaml", "-test-patterns", "spec/,fixtures/"})
+	assert.NoError(t, err)
+	assert.Equal(t, "local.yaml", configFile)
+	assert.Equal(t, layer{"test_patterns": []string{"spec/", "fixtures/"}}, flags)
+
+	_, _, err = flagLayer([]string{"-exporter-max-labels", "many"})
+	assert.ErrorContains(t, err, `invalid exporter_max_labels "many"`)
+
+	_, _, err = flagLayer([]string{"-verbose"})
+	assert.ErrorContains(t, err, "failed to parse flags")
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeHook applies a configuration change outside the store, such as
+// reconnecting to MongoDB. An error keeps the previous configuration.
+type ChangeHook func(previous, next *Config) error
+
+// Store holds the loaded configuration so it is read from its sources once
+// rather than on every use, and polls the sources for changes in the
+// background. A failed or invalid reload keeps the previous configuration.
+type Store struct {
+	load func() (*Config, error)
+
+	mu    sync.RWMutex
+	cfg   *Config
+	hooks []ChangeHook
+}
+
+// NewStore loads and validates the configuration with load.
+func NewStore(load func() (*Config, error)) (*Store, error) {
+	s := &Store{load: load}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStaticStore returns a store that always holds cfg, for tests and
+// callers that build the configuration themselves.
+func NewStaticStore(cfg *Config) *Store {
+	return &Store{cfg: cfg}
+}
+
+// Get returns the current configuration. Callers must not modify it.
+func (s *Store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// OnChange registers a hook run before a reloaded configuration replaces
+// the current one.
+func (s *Store) OnChange(hook ChangeHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Refresh reloads the configuration. When its version differs from the
+// current one it is validated and, if any setting changed, the change hooks
+// are run before it replaces the current configuration and an audit entry
+// lists the changed settings. Any error keeps the current configuration, so
+// the change is retried on the next refresh.
+func (s *Store) Refresh() error {
+	if s.load == nil {
+		return nil
+	}
+	cfg, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	previous := s.Get()
+	if previous != nil && cfg.Version != "" && cfg.Version == previous.Version {
+		return nil
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	var changed []string
+	if previous != nil {
+		changed = ChangedSettings(previous, cfg)
+	}
+	if len(changed) == 0 {
+		s.mu.Lock()
+		s.cfg = cfg
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.mu.RLock()
+	hooks := s.hooks
+	s.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(previous, cfg); err != nil {
+			log.Printf("audit: configuration version %q rejected, changed settings: %s: %v", cfg.Version, strings.Join(changed, ", "), err)
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	log.Printf("audit: configuration reloaded from version %q to %q, changed settings: %s", previous.Version, cfg.Version, strings.Join(changed, ", "))
+	return nil
+}
+
+// ChangedSettings returns the names of the settings that differ between two
+// configurations. Values are left out as they may be secrets.
+func ChangedSettings(previous, next *Config) []string {
+	changed := []string{}
+	a, b := reflect.ValueOf(previous).Elem(), reflect.ValueOf(next).Elem()
+	for _, s := range settings() {
+		if !reflect.DeepEqual(a.Field(s.index).Interface(), b.Field(s.index).Interface()) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// StartRefresh refreshes the configuration every interval until ctx is
+// done. Errors are logged and the previous configuration is kept, so a
+// provider outage doesn't interrupt the service. A zero interval disables
+// refreshing.
+func (s *Store) StartRefresh(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(); err != nil {
+					log.Printf("could not refresh config, keeping the previous one: %v", err)
+				}
+			}
+		}
+	}()
+}
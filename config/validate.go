@@ -0,0 +1,304 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// githubTokenPattern matches the personal access, OAuth, app and refresh
+// tokens GitHub issues, and the 40-character hex tokens of older accounts.
+var githubTokenPattern = regexp.MustCompile(`^(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|[0-9a-f]{40})$`)
+
+// tenantNamePattern matches tenant names, which appear in URL paths.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// databaseNamePattern matches the characters MongoDB allows in database
+// names on every platform.
+var databaseNamePattern = regexp.MustCompile(`^[^/\\. "$*<>:|?]+$`)
+
+// formatVerbPattern matches the verbs of a format string.
+var formatVerbPattern = regexp.MustCompile(`%[^%]|%%`)
+
+// Problem is one invalid setting.
+type Problem struct {
+	Setting string
+	Message string
+}
+
+// ValidationError lists every invalid setting of a configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("invalid configuration (1 problem):")
+	} else {
+		fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	}
+	scalar := make(map[string]bool)
+	for _, s := range settings() {
+		scalar[s.name] = s.scalar()
+	}
+	for _, p := range e.Problems {
+		if scalar[p.Setting] {
+			fmt.Fprintf(&b, "\n  - %s (%s%s, -%s): %s", p.Setting, EnvPrefix, strings.ToUpper(p.Setting),
+				strings.ReplaceAll(p.Setting, "_", "-"), p.Message)
+		} else {
+			fmt.Fprintf(&b, "\n  - %s: %s", p.Setting, p.Message)
+		}
+	}
+	return b.String()
+}
+
+// checkGitHubToken returns a problem with the shape of a GitHub token, or "".
+func checkGitHubToken(token string) string {
+	if strings.TrimSpace(token) != token {
+		return "must not contain leading or trailing whitespace"
+	}
+	if !githubTokenPattern.MatchString(token) {
+		return "does not look like a GitHub token; expected a ghp_, github_pat_, gho_, ghu_, ghs_ or ghr_ token"
+	}
+	return ""
+}
+
+// checkDatabaseName returns a problem with a MongoDB database name, or "".
+func checkDatabaseName(name string) string {
+	if !databaseNamePattern.MatchString(name) {
+		return fmt.Sprintf(`must not contain spaces or any of /\."$*<>:|?, got %q`, name)
+	}
+	return ""
+}
+
+// maxDatabaseName is the longest database name MongoDB opens.
+const maxDatabaseName = 63
+
+// checkDatabaseLengths returns a problem for every database whose name,
+// with mongodb_prefix prepended as the server opens it, is too long.
+func checkDatabaseLengths(cfg *Config) []Problem {
+	message := func(database string) string {
+		name := cfg.MongoDBPrefix + database
+		if len(name) <= maxDatabaseName {
+			return ""
+		}
+		if cfg.MongoDBPrefix == "" {
+			return fmt.Sprintf("must be at most %d characters, got %d", maxDatabaseName, len(name))
+		}
+		return fmt.Sprintf("%q with mongodb_prefix must be at most %d characters, got %d", name, maxDatabaseName, len(name))
+	}
+
+	var problems []Problem
+	if m := message(cfg.MongoDBDatabase); m != "" {
+		problems = append(problems, Problem{Setting: "mongodb_database", Message: m})
+	}
+	var tenants []string
+	for _, tenant := range cfg.Tenants {
+		database := tenant.Database
+		if database == "" {
+			database = tenant.Name
+		}
+		if m := message(database); m != "" {
+			tenants = append(tenants, fmt.Sprintf("tenant %q: database %s", tenant.Name, m))
+		}
+	}
+	if len(tenants) > 0 {
+		problems = append(problems, Problem{Setting: "tenants", Message: strings.Join(tenants, "; ")})
+	}
+	return problems
+}
+
+// rules check a setting against the argument of its rule in the validate
+// tag of Config, returning a message when the value is invalid. They are
+// only applied to settings that are set.
+var rules = map[string]func(value reflect.Value, arg string) string{
+	"github_token": func(value reflect.Value, arg string) string {
+		return checkGitHubToken(value.String())
+	},
+	"mongodb_uri": func(value reflect.Value, arg string) string {
+		u, err := url.Parse(value.String())
+		if err != nil {
+			return "is not a valid URI"
+		}
+		if u.Scheme != "mongodb" && u.Scheme != "mongodb+srv" {
+			return fmt.Sprintf("must start with mongodb:// or mongodb+srv://, got scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return "must name a host"
+		}
+		return ""
+	},
+	"database": func(value reflect.Value, arg string) string {
+		return checkDatabaseName(value.String())
+	},
+	"collection": func(value reflect.Value, arg string) string {
+		name := value.String()
+		if strings.ContainsAny(name, "$\x00") || strings.HasPrefix(name, "system.") {
+			return fmt.Sprintf("must not contain $ or start with system., got %q", name)
+		}
+		return ""
+	},
+	"url": func(value reflect.Value, arg string) string {
+		// Placeholders aren't valid URL escapes, so check the URL they
+		// produce; placeholders=N runs first to reject other verbs.
+		u, err := url.Parse(strings.ReplaceAll(value.String(), "%s", "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http:// or https:// URL"
+		}
+		return ""
+	},
+	"placeholders": func(value reflect.Value, arg string) string {
+		want, _ := strconv.Atoi(arg)
+		found := 0
+		for _, verb := range formatVerbPattern.FindAllString(value.String(), -1) {
+			switch verb {
+			case "%%":
+			case "%s":
+				found++
+			default:
+				return fmt.Sprintf("contains the verb %s; only %%s placeholders are allowed", verb)
+			}
+		}
+		if found != want {
+			return fmt.Sprintf("must contain %d %%s placeholders, found %d", want, found)
+		}
+		return ""
+	},
+	"oneof": func(value reflect.Value, arg string) string {
+		allowed := strings.Fields(arg)
+		for _, option := range allowed {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value.String())
+	},
+	"min": func(value reflect.Value, arg string) string {
+		limit, _ := strconv.ParseInt(arg, 10, 64)
+		if value.Int() < limit {
+			return fmt.Sprintf("must be at least %d, got %d", limit, value.Int())
+		}
+		return ""
+	},
+	"tenants": func(value reflect.Value, arg string) string {
+		var messages []string
+		names := make(map[string]bool)
+		databases := make(map[string]string)
+		for i, tenant := range value.Interface().([]Tenant) {
+			label := fmt.Sprintf("tenant %d", i)
+			switch {
+			case tenant.Name == "":
+				messages = append(messages, label+": name is required")
+			case !tenantNamePattern.MatchString(tenant.Name):
+				messages = append(messages, fmt.Sprintf("%s: name %q may only contain lowercase letters, digits, - and _", label, tenant.Name))
+			case names[tenant.Name]:
+				messages = append(messages, fmt.Sprintf("%s: name %q is used twice", label, tenant.Name))
+			default:
+				label = fmt.Sprintf("tenant %q", tenant.Name)
+			}
+			names[tenant.Name] = true
+
+			if tenant.GitHubToken == "" {
+				messages = append(messages, label+": github_token is required")
+			} else if message := checkGitHubToken(tenant.GitHubToken); message != "" {
+				messages = append(messages, label+": github_token "+message)
+			}
+
+			database := tenant.Database
+			if database == "" {
+				database = tenant.Name
+			}
+			if message := checkDatabaseName(database); message != "" {
+				messages = append(messages, fmt.Sprintf("%s: database %s", label, message))
+			} else if other, ok := databases[database]; ok {
+				messages = append(messages, fmt.Sprintf("%s: database %q is also used by tenant %q", label, database, other))
+			}
+			databases[database] = tenant.Name
+		}
+		return strings.Join(messages, "; ")
+	},
+	"globs": func(value reflect.Value, arg string) string {
+		for i := 0; i < value.Len(); i++ {
+			pattern := strings.TrimSuffix(value.Index(i).String(), "/")
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Sprintf("invalid glob pattern %q", value.Index(i).String())
+			}
+		}
+		return ""
+	},
+	"file": func(value reflect.Value, arg string) string {
+		if _, err := os.Stat(value.String()); err != nil {
+			return fmt.Sprintf("cannot read %s: %v", value.String(), err)
+		}
+		return ""
+	},
+}
+
+// Validate checks the configuration against the validate tags of Config and
+// returns a *ValidationError listing every invalid setting, or nil.
+func Validate(cfg *Config) error {
+	var problems []Problem
+
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		value := v.Field(i)
+
+		for _, rule := range strings.Split(tag, ",") {
+			ruleName, arg, _ := strings.Cut(rule, "=")
+			if ruleName == "required" {
+				if value.IsZero() {
+					problems = append(problems, Problem{Setting: name, Message: "is required"})
+					break
+				}
+				continue
+			}
+			if ruleName == "required_without" {
+				if value.IsZero() && settingValue(v, arg).IsZero() {
+					problems = append(problems, Problem{Setting: name, Message: fmt.Sprintf("is required unless %s are configured", arg)})
+					break
+				}
+				continue
+			}
+			if value.IsZero() {
+				break
+			}
+			check, ok := rules[ruleName]
+			if !ok {
+				panic(fmt.Sprintf("config: unknown validation rule %q on %s", ruleName, name))
+			}
+			if message := check(value, arg); message != "" {
+				problems = append(problems, Problem{Setting: name, Message: message})
+				break
+			}
+		}
+	}
+
+	problems = append(problems, checkDatabaseLengths(cfg)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// settingValue returns the field of the setting with the given JSON name.
+func settingValue(v reflect.Value, name string) reflect.Value {
+	for _, s := range settings() {
+		if s.name == name {
+			return v.Field(s.index)
+		}
+	}
+	panic(fmt.Sprintf("config: unknown setting %q", name))
+}
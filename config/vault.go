@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VaultSecretProvider reads the settings stored in a HashiCorp Vault KV
+// version 2 secret at Path of the secrets engine mounted at Mount. The
+// version is the secret's version number.
+type VaultSecretProvider struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+
+	// Client sends the requests; nil uses a client with a 10 second timeout.
+	Client *http.Client
+}
+
+func (p *VaultSecretProvider) Secrets(ctx context.Context) (map[string]interface{}, string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(p.Address, "/"),
+		strings.Trim(p.Mount, "/"), strings.Trim(p.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to retrieve secret from Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.Unmarshal(body, &vaultErr); err != nil || len(vaultErr.Errors) == 0 {
+			// Proxies in front of Vault answer with their own, often non-JSON, bodies.
+			return nil, "", fmt.Errorf("failed to retrieve secret from Vault: %s %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil, "", fmt.Errorf("failed to retrieve secret from Vault: status %d %s", resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	}
+
+	var result struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal Vault response: %w", err)
+	}
+	if result.Data.Data == nil {
+		return nil, "", fmt.Errorf("vault secret %s/%s has no data; is it deleted?", p.Mount, p.Path)
+	}
+
+	return result.Data.Data, strconv.Itoa(result.Data.Metadata.Version), nil
+}
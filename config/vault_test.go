@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault serves a KV version 2 secret the way a Vault server does.
+func fakeVault(t *testing.T, status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/kv/data/apps/git_metrics", r.URL.Path)
+		assert.Equal(t, "s.token", r.Header.Get("X-Vault-Token"))
+		assert.Equal(t, "platform", r.Header.Get("X-Vault-Namespace"))
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func vaultProvider(address string) *VaultSecretProvider {
+	return &VaultSecretProvider{Address: address + "/", Token: "s.token", Namespace: "platform", Mount: "kv", Path: "apps/git_metrics"}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := fakeVault(t, http.StatusOK, `{"data": {
+		"data": {"github_token": "ghp_token", "exporter_max_labels": 20},
+		"metadata": {"created_time": "2024-06-01T10:00:00Z", "version": 3}
+	}}`)
+	defer server.Close()
+
+	secrets, version, err := vaultProvider(server.URL).Secrets(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "3", version)
+
+	cfg := Config{}
+	assert.NoError(t, applyLayers(&cfg, secrets))
+	assert.Equal(t, Config{GitHubToken: "ghp_token", ExporterMaxLabels: 20}, cfg)
+}
+
+func TestVaultSecretProvider_Errors(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		message string
+	}{
+		{http.StatusForbidden, `{"errors": ["permission denied"]}`, "status 403 permission denied"},
+		{http.StatusBadGateway, "upstream connect error\n", "502 Bad Gateway upstream connect error"},
+		{http.StatusOK, `{"data": {"data": null, "metadata": {"version": 4}}}`, "vault secret kv/apps/git_metrics has no data"},
+		{http.StatusOK, `<html>`, "failed to unmarshal Vault response"},
+	}
+	for _, tt := range tests {
+		server := fakeVault(t, tt.status, tt.body)
+		_, _, err := vaultProvider(server.URL).Secrets(context.Background())
+		assert.ErrorContains(t, err, tt.message)
+		server.Close()
+	}
+
+	_, _, err := vaultProvider("http://127.0.0.1:1").Secrets(context.Background())
+	assert.ErrorContains(t, err, "failed to retrieve secret from Vault")
+}
@@ -0,0 +1,158 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RollupFilter returns the MongoDB filter matching the daily rollups of the
+// query. Rollups are per UTC day, so a day is included when it starts inside
+// the range.
+func (q Query) RollupFilter() bson.M {
+	filter := q.ownerFilter()
+	if q.Repo != "" {
+		filter["reponame"] = q.Repo
+	}
+	q.addAuthorFilter(filter, "author", "author_login")
+
+	dayRange := bson.M{}
+	if !q.From.IsZero() {
+		dayRange["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		dayRange["$lt"] = q.To
+	}
+	if len(dayRange) > 0 {
+		filter["day"] = dayRange
+	}
+
+	return filter
+}
+
+// LoadRollups returns the daily rollups matching the query, oldest first.
+// When the query excludes outliers, the outlier commits are taken out of the
+// rollups they are counted in.
+func LoadRollups(ctx context.Context, q Query) ([]gitmetrics.DailyRollup, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "day", Value: 1}})
+	cursor, err := db.GetNamedCollection(db.RollupsCollection).Find(ctx, q.RollupFilter(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+
+	var rollups []gitmetrics.DailyRollup
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, fmt.Errorf("failed to decode rollups: %w", err)
+	}
+
+	if q.ExcludeOutliers && len(rollups) > 0 {
+		return subtractOutliers(ctx, q, rollups)
+	}
+	return rollups, nil
+}
+
+// subtractOutliers takes the outlier commits of the query out of rollups,
+// which are ordered by day, and drops the rollups left without commits.
+func subtractOutliers(ctx context.Context, q Query, rollups []gitmetrics.DailyRollup) ([]gitmetrics.DailyRollup, error) {
+	filter := Query{Owner: q.Owner, Repo: q.Repo, Author: q.Author, Team: q.Team}.Filter()
+	filter["outlier"] = true
+	filter["commit_date"] = bson.M{"$gte": rollups[0].Day, "$lt": rollups[len(rollups)-1].Day.AddDate(0, 0, 1)}
+	outliers, err := findCommits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	key := func(r gitmetrics.DailyRollup) string {
+		return r.Owner + "\x00" + r.RepoName + "\x00" + r.Author + "\x00" + r.AuthorLogin + "\x00" + r.Day.Format(time.RFC3339)
+	}
+	index := make(map[string]int, len(rollups))
+	for i, rollup := range rollups {
+		index[key(rollup)] = i
+	}
+	for _, outlier := range gitmetrics.BuildRollups(outliers) {
+		i, ok := index[key(outlier)]
+		if !ok {
+			continue
+		}
+		rollup := &rollups[i]
+		rollup.Commits -= outlier.Commits
+		rollup.LinesAdded -= outlier.LinesAdded
+		rollup.LinesDeleted -= outlier.LinesDeleted
+		rollup.FilesAdded -= outlier.FilesAdded
+		rollup.FilesDeleted -= outlier.FilesDeleted
+		rollup.FilesUpdated -= outlier.FilesUpdated
+	}
+
+	kept := rollups[:0]
+	for _, rollup := range rollups {
+		if rollup.Commits > 0 {
+			kept = append(kept, rollup)
+		}
+	}
+	return kept, nil
+}
+
+// CommitActivity sums the daily rollups matching the query by repository and
+// bucketed period, without reading the commits themselves.
+func CommitActivity(ctx context.Context, q Query, bucket Bucket) ([]Activity, error) {
+	rollups, err := LoadRollups(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return sumActivity(rollups, bucket), nil
+}
+
+func sumActivity(rollups []gitmetrics.DailyRollup, bucket Bucket) []Activity {
+	type key struct {
+		owner, repo string
+		period      time.Time
+	}
+
+	activities := make(map[key]*Activity)
+	authors := make(map[key]map[string]bool)
+	days := make(map[key]map[time.Time]bool)
+	for _, rollup := range rollups {
+		k := key{rollup.Owner, rollup.RepoName, bucket.Truncate(rollup.Day.UTC())}
+		activity, ok := activities[k]
+		if !ok {
+			activity = &Activity{Owner: k.owner, Repo: k.repo, Period: k.period}
+			activities[k] = activity
+			authors[k] = make(map[string]bool)
+			days[k] = make(map[time.Time]bool)
+		}
+		activity.Commits += rollup.Commits
+		activity.LinesAdded += rollup.LinesAdded
+		activity.LinesDeleted += rollup.LinesDeleted
+		activity.FilesAdded += rollup.FilesAdded
+		activity.FilesDeleted += rollup.FilesDeleted
+		activity.FilesUpdated += rollup.FilesUpdated
+		authors[k][rollup.Author] = true
+		days[k][rollup.Day.UTC()] = true
+	}
+
+	result := make([]Activity, 0, len(activities))
+	for k, activity := range activities {
+		activity.Authors = len(authors[k])
+		activity.ActiveDays = len(days[k])
+		result = append(result, *activity)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		return a.Period.Before(b.Period)
+	})
+
+	return result
+}
@@ -0,0 +1,85 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryRollupFilter(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, bson.M{
+		"reponame": "repo1",
+		"author":   "alice",
+		"day":      bson.M{"$gte": from, "$lt": to},
+	}, Query{Repo: "repo1", Author: "alice", From: from, To: to}.RollupFilter())
+	assert.Equal(t, bson.M{}, Query{}.RollupFilter())
+	assert.Equal(t, bson.M{"owner": "acme", "reponame": "repo1"}, Query{Owner: "acme", Repo: "repo1"}.RollupFilter())
+
+	team := &teams.Team{Name: "platform", Members: []string{"@alice", "Bob"}}
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"author_login": bson.M{"$in": []string{"alice"}}},
+		bson.M{"author": bson.M{"$in": []string{"Bob"}}},
+	}}, Query{Team: team}.RollupFilter())
+}
+
+func TestCommitActivity(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	rollupCollection := mockNamedCollection(t, db.RollupsCollection, []interface{}{
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "alice", Day: day(1), Commits: 2, LinesAdded: 10, FilesAdded: 1},
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "bob", Day: day(1), Commits: 1, LinesDeleted: 4},
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "alice", Day: day(3), Commits: 1, LinesAdded: 1, FilesUpdated: 1},
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "alice", Day: day(8), Commits: 5, LinesAdded: 50},
+		gitmetrics.DailyRollup{RepoName: "repo2", Author: "carol", Day: day(2), Commits: 1},
+		gitmetrics.DailyRollup{Owner: "fork", RepoName: "repo2", Author: "carol", Day: day(2), Commits: 1},
+	})
+
+	activity, err := CommitActivity(context.Background(), Query{Repo: "repo1"}, BucketWeek)
+	assert.NoError(t, err)
+
+	// 2024-01-01 is a Monday.
+	assert.Equal(t, []Activity{
+		{Repo: "repo1", Period: day(1), Commits: 4, LinesAdded: 11, LinesDeleted: 4, FilesAdded: 1, FilesUpdated: 1, Authors: 2, ActiveDays: 2},
+		{Repo: "repo1", Period: day(8), Commits: 5, LinesAdded: 50, Authors: 1, ActiveDays: 1},
+		{Repo: "repo2", Period: day(1), Commits: 1, Authors: 1, ActiveDays: 1},
+		{Owner: "fork", Repo: "repo2", Period: day(1), Commits: 1, Authors: 1, ActiveDays: 1},
+	}, activity)
+	rollupCollection.AssertCalled(t, "Find", mock.Anything, bson.M{"reponame": "repo1"}, mock.Anything)
+}
+
+func TestLoadRollups_ExcludeOutliers(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	mockNamedCollection(t, db.RollupsCollection, []interface{}{
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "alice", Day: day(1), Commits: 3, LinesAdded: 1010},
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "alice", Day: day(2), Commits: 1, LinesAdded: 5000},
+		gitmetrics.DailyRollup{RepoName: "repo1", Author: "bob", Day: day(3), Commits: 1, LinesAdded: 4},
+	})
+	commitCollection := mockCommitCollection(t, []gitmetrics.Commit{
+		{RepoName: "repo1", CommittedBy: "alice", CommitDate: day(1).Add(9 * time.Hour), LinesAdded: 1000, Outlier: true},
+		{RepoName: "repo1", CommittedBy: "alice", CommitDate: day(2).Add(9 * time.Hour), LinesAdded: 5000, Outlier: true},
+	})
+
+	rollups, err := LoadRollups(context.Background(), Query{Repo: "repo1", From: day(1).Add(time.Hour), ExcludeOutliers: true})
+	assert.NoError(t, err)
+
+	// The day left without commits is dropped.
+	assert.Equal(t, []gitmetrics.DailyRollup{
+		{RepoName: "repo1", Author: "alice", Day: day(1), Commits: 2, LinesAdded: 10},
+		{RepoName: "repo1", Author: "bob", Day: day(3), Commits: 1, LinesAdded: 4},
+	}, rollups)
+	// Outliers are read for the whole days of the rollups, not just the range.
+	commitCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"reponame":    "repo1",
+		"outlier":     true,
+		"commit_date": bson.M{"$gte": day(1), "$lt": day(4)},
+	}, mock.Anything)
+}
@@ -0,0 +1,301 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Query selects the stored commits an analytics computation runs over.
+// Owner restricts the query to the repositories of one owner, so a fork
+// isn't merged with its upstream. From is inclusive and To is exclusive;
+// zero values leave that side open.
+// Team selects the commits of the team's members; metrics that describe
+// repositories rather than people, such as releases and DORA, use the
+// team's repositories instead. ExcludeOutliers leaves out the commits
+// flagged by the anomaly detector.
+type Query struct {
+	Owner           string
+	Repo            string
+	Author          string
+	Team            *teams.Team
+	From            time.Time
+	To              time.Time
+	ExcludeOutliers bool
+}
+
+// TypeCount is the number of commits of one Conventional Commits type in a
+// repository during the period starting at Period.
+type TypeCount struct {
+	Repo   string    `json:"repo"`
+	Period time.Time `json:"period"`
+	Type   string    `json:"type"`
+	Count  int       `json:"count"`
+}
+
+// Activity is the commit activity of a repository during the period starting
+// at Period, read from the daily rollups. Authors counts distinct authors and
+// ActiveDays the days with at least one commit.
+type Activity struct {
+	Owner        string    `json:"owner"`
+	Repo         string    `json:"repo"`
+	Period       time.Time `json:"period"`
+	Commits      int       `json:"commits"`
+	LinesAdded   int       `json:"lines_added"`
+	LinesDeleted int       `json:"lines_deleted"`
+	FilesAdded   int       `json:"files_added"`
+	FilesDeleted int       `json:"files_deleted"`
+	FilesUpdated int       `json:"files_updated"`
+	Authors      int       `json:"authors"`
+	ActiveDays   int       `json:"active_days"`
+}
+
+// LeaderboardEntry is the contribution of one author or group during the
+// leaderboard window. Value is the ranked metric; entries with the same value
+// share a rank. Percentile is the share of entries whose value is at most
+// this entry's. The Previous fields describe the preceding window of the same
+// length and are zero when the entry had no activity then.
+type LeaderboardEntry struct {
+	Rank          int     `json:"rank"`
+	Key           string  `json:"key"`
+	Value         int     `json:"value"`
+	Percentile    float64 `json:"percentile"`
+	Commits       int     `json:"commits"`
+	Lines         int     `json:"lines"`
+	FilesTouched  int     `json:"files_touched"`
+	ActiveDays    int     `json:"active_days"`
+	PreviousValue int     `json:"previous_value"`
+	PreviousRank  int     `json:"previous_rank,omitempty"`
+	Delta         int     `json:"delta"`
+}
+
+// Leaderboard ranks contributors over a window. The previous window is only
+// set when the query has both a start and an end.
+type Leaderboard struct {
+	Metric       string             `json:"metric"`
+	GroupBy      string             `json:"group_by"`
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	PreviousFrom *time.Time         `json:"previous_from,omitempty"`
+	PreviousTo   *time.Time         `json:"previous_to,omitempty"`
+	Entries      []LeaderboardEntry `json:"entries"`
+}
+
+// Heatmap counts the commits of an author, repository or team by day of week
+// and hour of day in the requested timezone. Cells[0] is Monday and
+// Cells[d][0] the hour from midnight. Off-hours commits are weekday commits
+// outside working hours; weekend commits are counted separately.
+type Heatmap struct {
+	Key             string     `json:"key"`
+	Timezone        string     `json:"timezone"`
+	Cells           [7][24]int `json:"cells"`
+	Commits         int        `json:"commits"`
+	OffHoursCommits int        `json:"off_hours_commits"`
+	WeekendCommits  int        `json:"weekend_commits"`
+	OffHoursRatio   float64    `json:"off_hours_ratio"`
+	WeekendRatio    float64    `json:"weekend_ratio"`
+}
+
+// TimeSeries is one series of a time-series chart: the values of a metric for
+// an author, repository or team in consecutive periods. Periods without
+// activity are included with a zero value.
+type TimeSeries struct {
+	Key    string            `json:"key"`
+	Metric string            `json:"metric"`
+	Points []TimeSeriesPoint `json:"points"`
+}
+
+// TimeSeriesPoint is the value of a metric in the period starting at Period.
+// MovingAverage is the mean of the value over the trailing window of periods
+// ending at this one, or over all earlier periods near the start.
+type TimeSeriesPoint struct {
+	Period        time.Time `json:"period"`
+	Value         int       `json:"value"`
+	MovingAverage float64   `json:"moving_average"`
+}
+
+// Anomaly is an outlier found by the anomaly detector: a commit far larger
+// than the other commits of its repository, a day with far more changed lines
+// than usual (spike) or an unusually long run of days without commits
+// (silence). Scope is repo or author and Key the repository, as owner/repo,
+// or author whose series the anomaly was found in; Owner and RepoName are
+// those the detector ran over for an author. Days cover Start to End, exclusive; for a
+// commit both are its date. Value is the commit's or day's changed lines, or
+// the length of a silence in days, Median the typical value of the series and
+// Score the robust z-score.
+type Anomaly struct {
+	Kind     string    `bson:"kind" json:"kind"`
+	Scope    string    `bson:"scope" json:"scope"`
+	Key      string    `bson:"key" json:"key"`
+	Owner    string    `bson:"owner" json:"owner"`
+	RepoName string    `bson:"reponame" json:"repo"`
+	CommitID string    `bson:"commit_id,omitempty" json:"commit_id,omitempty"`
+	Start    time.Time `bson:"start" json:"start"`
+	End      time.Time `bson:"end" json:"end"`
+	Value    float64   `bson:"value" json:"value"`
+	Median   float64   `bson:"median" json:"median"`
+	Score    float64   `bson:"score" json:"score"`
+}
+
+// LanguageBreakdown is the lines a commit, repository, author or team changed
+// per language and per file category, largest first. Files counts file
+// changes, so a file changed by two commits counts twice.
+type LanguageBreakdown struct {
+	Key          string       `json:"key"`
+	Commits      int          `json:"commits"`
+	LinesAdded   int          `json:"lines_added"`
+	LinesDeleted int          `json:"lines_deleted"`
+	Languages    []ClassLines `json:"languages"`
+	Categories   []ClassLines `json:"categories"`
+}
+
+// ClassLines is the share of a language breakdown that falls into one
+// language or category.
+type ClassLines struct {
+	Name         string `json:"name"`
+	Files        int    `json:"files"`
+	LinesAdded   int    `json:"lines_added"`
+	LinesDeleted int    `json:"lines_deleted"`
+}
+
+// TestRatio compares the lines changed in test files with those changed in
+// source files by a commit, pull request, author, repository or team. Ratio
+// is left out when no production code changed. Changes counts the commits
+// and pull requests that changed production code, and ChangesWithoutTests
+// those of them that changed no tests. Repo is only set for commits and pull
+// requests.
+type TestRatio struct {
+	Key                 string   `json:"key"`
+	Repo                string   `json:"repo,omitempty"`
+	TestLines           int      `json:"test_lines"`
+	ProductionLines     int      `json:"production_lines"`
+	Ratio               *float64 `json:"ratio,omitempty"`
+	Changes             int      `json:"changes"`
+	ChangesWithoutTests int      `json:"changes_without_tests"`
+	UntestedRate        float64  `json:"untested_rate"`
+}
+
+// ReleaseMetrics summarises the commits that shipped in a single release.
+// Lead times are measured from commit date to release date.
+type ReleaseMetrics struct {
+	Repo                string    `json:"repo"`
+	TagName             string    `json:"tag_name"`
+	ReleasedAt          time.Time `json:"released_at"`
+	Commits             int       `json:"commits"`
+	LinesAdded          int       `json:"lines_added"`
+	LinesDeleted        int       `json:"lines_deleted"`
+	MeanLeadTimeHours   float64   `json:"mean_lead_time_hours"`
+	MedianLeadTimeHours float64   `json:"median_lead_time_hours"`
+}
+
+// RepoReleaseReport holds the release metrics of one repository.
+// ReleasesPerWeek is left out when the releases span no time and no window
+// was requested.
+type RepoReleaseReport struct {
+	Owner                   string           `json:"owner"`
+	Repo                    string           `json:"repo"`
+	ReleaseCount            int              `json:"release_count"`
+	ReleasesPerWeek         *float64         `json:"releases_per_week,omitempty"`
+	MeanDaysBetweenReleases float64          `json:"mean_days_between_releases"`
+	MedianLeadTimeHours     float64          `json:"median_lead_time_hours"`
+	Releases                []ReleaseMetrics `json:"releases"`
+}
+
+// DORAMetrics holds the four DORA metrics of one repository and environment,
+// or of all the repositories of Team in an environment, in which case Owner
+// and Repo are empty.
+// Source is the origin of its deployments: github, api, or release when the
+// repository has no deployments and its releases are used instead; sources
+// are listed in order, comma-separated, when the environment has several.
+// DeploymentsPerWeek is left out when the deployments span no time and no
+// window was requested.
+type DORAMetrics struct {
+	Team                     string   `json:"team,omitempty"`
+	Owner                    string   `json:"owner"`
+	Repo                     string   `json:"repo"`
+	Environment              string   `json:"environment"`
+	Source                   string   `json:"source"`
+	Deployments              int      `json:"deployments"`
+	FailedDeployments        int      `json:"failed_deployments"`
+	DeploymentsPerWeek       *float64 `json:"deployments_per_week,omitempty"`
+	MedianLeadTimeHours      float64  `json:"median_lead_time_hours"`
+	ChangeFailureRate        float64  `json:"change_failure_rate"`
+	MedianTimeToRestoreHours float64  `json:"median_time_to_restore_hours"`
+}
+
+// ChurnEntry is the churn of one file or author, for one period when churn is
+// bucketed. Repo is only set when grouping by file. ReworkRate is the share of
+// deleted lines that had been written within the rework window.
+type ChurnEntry struct {
+	Repo         string     `json:"repo,omitempty"`
+	Key          string     `json:"key"`
+	Period       *time.Time `json:"period,omitempty"`
+	Commits      int        `json:"commits"`
+	LinesAdded   int        `json:"lines_added"`
+	LinesDeleted int        `json:"lines_deleted"`
+	Churn        int        `json:"churn"`
+	NetGrowth    int        `json:"net_growth"`
+	ReworkLines  int        `json:"rework_lines"`
+	ReworkRate   float64    `json:"rework_rate"`
+}
+
+// Hotspot is a file that changes often and by a lot. Score is the number of
+// changes times the lines changed.
+type Hotspot struct {
+	Repo        string    `json:"repo"`
+	File        string    `json:"file"`
+	Changes     int       `json:"changes"`
+	Churn       int       `json:"churn"`
+	Score       int       `json:"score"`
+	Authors     int       `json:"authors"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+// OwnerShare is one contributor's share of the lines changed in a directory.
+type OwnerShare struct {
+	Name  string  `json:"name"`
+	Login string  `json:"login,omitempty"`
+	Lines int     `json:"lines"`
+	Share float64 `json:"share"`
+}
+
+// DirectoryOwnership describes who owns a directory. Concentration is the
+// Herfindahl index of the owners' shares (1 means a single owner) and
+// BusFactor is the smallest number of contributors that together changed
+// more than half of the lines.
+type DirectoryOwnership struct {
+	Repo              string       `json:"repo"`
+	Directory         string       `json:"directory"`
+	LinesChanged      int          `json:"lines_changed"`
+	PrimaryOwner      string       `json:"primary_owner"`
+	PrimaryOwnerLogin string       `json:"primary_owner_login,omitempty"`
+	OwnerShare        float64      `json:"owner_share"`
+	Concentration     float64      `json:"concentration"`
+	BusFactor         int          `json:"bus_factor"`
+	Owners            []OwnerShare `json:"owners"`
+}
+
+// CodeOwnersRule is a CODEOWNERS line: a path pattern and its owners.
+type CodeOwnersRule struct {
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+}
+
+// CodeOwnersChange is a difference between the existing CODEOWNERS file and
+// the suggested one. Action is add, change or keep; kept rules exist today
+// but have no suggestion and are left for a human to review.
+type CodeOwnersChange struct {
+	Action    string   `json:"action"`
+	Pattern   string   `json:"pattern"`
+	Current   []string `json:"current,omitempty"`
+	Suggested []string `json:"suggested,omitempty"`
+}
+
+// CodeOwnersSuggestion is a CODEOWNERS file generated from ownership data
+// together with its differences from the file in the repository.
+type CodeOwnersSuggestion struct {
+	Repo         string             `json:"repo"`
+	ExistingPath string             `json:"existing_path,omitempty"`
+	Suggested    string             `json:"suggested"`
+	Changes      []CodeOwnersChange `json:"changes"`
+}
@@ -0,0 +1,281 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Anomaly kinds.
+const (
+	AnomalyCommit  = "commit"
+	AnomalySpike   = "spike"
+	AnomalySilence = "silence"
+)
+
+// DefaultAnomalyThreshold is the robust z-score above which a value is
+// flagged, as recommended by Iglewicz and Hoaglin.
+const DefaultAnomalyThreshold = 3.5
+
+// minAnomalySamples is the number of values a series needs before any of
+// them is flagged; smaller series say too little about what is usual.
+const minAnomalySamples = 8
+
+// minSilenceDays keeps weekends and short breaks from being reported as
+// silences in repositories that see commits almost every day.
+const minSilenceDays = 7
+
+// robustZScores returns the median of values and the modified z-score of each
+// value: its distance from the median in units of the median absolute
+// deviation, scaled to match the standard deviation of a normal distribution.
+// When more than half of the values are equal the median absolute deviation
+// is 0 and the mean absolute deviation is used instead. A constant series
+// scores 0 everywhere.
+func robustZScores(values []float64) (float64, []float64) {
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+
+	scale := median(deviations) / 0.6745
+	if scale == 0 {
+		scale = mean(deviations) * 1.253314
+	}
+
+	scores := make([]float64, len(values))
+	if scale == 0 {
+		return med, scores
+	}
+	for i, v := range values {
+		scores[i] = (v - med) / scale
+	}
+	return med, scores
+}
+
+// DetectAnomalies looks for outliers in the stored commits of a repository,
+// or of every repository when repo is empty, replaces the anomalies stored
+// for it and flags the outlier commits so queries can exclude them. An empty
+// owner matches every owner. A threshold of 0 uses DefaultAnomalyThreshold.
+func DetectAnomalies(ctx context.Context, owner, repo string, threshold float64) ([]Anomaly, error) {
+	if threshold <= 0 {
+		threshold = DefaultAnomalyThreshold
+	}
+
+	commits, err := LoadCommits(ctx, Query{Owner: owner, Repo: repo})
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies := findAnomalies(commits, owner, repo, threshold)
+	if err := SaveAnomalies(ctx, owner, repo, anomalies); err != nil {
+		return nil, err
+	}
+	return anomalies, nil
+}
+
+// findAnomalies flags commits whose changed lines are outliers among the
+// commits of their repository, and days whose changed lines are outliers
+// among the active days of a repository or author. Silences are outliers
+// among the gaps between active days. Repositories are told apart by owner,
+// and author series span every repository of the given owner and repo when
+// they are empty.
+func findAnomalies(commits []gitmetrics.Commit, owner, repo string, threshold float64) []Anomaly {
+	anomalies := []Anomaly{}
+
+	type repository struct{ owner, name string }
+	byRepo := make(map[repository][]gitmetrics.Commit)
+	for _, commit := range commits {
+		key := repository{commit.Owner, commit.RepoName}
+		byRepo[key] = append(byRepo[key], commit)
+	}
+	for key, repoCommits := range byRepo {
+		if len(repoCommits) < minAnomalySamples {
+			continue
+		}
+		values := make([]float64, len(repoCommits))
+		for i, commit := range repoCommits {
+			values[i] = float64(commit.LinesAdded + commit.LinesDeleted)
+		}
+		med, scores := robustZScores(values)
+		for i, commit := range repoCommits {
+			if scores[i] > threshold {
+				anomalies = append(anomalies, Anomaly{
+					Kind: AnomalyCommit, Scope: GroupByRepo, Key: gitmetrics.FullName(key.owner, key.name),
+					Owner: key.owner, RepoName: key.name,
+					CommitID: commit.CommitID, Start: commit.CommitDate, End: commit.CommitDate,
+					Value: values[i], Median: med, Score: scores[i],
+				})
+			}
+		}
+	}
+
+	// Daily changed lines per repository and per author.
+	type seriesKey struct {
+		scope, key string
+		repo       repository
+	}
+	series := make(map[seriesKey]map[time.Time]float64)
+	for _, rollup := range gitmetrics.BuildRollups(commits) {
+		repoKey := seriesKey{GroupByRepo, gitmetrics.FullName(rollup.Owner, rollup.RepoName), repository{rollup.Owner, rollup.RepoName}}
+		authorKey := seriesKey{GroupByAuthor, rollup.Author, repository{owner, repo}}
+		for _, k := range []seriesKey{repoKey, authorKey} {
+			if series[k] == nil {
+				series[k] = make(map[time.Time]float64)
+			}
+			series[k][rollup.Day] += float64(rollup.LinesAdded + rollup.LinesDeleted)
+		}
+	}
+
+	for k, byDay := range series {
+		days := make([]time.Time, 0, len(byDay))
+		for day := range byDay {
+			days = append(days, day)
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+		if len(days) >= minAnomalySamples {
+			values := make([]float64, len(days))
+			for i, day := range days {
+				values[i] = byDay[day]
+			}
+			med, scores := robustZScores(values)
+			for i, day := range days {
+				if scores[i] > threshold {
+					anomalies = append(anomalies, Anomaly{
+						Kind: AnomalySpike, Scope: k.scope, Key: k.key, Owner: k.repo.owner, RepoName: k.repo.name,
+						Start: day, End: day.AddDate(0, 0, 1),
+						Value: values[i], Median: med, Score: scores[i],
+					})
+				}
+			}
+		}
+
+		if len(days) > minAnomalySamples {
+			idle := make([]float64, len(days)-1)
+			for i := range idle {
+				idle[i] = days[i+1].Sub(days[i]).Hours()/24 - 1
+			}
+			med, scores := robustZScores(idle)
+			for i := range idle {
+				if scores[i] > threshold && idle[i] >= minSilenceDays {
+					anomalies = append(anomalies, Anomaly{
+						Kind: AnomalySilence, Scope: k.scope, Key: k.key, Owner: k.repo.owner, RepoName: k.repo.name,
+						Start: days[i].AddDate(0, 0, 1), End: days[i+1],
+						Value: idle[i], Median: med, Score: scores[i],
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		a, b := anomalies[i], anomalies[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Key < b.Key
+	})
+	return anomalies
+}
+
+// SaveAnomalies replaces the stored anomalies of a repository, or of every
+// repository when repo is empty, and moves the outlier flag to the commits of
+// the given commit anomalies. An empty owner matches every owner.
+func SaveAnomalies(ctx context.Context, owner, repo string, anomalies []Anomaly) error {
+	scope := Query{Owner: owner, Repo: repo}.Filter()
+
+	collection := db.GetNamedCollection(db.AnomaliesCollection)
+	if _, err := collection.DeleteMany(ctx, scope); err != nil {
+		return fmt.Errorf("failed to clear anomalies: %w", err)
+	}
+	type repository struct{ owner, name string }
+	var repositories []repository
+	outliers := make(map[repository][]string)
+	for _, anomaly := range anomalies {
+		filter := bson.M{
+			"kind": anomaly.Kind, "scope": anomaly.Scope, "key": anomaly.Key,
+			"owner": anomaly.Owner, "reponame": anomaly.RepoName, "start": anomaly.Start,
+		}
+		if anomaly.CommitID != "" {
+			filter["commit_id"] = anomaly.CommitID
+			key := repository{anomaly.Owner, anomaly.RepoName}
+			if _, ok := outliers[key]; !ok {
+				repositories = append(repositories, key)
+			}
+			outliers[key] = append(outliers[key], anomaly.CommitID)
+		}
+		opts := options.Update().SetUpsert(true)
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": anomaly}, opts); err != nil {
+			return fmt.Errorf("failed to save anomaly: %w", err)
+		}
+	}
+
+	commits := db.GetCollection()
+	flagged := bson.M{"outlier": true}
+	for field, value := range scope {
+		flagged[field] = value
+	}
+	if _, err := commits.UpdateMany(ctx, flagged, bson.M{"$unset": bson.M{"outlier": ""}}); err != nil {
+		return fmt.Errorf("failed to clear outlier flags: %w", err)
+	}
+	// A commit shared with a fork or mirror is only an outlier in the
+	// repository it was found in.
+	for _, repo := range repositories {
+		filter := bson.M{"owner": repo.owner, "reponame": repo.name, "commit_id": bson.M{"$in": outliers[repo]}}
+		if _, err := commits.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"outlier": true}}); err != nil {
+			return fmt.Errorf("failed to flag outlier commits of %s: %w", gitmetrics.FullName(repo.owner, repo.name), err)
+		}
+	}
+
+	return nil
+}
+
+// LoadAnomalies returns the stored anomalies of the query's repository that
+// start within its date range, oldest first, optionally only those of one
+// kind.
+func LoadAnomalies(ctx context.Context, q Query, kind string) ([]Anomaly, error) {
+	filter := q.ownerFilter()
+	if q.Repo != "" {
+		filter["reponame"] = q.Repo
+	}
+	if kind != "" {
+		filter["kind"] = kind
+	}
+	dateRange := bson.M{}
+	if !q.From.IsZero() {
+		dateRange["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		dateRange["$lt"] = q.To
+	}
+	if len(dateRange) > 0 {
+		filter["start"] = dateRange
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cursor, err := db.GetNamedCollection(db.AnomaliesCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomalies: %w", err)
+	}
+
+	var anomalies []Anomaly
+	if err := cursor.All(ctx, &anomalies); err != nil {
+		return nil, fmt.Errorf("failed to decode anomalies: %w", err)
+	}
+
+	return anomalies, nil
+}
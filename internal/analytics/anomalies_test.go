@@ -0,0 +1,156 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func day(d int) time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, d-1)
+}
+
+// anomalyCommits are steady daily commits to acme's repo1 with a vendored
+// commit on day 11, followed by four weeks without commits.
+func anomalyCommits() []gitmetrics.Commit {
+	var commits []gitmetrics.Commit
+	for _, d := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 40, 41, 42} {
+		commits = append(commits, gitmetrics.Commit{
+			CommitID: fmt.Sprintf("c%d", d), Owner: "acme", RepoName: "repo1", CommittedBy: "alice",
+			CommitDate: day(d).Add(10 * time.Hour), LinesAdded: 10 + d%5, LinesDeleted: 2,
+		})
+	}
+	commits = append(commits, gitmetrics.Commit{
+		CommitID: "vendor", Owner: "acme", RepoName: "repo1", CommittedBy: "alice",
+		CommitDate: day(11).Add(10 * time.Hour), LinesAdded: 200000,
+	})
+	return commits
+}
+
+func TestRobustZScores(t *testing.T) {
+	med, scores := robustZScores([]float64{1, 2, 3, 4, 100})
+	assert.Equal(t, 3.0, med)
+	assert.InDelta(t, 0.6745*97, scores[4], 1e-9)
+	assert.InDelta(t, -0.6745*2, scores[0], 1e-9)
+
+	// Mostly equal values fall back to the mean absolute deviation.
+	_, scores = robustZScores([]float64{0, 0, 0, 5})
+	assert.InDelta(t, 5/(1.25*1.253314), scores[3], 1e-9)
+
+	_, scores = robustZScores([]float64{2, 2, 2})
+	assert.Equal(t, []float64{0, 0, 0}, scores)
+}
+
+func TestFindAnomalies(t *testing.T) {
+	anomalies := findAnomalies(anomalyCommits(), "acme", "repo1", DefaultAnomalyThreshold)
+
+	assert.Len(t, anomalies, 5)
+
+	for _, spike := range anomalies[:2] {
+		assert.Equal(t, AnomalySpike, spike.Kind)
+		assert.Equal(t, day(11), spike.Start)
+		assert.Equal(t, day(12), spike.End)
+		assert.Equal(t, "acme", spike.Owner)
+		assert.Equal(t, "repo1", spike.RepoName)
+	}
+	assert.Equal(t, []string{GroupByAuthor, GroupByRepo}, []string{anomalies[0].Scope, anomalies[1].Scope})
+	assert.Equal(t, []string{"alice", "acme/repo1"}, []string{anomalies[0].Key, anomalies[1].Key})
+
+	commit := anomalies[2]
+	assert.Equal(t, AnomalyCommit, commit.Kind)
+	assert.Equal(t, "vendor", commit.CommitID)
+	assert.Equal(t, 200000.0, commit.Value)
+	assert.Equal(t, 14.0, commit.Median)
+
+	for _, silence := range anomalies[3:] {
+		assert.Equal(t, AnomalySilence, silence.Kind)
+		assert.Equal(t, day(12), silence.Start)
+		assert.Equal(t, day(40), silence.End)
+		assert.Equal(t, 28.0, silence.Value)
+	}
+}
+
+func TestFindAnomalies_TooFewSamples(t *testing.T) {
+	commits := anomalyCommits()[8:]
+	assert.Empty(t, findAnomalies(commits, "", "", DefaultAnomalyThreshold))
+}
+
+func TestFindAnomalies_Forks(t *testing.T) {
+	commits := anomalyCommits()
+	for _, commit := range anomalyCommits() {
+		commit.Owner = "fork"
+		commits = append(commits, commit)
+	}
+
+	var outliers []string
+	for _, anomaly := range findAnomalies(commits, "", "repo1", DefaultAnomalyThreshold) {
+		if anomaly.Kind == AnomalyCommit {
+			outliers = append(outliers, anomaly.Key+"@"+anomaly.CommitID)
+		}
+	}
+	// A fork's copy of the history is its own series, not a second sample
+	// of its upstream's.
+	assert.ElementsMatch(t, []string{"acme/repo1@vendor", "fork/repo1@vendor"}, outliers)
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	commitCollection := mockCommitCollection(t, anomalyCommits())
+	commitCollection.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	anomalyCollection := new(db.MockCollection)
+	anomalyCollection.On("DeleteMany", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1"}, mock.Anything).Return(&mongo.DeleteResult{}, nil)
+	anomalyCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	t.Cleanup(func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc })
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.AnomaliesCollection, name)
+		return anomalyCollection
+	}
+
+	anomalies, err := DetectAnomalies(context.Background(), "acme", "repo1", 0)
+	assert.NoError(t, err)
+	assert.Len(t, anomalies, 5)
+
+	anomalyCollection.AssertNumberOfCalls(t, "UpdateOne", 5)
+	commitCollection.AssertCalled(t, "Find", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1"}, mock.Anything)
+	commitCollection.AssertCalled(t, "UpdateMany", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "outlier": true}, bson.M{"$unset": bson.M{"outlier": ""}}, mock.Anything)
+	commitCollection.AssertCalled(t, "UpdateMany", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "commit_id": bson.M{"$in": []string{"vendor"}}}, bson.M{"$set": bson.M{"outlier": true}}, mock.Anything)
+}
+
+func TestSaveAnomalies_Error(t *testing.T) {
+	anomalyCollection := new(db.MockCollection)
+	anomalyCollection.On("DeleteMany", mock.Anything, bson.M{}, mock.Anything).Return(new(mongo.DeleteResult), errors.New("database unavailable"))
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	t.Cleanup(func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc })
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		return anomalyCollection
+	}
+
+	err := SaveAnomalies(context.Background(), "", "", nil)
+	assert.ErrorContains(t, err, "failed to clear anomalies")
+}
+
+func TestLoadAnomalies(t *testing.T) {
+	anomalyCollection := mockNamedCollection(t, db.AnomaliesCollection, []interface{}{
+		Anomaly{Kind: AnomalySpike, Scope: GroupByRepo, Key: "repo1", RepoName: "repo1", Start: day(11)},
+	})
+
+	anomalies, err := LoadAnomalies(context.Background(), Query{Owner: "acme", Repo: "repo1", From: day(1), To: day(32)}, AnomalySpike)
+	assert.NoError(t, err)
+	assert.Len(t, anomalies, 1)
+	anomalyCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"owner":    "acme",
+		"reponame": "repo1",
+		"kind":     AnomalySpike,
+		"start":    bson.M{"$gte": day(1), "$lt": day(32)},
+	}, mock.Anything)
+}
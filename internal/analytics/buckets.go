@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Bucket is the width of the periods commits are grouped into.
+type Bucket string
+
+const (
+	BucketDay   Bucket = "day"
+	BucketWeek  Bucket = "week"
+	BucketMonth Bucket = "month"
+)
+
+// ParseBucket validates a bucket name, defaulting to weekly buckets.
+func ParseBucket(name string) (Bucket, error) {
+	switch Bucket(name) {
+	case "":
+		return BucketWeek, nil
+	case BucketDay, BucketWeek, BucketMonth:
+		return Bucket(name), nil
+	}
+	return "", fmt.Errorf("unknown bucket %q, expected day, week or month", name)
+}
+
+// Truncate returns the start of the bucket containing t, in t's location.
+// Weeks start on Monday.
+func (b Bucket) Truncate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch b {
+	case BucketWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case BucketMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// Next returns the start of the bucket following the one starting at start.
+func (b Bucket) Next(start time.Time) time.Time {
+	switch b {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
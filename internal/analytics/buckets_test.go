@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBucket(t *testing.T) {
+	bucket, err := ParseBucket("")
+	assert.NoError(t, err)
+	assert.Equal(t, BucketWeek, bucket)
+
+	bucket, err = ParseBucket("month")
+	assert.NoError(t, err)
+	assert.Equal(t, BucketMonth, bucket)
+
+	_, err = ParseBucket("fortnight")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown bucket")
+}
+
+func TestBucketTruncate(t *testing.T) {
+	// 2024-05-16 is a Thursday.
+	ts := time.Date(2024, 5, 16, 15, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC), BucketDay.Truncate(ts))
+	assert.Equal(t, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), BucketWeek.Truncate(ts))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), BucketMonth.Truncate(ts))
+
+	// Sundays belong to the week that started on the previous Monday.
+	sunday := time.Date(2024, 5, 19, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), BucketWeek.Truncate(sunday))
+}
+
+func TestBucketNext(t *testing.T) {
+	start := time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC), BucketDay.Next(start))
+	assert.Equal(t, time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC), BucketWeek.Next(start))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), BucketMonth.Next(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+)
+
+type changelogSection struct {
+	Type  string
+	Title string
+}
+
+// changelogSections lists the sections of a generated changelog in the order
+// they are rendered. Commits of other types end up under "Other Changes".
+var changelogSections = []changelogSection{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+	{"refactor", "Code Refactoring"},
+	{"docs", "Documentation"},
+	{"test", "Tests"},
+	{"build", "Build System"},
+	{"ci", "Continuous Integration"},
+	{"style", "Styles"},
+	{"chore", "Chores"},
+}
+
+const otherChangesTitle = "Other Changes"
+
+// GenerateChangelog renders the given commits as a Markdown changelog grouped
+// by Conventional Commits type, newest commits first. Breaking changes are
+// additionally listed in their own section at the top.
+func GenerateChangelog(title string, commits []gitmetrics.Commit) string {
+	sorted := make([]gitmetrics.Commit, len(commits))
+	copy(sorted, commits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CommitDate.After(sorted[j].CommitDate)
+	})
+
+	known := make(map[string]bool, len(changelogSections))
+	for _, section := range changelogSections {
+		known[section.Type] = true
+	}
+
+	var breaking []gitmetrics.Commit
+	byType := make(map[string][]gitmetrics.Commit)
+	for _, commit := range sorted {
+		kind := commit.Conventional.Type
+		if !known[kind] {
+			kind = ""
+		}
+		byType[kind] = append(byType[kind], commit)
+		if commit.Conventional.Breaking {
+			breaking = append(breaking, commit)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s\n", title)
+
+	if len(commits) == 0 {
+		sb.WriteString("\nNo changes.\n")
+		return sb.String()
+	}
+
+	if len(breaking) > 0 {
+		sb.WriteString("\n### BREAKING CHANGES\n\n")
+		for _, commit := range breaking {
+			writeChangelogEntry(&sb, commit)
+			if description := commit.Conventional.BreakingDescription(); description != "" {
+				for _, line := range strings.Split(description, "\n") {
+					fmt.Fprintf(&sb, "  %s\n", line)
+				}
+			}
+		}
+	}
+
+	for _, section := range changelogSections {
+		writeChangelogSection(&sb, section.Title, byType[section.Type])
+	}
+	writeChangelogSection(&sb, otherChangesTitle, byType[""])
+
+	return sb.String()
+}
+
+func writeChangelogSection(sb *strings.Builder, title string, commits []gitmetrics.Commit) {
+	if len(commits) == 0 {
+		return
+	}
+	fmt.Fprintf(sb, "\n### %s\n\n", title)
+	for _, commit := range commits {
+		writeChangelogEntry(sb, commit)
+	}
+}
+
+func writeChangelogEntry(sb *strings.Builder, commit gitmetrics.Commit) {
+	subject := commit.Conventional.Subject
+	if subject == "" {
+		subject, _, _ = strings.Cut(strings.TrimSpace(commit.CommitMessage), "\n")
+	}
+
+	sb.WriteString("* ")
+	if commit.Conventional.Scope != "" {
+		fmt.Fprintf(sb, "**%s:** ", commit.Conventional.Scope)
+	}
+	fmt.Fprintf(sb, "%s (%s)\n", subject, shortSHA(commit.CommitID))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
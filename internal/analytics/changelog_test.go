@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateChangelog(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	commits := []gitmetrics.Commit{
+		{
+			CommitID:      "1111111aaaa",
+			CommitMessage: "feat(api): add changelog endpoint",
+			CommitDate:    day(1),
+			Conventional:  gitmetrics.ParseConventionalCommit("feat(api): add changelog endpoint"),
+		},
+		{
+			CommitID:      "2222222bbbb",
+			CommitMessage: "fix: handle empty repos",
+			CommitDate:    day(2),
+			Conventional:  gitmetrics.ParseConventionalCommit("fix: handle empty repos"),
+		},
+		{
+			CommitID:      "3333333cccc",
+			CommitMessage: "feat!: rename stored fields\n\nBREAKING CHANGE: reponame is now repo_name",
+			CommitDate:    day(3),
+			Conventional:  gitmetrics.ParseConventionalCommit("feat!: rename stored fields\n\nBREAKING CHANGE: reponame is now repo_name"),
+		},
+		{
+			CommitID:      "4444444dddd",
+			CommitMessage: "Update README.md\n\nMore docs",
+			CommitDate:    day(4),
+			Conventional:  gitmetrics.ParseConventionalCommit("Update README.md\n\nMore docs"),
+		},
+	}
+
+	expected := `## v1.0.0
+
+### BREAKING CHANGES
+
+* rename stored fields (3333333)
+  reponame is now repo_name
+
+### Features
+
+* rename stored fields (3333333)
+* **api:** add changelog endpoint (1111111)
+
+### Bug Fixes
+
+* handle empty repos (2222222)
+
+### Other Changes
+
+* Update README.md (4444444)
+`
+	assert.Equal(t, expected, GenerateChangelog("v1.0.0", commits))
+}
+
+func TestGenerateChangelog_NoCommits(t *testing.T) {
+	assert.Equal(t, "## Unreleased\n\nNo changes.\n", GenerateChangelog("Unreleased", nil))
+}
@@ -0,0 +1,210 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Groupings of the analytics computations.
+const (
+	GroupByFile        = "file"
+	GroupByAuthor      = "author"
+	GroupByRepo        = "repo"
+	GroupByTeam        = "team"
+	GroupByCommit      = "commit"
+	GroupByPullRequest = "pr"
+)
+
+// DefaultReworkWindow is how recent deleted lines must be to count as rework
+// when the caller doesn't choose a window.
+const DefaultReworkWindow = 21 * 24 * time.Hour
+
+// ChurnOptions controls how churn is grouped and how rework is detected.
+// Bucket is optional; without it every group gets a single entry for the
+// whole query range. Teams are the teams to group by when grouping by team.
+type ChurnOptions struct {
+	GroupBy      string
+	Bucket       Bucket
+	ReworkWindow time.Duration
+	Teams        []teams.Team
+}
+
+// Churn computes lines added, deleted, net growth and rework per file or per
+// author for the commits matching the query. Rework is the number of deleted
+// lines that had been added to the same file within the rework window, so
+// commits from before the query range are loaded to know what was written
+// recently.
+func Churn(ctx context.Context, q Query, opts ChurnOptions) ([]ChurnEntry, error) {
+	if opts.GroupBy != GroupByFile && opts.GroupBy != GroupByAuthor && opts.GroupBy != GroupByTeam {
+		return nil, fmt.Errorf("unknown churn grouping %q, expected file, author or team", opts.GroupBy)
+	}
+	if opts.ReworkWindow <= 0 {
+		opts.ReworkWindow = DefaultReworkWindow
+	}
+
+	history := Query{Owner: q.Owner, Repo: q.Repo, To: q.To, ExcludeOutliers: q.ExcludeOutliers}
+	if !q.From.IsZero() {
+		history.From = q.From.Add(-opts.ReworkWindow)
+	}
+	commits, err := LoadCommits(ctx, history)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeChurn(commits, q, opts), nil
+}
+
+// fileLedger tracks the lines recently added to a file, oldest first.
+type fileLedger []ledgerEntry
+
+type ledgerEntry struct {
+	at    time.Time
+	lines int
+}
+
+// consume removes up to lines recently added lines, newest first, ignoring
+// additions older than cutoff, and returns how many were removed.
+func (l *fileLedger) consume(lines int, cutoff time.Time) int {
+	entries := *l
+	start := 0
+	for start < len(entries) && entries[start].at.Before(cutoff) {
+		start++
+	}
+	entries = entries[start:]
+
+	consumed := 0
+	for i := len(entries) - 1; i >= 0 && consumed < lines; i-- {
+		take := entries[i].lines
+		if remaining := lines - consumed; take > remaining {
+			take = remaining
+		}
+		entries[i].lines -= take
+		consumed += take
+		if entries[i].lines == 0 {
+			entries = entries[:i]
+		}
+	}
+
+	*l = entries
+	return consumed
+}
+
+type churnKey struct {
+	repo, key string
+	period    time.Time
+}
+
+// churnKeys returns the entries a file change counts towards. A change by a
+// member of several teams counts towards each of them, and changes by
+// contributors outside every team are left out when grouping by team.
+func churnKeys(commit gitmetrics.Commit, file gitmetrics.FileChange, period time.Time, opts ChurnOptions) []churnKey {
+	switch opts.GroupBy {
+	case GroupByFile:
+		return []churnKey{{repo: gitmetrics.FullName(commit.Owner, commit.RepoName), key: file.Filename, period: period}}
+	case GroupByTeam:
+		var keys []churnKey
+		for _, team := range teams.TeamsOf(opts.Teams, commit.CommittedBy, commit.AuthorLogin) {
+			keys = append(keys, churnKey{key: team, period: period})
+		}
+		return keys
+	}
+	return []churnKey{{key: commit.CommittedBy, period: period}}
+}
+
+func computeChurn(commits []gitmetrics.Commit, q Query, opts ChurnOptions) []ChurnEntry {
+	sorted := make([]gitmetrics.Commit, len(commits))
+	copy(sorted, commits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CommitDate.Before(sorted[j].CommitDate)
+	})
+
+	entries := make(map[churnKey]*ChurnEntry)
+	commitsSeen := make(map[churnKey]map[string]bool)
+	ledgers := make(map[string]*fileLedger)
+
+	for _, commit := range sorted {
+		counted := (q.From.IsZero() || !commit.CommitDate.Before(q.From)) && q.matchesAuthor(commit)
+		var period time.Time
+		if opts.Bucket != "" {
+			period = opts.Bucket.Truncate(commit.CommitDate.UTC())
+		}
+		cutoff := commit.CommitDate.Add(-opts.ReworkWindow)
+
+		repo := gitmetrics.FullName(commit.Owner, commit.RepoName)
+		for _, file := range commit.Files {
+			path := repo + "/" + file.Filename
+			if file.PreviousFilename != "" {
+				if ledger, ok := ledgers[repo+"/"+file.PreviousFilename]; ok {
+					ledgers[path] = ledger
+					delete(ledgers, repo+"/"+file.PreviousFilename)
+				}
+			}
+			ledger, ok := ledgers[path]
+			if !ok {
+				ledger = &fileLedger{}
+				ledgers[path] = ledger
+			}
+
+			rework := ledger.consume(file.Deletions, cutoff)
+			if file.Status == "removed" {
+				delete(ledgers, path)
+			} else if file.Additions > 0 {
+				*ledger = append(*ledger, ledgerEntry{at: commit.CommitDate, lines: file.Additions})
+			}
+
+			if !counted {
+				continue
+			}
+
+			for _, key := range churnKeys(commit, file, period, opts) {
+				entry, ok := entries[key]
+				if !ok {
+					entry = &ChurnEntry{Repo: key.repo, Key: key.key}
+					if opts.Bucket != "" {
+						entry.Period = &key.period
+					}
+					entries[key] = entry
+					commitsSeen[key] = make(map[string]bool)
+				}
+				if !commitsSeen[key][commit.CommitID] {
+					commitsSeen[key][commit.CommitID] = true
+					entry.Commits++
+				}
+				entry.LinesAdded += file.Additions
+				entry.LinesDeleted += file.Deletions
+				entry.ReworkLines += rework
+			}
+		}
+	}
+
+	result := make([]ChurnEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Churn = entry.LinesAdded + entry.LinesDeleted
+		entry.NetGrowth = entry.LinesAdded - entry.LinesDeleted
+		if entry.LinesDeleted > 0 {
+			entry.ReworkRate = float64(entry.ReworkLines) / float64(entry.LinesDeleted)
+		}
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Period != nil && b.Period != nil && !a.Period.Equal(*b.Period) {
+			return a.Period.Before(*b.Period)
+		}
+		if a.Churn != b.Churn {
+			return a.Churn > b.Churn
+		}
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Key < b.Key
+	})
+
+	return result
+}
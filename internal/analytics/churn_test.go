@@ -0,0 +1,135 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func churnCommits() []gitmetrics.Commit {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	return []gitmetrics.Commit{
+		{CommitID: "c1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: day(1), Files: []gitmetrics.FileChange{
+			{Filename: "main.go", Status: "added", Additions: 100},
+			{Filename: "old.go", Status: "added", Additions: 10},
+		}},
+		{CommitID: "c2", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", CommitDate: day(5), Files: []gitmetrics.FileChange{
+			{Filename: "main.go", Status: "modified", Additions: 20, Deletions: 30},
+		}},
+		{CommitID: "c3", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: day(30), Files: []gitmetrics.FileChange{
+			// Everything in main.go is older than 21 days by now.
+			{Filename: "main.go", Status: "modified", Additions: 5, Deletions: 10},
+			{Filename: "new.go", PreviousFilename: "old.go", Status: "renamed", Additions: 1, Deletions: 1},
+		}},
+	}
+}
+
+func TestComputeChurn_ByFile(t *testing.T) {
+	entries := computeChurn(churnCommits(), Query{}, ChurnOptions{GroupBy: GroupByFile, ReworkWindow: DefaultReworkWindow})
+
+	assert.Equal(t, []ChurnEntry{
+		{Repo: "acme/repo1", Key: "main.go", Commits: 3, LinesAdded: 125, LinesDeleted: 40, Churn: 165, NetGrowth: 85, ReworkLines: 30, ReworkRate: 0.75},
+		{Repo: "acme/repo1", Key: "old.go", Commits: 1, LinesAdded: 10, Churn: 10, NetGrowth: 10},
+		{Repo: "acme/repo1", Key: "new.go", Commits: 1, LinesAdded: 1, LinesDeleted: 1, Churn: 2, NetGrowth: 0},
+	}, entries)
+}
+
+func TestComputeChurn_Forks(t *testing.T) {
+	entries := computeChurn(withFork(churnCommits()), Query{}, ChurnOptions{GroupBy: GroupByFile, ReworkWindow: DefaultReworkWindow})
+
+	// A fork's files and rework are tracked apart from its upstream's.
+	assert.Len(t, entries, 6)
+	for _, entry := range entries {
+		if entry.Key == "main.go" {
+			assert.Equal(t, 3, entry.Commits, entry.Repo)
+			assert.Equal(t, 30, entry.ReworkLines, entry.Repo)
+		}
+	}
+	assert.ElementsMatch(t, []string{"acme/repo1", "fork/repo1"}, []string{entries[0].Repo, entries[1].Repo})
+}
+
+func TestComputeChurn_ReworkFollowsRenames(t *testing.T) {
+	commits := churnCommits()
+	commits[2].CommitDate = time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	entries := computeChurn(commits, Query{}, ChurnOptions{GroupBy: GroupByFile, ReworkWindow: DefaultReworkWindow})
+	for _, entry := range entries {
+		if entry.Key == "new.go" {
+			assert.Equal(t, 1, entry.ReworkLines)
+		}
+		if entry.Key == "main.go" {
+			// bob rewrote 30 of alice's lines, then alice rewrote 10 of bob's.
+			assert.Equal(t, 40, entry.ReworkLines)
+		}
+	}
+}
+
+func TestComputeChurn_ByAuthorWithWindow(t *testing.T) {
+	q := Query{From: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Author: "bob"}
+	entries := computeChurn(churnCommits(), q, ChurnOptions{GroupBy: GroupByAuthor, Bucket: BucketMonth, ReworkWindow: DefaultReworkWindow})
+
+	month := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []ChurnEntry{
+		{Key: "bob", Period: &month, Commits: 1, LinesAdded: 20, LinesDeleted: 30, Churn: 50, NetGrowth: -10, ReworkLines: 30, ReworkRate: 1},
+	}, entries)
+}
+
+func TestComputeChurn_ByTeam(t *testing.T) {
+	opts := ChurnOptions{GroupBy: GroupByTeam, ReworkWindow: DefaultReworkWindow, Teams: []teams.Team{
+		{Name: "backend", Members: []string{"alice", "bob"}},
+		{Name: "reviewers", Members: []string{"bob"}},
+	}}
+	entries := computeChurn(churnCommits(), Query{}, opts)
+
+	assert.Equal(t, []ChurnEntry{
+		{Key: "backend", Commits: 3, LinesAdded: 136, LinesDeleted: 41, Churn: 177, NetGrowth: 95, ReworkLines: 30, ReworkRate: 30.0 / 41},
+		{Key: "reviewers", Commits: 1, LinesAdded: 20, LinesDeleted: 30, Churn: 50, NetGrowth: -10, ReworkLines: 30, ReworkRate: 1},
+	}, entries)
+}
+
+func TestComputeChurn_TeamFilter(t *testing.T) {
+	q := Query{Team: &teams.Team{Name: "web", Members: []string{"bob"}}}
+	entries := computeChurn(churnCommits(), q, ChurnOptions{GroupBy: GroupByAuthor, ReworkWindow: DefaultReworkWindow})
+
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "bob", entries[0].Key)
+	// Rework still accounts for the lines alice wrote before bob deleted them.
+	assert.Equal(t, 30, entries[0].ReworkLines)
+}
+
+func TestFileLedgerConsume(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	ledger := fileLedger{{at: day(1), lines: 10}, {at: day(2), lines: 5}, {at: day(3), lines: 5}}
+
+	assert.Equal(t, 7, ledger.consume(7, day(2)))
+	assert.Equal(t, fileLedger{{at: day(2), lines: 3}}, ledger)
+	assert.Equal(t, 3, ledger.consume(50, day(1)))
+	assert.Empty(t, ledger)
+}
+
+func TestChurn_LoadsReworkHistory(t *testing.T) {
+	mockCollection := mockCommitCollection(t, churnCommits())
+
+	from := time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)
+	entries, err := Churn(context.Background(), Query{Repo: "repo1", From: from}, ChurnOptions{GroupBy: GroupByAuthor})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0].Key)
+
+	mockCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"reponame":    "repo1",
+		"commit_date": bson.M{"$gte": from.Add(-DefaultReworkWindow)},
+	}, mock.Anything)
+}
+
+func TestChurn_UnknownGrouping(t *testing.T) {
+	_, err := Churn(context.Background(), Query{}, ChurnOptions{GroupBy: "directory"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown churn grouping")
+}
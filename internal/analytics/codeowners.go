@@ -0,0 +1,157 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CODEOWNERS change actions.
+const (
+	CodeOwnersActionAdd    = "add"
+	CodeOwnersActionChange = "change"
+	CodeOwnersActionKeep   = "keep"
+)
+
+// maxSuggestedOwners caps the owners suggested for a single pattern.
+const maxSuggestedOwners = 3
+
+// SuggestCodeOwners turns directory ownership into CODEOWNERS rules. A
+// directory is owned by the contributors with a GitHub login whose share of
+// changed lines is at least minShare, most significant first. Directories
+// owned by exactly the same people as their parent are left out because the
+// parent's rule already covers them.
+func SuggestCodeOwners(ownership []DirectoryOwnership, minShare float64) []CodeOwnersRule {
+	sorted := make([]DirectoryOwnership, len(ownership))
+	copy(sorted, ownership)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Directory < sorted[j].Directory })
+
+	ownersByDir := make(map[string][]string)
+	var rules []CodeOwnersRule
+	for _, dir := range sorted {
+		var owners []string
+		for _, owner := range dir.Owners {
+			if owner.Login == "" || owner.Share < minShare {
+				continue
+			}
+			owners = append(owners, "@"+owner.Login)
+			if len(owners) == maxSuggestedOwners {
+				break
+			}
+		}
+		if len(owners) == 0 {
+			continue
+		}
+		ownersByDir[dir.Directory] = owners
+
+		if parent, ok := ownersByDir[nearestOwnedParent(dir.Directory, ownersByDir)]; ok && equalOwners(parent, owners) {
+			continue
+		}
+		rules = append(rules, CodeOwnersRule{Pattern: codeOwnersPattern(dir.Directory), Owners: owners})
+	}
+
+	return rules
+}
+
+func nearestOwnedParent(dir string, ownersByDir map[string][]string) string {
+	for dir != RootDirectory {
+		trimmed := strings.TrimSuffix(dir, "/")
+		if i := strings.LastIndex(trimmed, "/"); i >= 0 {
+			dir = trimmed[:i+1]
+		} else {
+			dir = RootDirectory
+		}
+		if _, ok := ownersByDir[dir]; ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+func codeOwnersPattern(dir string) string {
+	if dir == RootDirectory {
+		return "*"
+	}
+	return "/" + dir
+}
+
+func equalOwners(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseCodeOwners reads the rules of a CODEOWNERS file, skipping comments
+// and blank lines.
+func ParseCodeOwners(content string) []CodeOwnersRule {
+	var rules []CodeOwnersRule
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rules = append(rules, CodeOwnersRule{Pattern: fields[0], Owners: fields[1:]})
+	}
+	return rules
+}
+
+// RenderCodeOwners formats rules as a CODEOWNERS file.
+func RenderCodeOwners(rules []CodeOwnersRule) string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by git_metrics from commit ownership data.\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&sb, "%s %s\n", rule.Pattern, strings.Join(rule.Owners, " "))
+	}
+	return sb.String()
+}
+
+// DiffCodeOwners compares existing rules with suggested ones. Owners are
+// compared case-insensitively and regardless of order.
+func DiffCodeOwners(existing, suggested []CodeOwnersRule) []CodeOwnersChange {
+	current := make(map[string][]string, len(existing))
+	for _, rule := range existing {
+		current[rule.Pattern] = rule.Owners
+	}
+
+	var changes []CodeOwnersChange
+	suggestedPatterns := make(map[string]bool, len(suggested))
+	for _, rule := range suggested {
+		suggestedPatterns[rule.Pattern] = true
+		owners, ok := current[rule.Pattern]
+		switch {
+		case !ok:
+			changes = append(changes, CodeOwnersChange{Action: CodeOwnersActionAdd, Pattern: rule.Pattern, Suggested: rule.Owners})
+		case !sameOwnerSet(owners, rule.Owners):
+			changes = append(changes, CodeOwnersChange{Action: CodeOwnersActionChange, Pattern: rule.Pattern, Current: owners, Suggested: rule.Owners})
+		}
+	}
+
+	for _, rule := range existing {
+		if !suggestedPatterns[rule.Pattern] {
+			changes = append(changes, CodeOwnersChange{Action: CodeOwnersActionKeep, Pattern: rule.Pattern, Current: rule.Owners})
+		}
+	}
+
+	return changes
+}
+
+func sameOwnerSet(a, b []string) bool {
+	normalize := func(owners []string) []string {
+		result := make([]string, len(owners))
+		for i, owner := range owners {
+			result[i] = strings.ToLower(owner)
+		}
+		sort.Strings(result)
+		return result
+	}
+	return equalOwners(normalize(a), normalize(b))
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestCodeOwners(t *testing.T) {
+	ownership := []DirectoryOwnership{
+		{Directory: "internal/db/", Owners: []OwnerShare{{Login: "bob", Share: 0.9}, {Login: "alice", Share: 0.1}}},
+		{Directory: "/", Owners: []OwnerShare{{Login: "alice", Share: 0.6}, {Login: "bob", Share: 0.3}, {Name: "No Login", Share: 0.1}}},
+		{Directory: "internal/", Owners: []OwnerShare{{Login: "alice", Share: 0.55}, {Login: "bob", Share: 0.45}}},
+		{Directory: "docs/", Owners: []OwnerShare{{Name: "Carol", Share: 1}}},
+	}
+
+	assert.Equal(t, []CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@alice", "@bob"}},
+		{Pattern: "/internal/db/", Owners: []string{"@bob"}},
+	}, SuggestCodeOwners(ownership, 0.25))
+}
+
+func TestSuggestCodeOwners_CapsOwners(t *testing.T) {
+	ownership := []DirectoryOwnership{{Directory: "/", Owners: []OwnerShare{
+		{Login: "a", Share: 0.25}, {Login: "b", Share: 0.25}, {Login: "c", Share: 0.25}, {Login: "d", Share: 0.25},
+	}}}
+
+	rules := SuggestCodeOwners(ownership, 0.2)
+	assert.Equal(t, []string{"@a", "@b", "@c"}, rules[0].Owners)
+}
+
+func TestParseCodeOwners(t *testing.T) {
+	content := "# Owners\n\n*       @alice @bob\n/docs/  @carol # writers\n"
+
+	assert.Equal(t, []CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@alice", "@bob"}},
+		{Pattern: "/docs/", Owners: []string{"@carol"}},
+	}, ParseCodeOwners(content))
+	assert.Empty(t, ParseCodeOwners(""))
+}
+
+func TestRenderCodeOwners(t *testing.T) {
+	rendered := RenderCodeOwners([]CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@alice"}},
+		{Pattern: "/internal/db/", Owners: []string{"@bob", "@alice"}},
+	})
+
+	assert.Equal(t, "# Generated by git_metrics from commit ownership data.\n* @alice\n/internal/db/ @bob @alice\n", rendered)
+	assert.Equal(t, ParseCodeOwners(rendered), []CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@alice"}},
+		{Pattern: "/internal/db/", Owners: []string{"@bob", "@alice"}},
+	})
+}
+
+func TestDiffCodeOwners(t *testing.T) {
+	existing := []CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@Bob", "@alice"}},
+		{Pattern: "/docs/", Owners: []string{"@carol"}},
+		{Pattern: "/internal/", Owners: []string{"@alice"}},
+	}
+	suggested := []CodeOwnersRule{
+		{Pattern: "*", Owners: []string{"@alice", "@bob"}},
+		{Pattern: "/internal/", Owners: []string{"@bob"}},
+		{Pattern: "/internal/db/", Owners: []string{"@bob"}},
+	}
+
+	assert.Equal(t, []CodeOwnersChange{
+		{Action: CodeOwnersActionChange, Pattern: "/internal/", Current: []string{"@alice"}, Suggested: []string{"@bob"}},
+		{Action: CodeOwnersActionAdd, Pattern: "/internal/db/", Suggested: []string{"@bob"}},
+		{Action: CodeOwnersActionKeep, Pattern: "/docs/", Current: []string{"@carol"}},
+	}, DiffCodeOwners(existing, suggested))
+}
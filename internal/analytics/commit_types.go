@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+)
+
+// UnconventionalType is the type reported for commits whose message doesn't
+// follow the Conventional Commits specification.
+const UnconventionalType = "unconventional"
+
+// CommitTypeCounts counts the commits matching the query by repository,
+// bucketed period and Conventional Commits type.
+func CommitTypeCounts(ctx context.Context, q Query, bucket Bucket) ([]TypeCount, error) {
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return countCommitTypes(commits, bucket), nil
+}
+
+func countCommitTypes(commits []gitmetrics.Commit, bucket Bucket) []TypeCount {
+	type key struct {
+		repo   string
+		period time.Time
+		kind   string
+	}
+
+	counts := make(map[key]int)
+	for _, commit := range commits {
+		kind := commit.Conventional.Type
+		if kind == "" {
+			kind = UnconventionalType
+		}
+		counts[key{gitmetrics.FullName(commit.Owner, commit.RepoName), bucket.Truncate(commit.CommitDate.UTC()), kind}]++
+	}
+
+	result := make([]TypeCount, 0, len(counts))
+	for k, count := range counts {
+		result = append(result, TypeCount{Repo: k.repo, Period: k.period, Type: k.kind, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if !a.Period.Equal(b.Period) {
+			return a.Period.Before(b.Period)
+		}
+		return a.Type < b.Type
+	})
+
+	return result
+}
@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitTypeCounts(t *testing.T) {
+	commits := []gitmetrics.Commit{
+		{RepoName: "repo1", CommitDate: time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC), Conventional: gitmetrics.ConventionalCommit{Type: "feat"}},
+		{RepoName: "repo1", CommitDate: time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC), Conventional: gitmetrics.ConventionalCommit{Type: "feat"}},
+		{RepoName: "repo1", CommitDate: time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC), Conventional: gitmetrics.ConventionalCommit{Type: "fix"}},
+		{RepoName: "repo1", CommitDate: time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)},
+		{RepoName: "repo2", CommitDate: time.Date(2024, 5, 14, 9, 0, 0, 0, time.UTC), Conventional: gitmetrics.ConventionalCommit{Type: "chore"}},
+	}
+	mockCommitCollection(t, commits)
+
+	counts, err := CommitTypeCounts(context.Background(), Query{}, BucketWeek)
+	assert.NoError(t, err)
+
+	week1 := time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)
+	week2 := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []TypeCount{
+		{Repo: "repo1", Period: week1, Type: "feat", Count: 2},
+		{Repo: "repo1", Period: week1, Type: "fix", Count: 1},
+		{Repo: "repo1", Period: week2, Type: UnconventionalType, Count: 1},
+		{Repo: "repo2", Period: week1, Type: "chore", Count: 1},
+	}, counts)
+}
+
+func TestCountCommitTypes_Forks(t *testing.T) {
+	commits := []gitmetrics.Commit{
+		{Owner: "acme", RepoName: "repo1", CommitID: "c1", CommitDate: time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC), Conventional: gitmetrics.ConventionalCommit{Type: "feat"}},
+	}
+
+	week := time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []TypeCount{
+		{Repo: "acme/repo1", Period: week, Type: "feat", Count: 1},
+		{Repo: "fork/repo1", Period: week, Type: "feat", Count: 1},
+	}, countCommitTypes(withFork(commits), BucketWeek))
+}
+
+func TestCommitTypeCounts_Empty(t *testing.T) {
+	mockCommitCollection(t, nil)
+
+	counts, err := CommitTypeCounts(context.Background(), Query{}, BucketDay)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
@@ -0,0 +1,266 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReleaseDeploymentSource marks deployments derived from releases for
+// repositories that don't record deployments.
+const ReleaseDeploymentSource = "release"
+
+// LoadDeployments returns the stored deployments of the query's repository
+// and environment that finished before the end of its range, oldest first.
+// Earlier deployments are included because they are the baseline for lead
+// times and restores inside the range.
+func LoadDeployments(ctx context.Context, q Query, environment string) ([]gitmetrics.Deployment, error) {
+	filter := q.repoFilter()
+	if environment != "" {
+		filter["environment"] = environment
+	}
+	if !q.To.IsZero() {
+		filter["finished_at"] = bson.M{"$lt": q.To}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "finished_at", Value: 1}})
+	cursor, err := db.GetNamedCollection(db.DeploymentsCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %w", err)
+	}
+
+	var deployments []gitmetrics.Deployment
+	if err := cursor.All(ctx, &deployments); err != nil {
+		return nil, fmt.Errorf("failed to decode deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// DORAReports computes the four DORA metrics per repository and environment
+// over the query's range, and per environment for the query's team when it
+// has one. Repositories without recorded deployments fall back to treating
+// their releases as successful deployments, unless another environment is
+// requested.
+func DORAReports(ctx context.Context, q Query, environment string) ([]DORAMetrics, error) {
+	deployments, err := LoadDeployments(ctx, q, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Release fallbacks are only reported under their own environment.
+	if environment == "" || environment == ReleaseDeploymentSource {
+		releases, err := LoadReleases(ctx, Query{Owner: q.Owner, Repo: q.Repo, Team: q.Team, To: q.To})
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, releaseDeployments(deployments, releases)...)
+	}
+
+	filter := q.repoFilter()
+	if !q.To.IsZero() {
+		filter["commit_date"] = bson.M{"$lt": q.To}
+	}
+	commits, err := findCommits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var team string
+	if q.Team != nil {
+		team = q.Team.Name
+	}
+	return computeDORA(deployments, commits, q.From, q.To, team), nil
+}
+
+// releaseDeployments converts the releases of repositories that have no
+// deployments into successful deployments.
+func releaseDeployments(deployments []gitmetrics.Deployment, releases []gitmetrics.Release) []gitmetrics.Deployment {
+	deployed := make(map[string]bool)
+	for _, deployment := range deployments {
+		deployed[gitmetrics.FullName(deployment.Owner, deployment.RepoName)] = true
+	}
+
+	var result []gitmetrics.Deployment
+	for _, release := range releases {
+		if deployed[gitmetrics.FullName(release.Owner, release.RepoName)] {
+			continue
+		}
+		result = append(result, gitmetrics.Deployment{
+			DeploymentID: release.TagName,
+			Owner:        release.Owner,
+			RepoName:     release.RepoName,
+			Environment:  ReleaseDeploymentSource,
+			CommitID:     release.CommitID,
+			Status:       gitmetrics.DeploymentSuccess,
+			Source:       ReleaseDeploymentSource,
+			CreatedAt:    release.ReleasedAt,
+			FinishedAt:   release.ReleasedAt,
+		})
+	}
+	return result
+}
+
+// doraSamples are the deployments, lead times and restore times of a stream
+// of deployments, from which its DORA metrics are computed.
+type doraSamples struct {
+	deployments, failed int
+	leadTimes, restores []float64
+	finishedAt          []time.Time
+	sources             []gitmetrics.Deployment
+}
+
+func (s *doraSamples) add(other doraSamples) {
+	s.deployments += other.deployments
+	s.failed += other.failed
+	s.leadTimes = append(s.leadTimes, other.leadTimes...)
+	s.restores = append(s.restores, other.restores...)
+	s.finishedAt = append(s.finishedAt, other.finishedAt...)
+	s.sources = append(s.sources, other.sources...)
+}
+
+// fill sets the metrics computed from the samples.
+func (s doraSamples) fill(metrics *DORAMetrics, from, to time.Time) {
+	metrics.Source = deploymentSources(s.sources)
+	metrics.Deployments = s.deployments
+	metrics.FailedDeployments = s.failed
+	if s.deployments > 0 {
+		metrics.ChangeFailureRate = float64(s.failed) / float64(s.deployments)
+	}
+	metrics.MedianLeadTimeHours = median(s.leadTimes)
+	metrics.MedianTimeToRestoreHours = median(s.restores)
+	sort.Slice(s.finishedAt, func(i, j int) bool { return s.finishedAt[i].Before(s.finishedAt[j]) })
+	metrics.DeploymentsPerWeek = ratePerWeek(s.finishedAt, from, to)
+}
+
+// computeDORA computes the DORA metrics of every repository and environment.
+// With a team, it also adds a row per environment pooling the deployments of
+// all the team's repositories.
+func computeDORA(deployments []gitmetrics.Deployment, commits []gitmetrics.Commit, from, to time.Time, team string) []DORAMetrics {
+	sort.SliceStable(deployments, func(i, j int) bool {
+		return deployments[i].FinishedAt.Before(deployments[j].FinishedAt)
+	})
+
+	commitsByRepo := make(map[string][]gitmetrics.Commit)
+	commitDates := make(map[string]time.Time)
+	for _, commit := range commits {
+		repo := gitmetrics.FullName(commit.Owner, commit.RepoName)
+		commitsByRepo[repo] = append(commitsByRepo[repo], commit)
+		commitDates[repo+"@"+commit.CommitID] = commit.CommitDate
+	}
+
+	type streamKey struct{ owner, repo, environment string }
+	streams := make(map[streamKey][]gitmetrics.Deployment)
+	for _, deployment := range deployments {
+		key := streamKey{deployment.Owner, deployment.RepoName, deployment.Environment}
+		streams[key] = append(streams[key], deployment)
+	}
+
+	inWindow := func(t time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+	}
+
+	result := make([]DORAMetrics, 0, len(streams))
+	teamSamples := make(map[string]*doraSamples)
+	for key, stream := range streams {
+		samples := doraSamples{sources: stream}
+		repo := gitmetrics.FullName(key.owner, key.repo)
+
+		var lastDeployed time.Time
+		for i, deployment := range stream {
+			deployedAt, known := commitDates[repo+"@"+deployment.CommitID]
+			counted := inWindow(deployment.FinishedAt)
+
+			if counted {
+				samples.deployments++
+				samples.finishedAt = append(samples.finishedAt, deployment.FinishedAt)
+			}
+
+			if deployment.Status == gitmetrics.DeploymentFailure {
+				if !counted {
+					continue
+				}
+				samples.failed++
+				for _, next := range stream[i+1:] {
+					if next.Status == gitmetrics.DeploymentSuccess {
+						samples.restores = append(samples.restores, next.FinishedAt.Sub(deployment.FinishedAt).Hours())
+						break
+					}
+				}
+				continue
+			}
+
+			if !known {
+				continue
+			}
+			if counted {
+				for _, commit := range commitsByRepo[repo] {
+					if commit.CommitDate.After(deployedAt) {
+						break
+					}
+					if lastDeployed.IsZero() && commit.CommitID != deployment.CommitID {
+						continue
+					}
+					if !lastDeployed.IsZero() && !commit.CommitDate.After(lastDeployed) {
+						continue
+					}
+					samples.leadTimes = append(samples.leadTimes, deployment.FinishedAt.Sub(commit.CommitDate).Hours())
+				}
+			}
+			if deployedAt.After(lastDeployed) {
+				lastDeployed = deployedAt
+			}
+		}
+
+		metrics := DORAMetrics{Owner: key.owner, Repo: key.repo, Environment: key.environment}
+		samples.fill(&metrics, from, to)
+		result = append(result, metrics)
+
+		if team != "" {
+			if teamSamples[key.environment] == nil {
+				teamSamples[key.environment] = &doraSamples{}
+			}
+			teamSamples[key.environment].add(samples)
+		}
+	}
+
+	for environment, samples := range teamSamples {
+		metrics := DORAMetrics{Team: team, Environment: environment}
+		samples.fill(&metrics, from, to)
+		result = append(result, metrics)
+	}
+
+	// Team rows come first, as their repository is empty.
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Repo != result[j].Repo {
+			return result[i].Repo < result[j].Repo
+		}
+		if result[i].Owner != result[j].Owner {
+			return result[i].Owner < result[j].Owner
+		}
+		return result[i].Environment < result[j].Environment
+	})
+	return result
+}
+
+// deploymentSources returns the sources of deployments in order,
+// comma-separated.
+func deploymentSources(deployments []gitmetrics.Deployment) string {
+	seen := make(map[string]bool)
+	var sources []string
+	for _, deployment := range deployments {
+		if !seen[deployment.Source] {
+			seen[deployment.Source] = true
+			sources = append(sources, deployment.Source)
+		}
+	}
+	sort.Strings(sources)
+	return strings.Join(sources, ",")
+}
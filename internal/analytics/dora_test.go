@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestComputeDORA(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC) }
+	commits := []gitmetrics.Commit{
+		{RepoName: "repo1", CommitID: "c1", CommitDate: at(1, 0)},
+		{RepoName: "repo1", CommitID: "c2", CommitDate: at(2, 0)},
+		{RepoName: "repo1", CommitID: "c3", CommitDate: at(3, 0)},
+		{RepoName: "repo1", CommitID: "c4", CommitDate: at(4, 0)},
+	}
+	deployments := []gitmetrics.Deployment{
+		// Baseline before the window: only used to find the commits of the next deployment.
+		{RepoName: "repo1", Environment: "production", CommitID: "c1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(1, 12), Source: "api"},
+		{RepoName: "repo1", Environment: "production", CommitID: "c3", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(3, 12), Source: "api"},
+		{RepoName: "repo1", Environment: "production", CommitID: "c4", Status: gitmetrics.DeploymentFailure, FinishedAt: at(4, 12), Source: "api"},
+		{RepoName: "repo1", Environment: "production", CommitID: "c4", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(4, 18), Source: "api"},
+	}
+
+	metrics := computeDORA(deployments, commits, at(2, 0), at(16, 0), "")
+	assert.Len(t, metrics, 1)
+
+	m := metrics[0]
+	assert.Equal(t, "repo1", m.Repo)
+	assert.Equal(t, "api", m.Source)
+	assert.Equal(t, 3, m.Deployments)
+	assert.Equal(t, 1, m.FailedDeployments)
+	assert.InDelta(t, 1.5, *m.DeploymentsPerWeek, 1e-9)
+	assert.InDelta(t, 1.0/3, m.ChangeFailureRate, 1e-9)
+	// Lead times: c2 and c3 ship at 3/12 (36h, 12h), c4 ships at 4/18 (18h).
+	assert.InDelta(t, 18, m.MedianLeadTimeHours, 1e-9)
+	assert.InDelta(t, 6, m.MedianTimeToRestoreHours, 1e-9)
+}
+
+func TestComputeDORA_UnknownCommitAndUnrestoredFailure(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	deployments := []gitmetrics.Deployment{
+		{RepoName: "repo1", Environment: "production", CommitID: "missing", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(1)},
+		{RepoName: "repo1", Environment: "production", CommitID: "missing", Status: gitmetrics.DeploymentFailure, FinishedAt: at(2)},
+	}
+
+	metrics := computeDORA(deployments, nil, time.Time{}, time.Time{}, "")
+	assert.Equal(t, 2, metrics[0].Deployments)
+	assert.Zero(t, metrics[0].MedianLeadTimeHours)
+	assert.Zero(t, metrics[0].MedianTimeToRestoreHours)
+	assert.Equal(t, 0.5, metrics[0].ChangeFailureRate)
+}
+
+func TestComputeDORA_PerEnvironment(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	deployments := []gitmetrics.Deployment{
+		{RepoName: "repo1", Environment: "staging", CommitID: "c1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(1), Source: "github"},
+		{RepoName: "repo1", Environment: "production", CommitID: "c1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(2), Source: "github"},
+		{RepoName: "repo1", Environment: "staging", CommitID: "c2", Status: gitmetrics.DeploymentFailure, FinishedAt: at(3), Source: "api"},
+	}
+
+	metrics := computeDORA(deployments, nil, time.Time{}, time.Time{}, "")
+
+	// Environments are reported apart rather than summed.
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "production", metrics[0].Environment)
+	assert.Equal(t, 1, metrics[0].Deployments)
+	assert.Equal(t, "github", metrics[0].Source)
+	assert.Equal(t, "staging", metrics[1].Environment)
+	assert.Equal(t, 2, metrics[1].Deployments)
+	assert.Equal(t, 0.5, metrics[1].ChangeFailureRate)
+	assert.Equal(t, "api,github", metrics[1].Source)
+}
+
+func TestComputeDORA_Forks(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	commits := []gitmetrics.Commit{
+		{Owner: "acme", RepoName: "repo1", CommitID: "c1", CommitDate: at(1)},
+		{Owner: "fork", RepoName: "repo1", CommitID: "c1", CommitDate: at(1)},
+		{Owner: "fork", RepoName: "repo1", CommitID: "f1", CommitDate: at(2)},
+	}
+	deployments := []gitmetrics.Deployment{
+		{Owner: "acme", RepoName: "repo1", Environment: "production", CommitID: "c1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(3), Source: "api"},
+		{Owner: "fork", RepoName: "repo1", Environment: "production", CommitID: "f1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(4), Source: "api"},
+	}
+
+	metrics := computeDORA(deployments, commits, time.Time{}, time.Time{}, "")
+
+	// A fork shares its upstream's name and history but deploys on its own.
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "acme", metrics[0].Owner)
+	assert.Equal(t, 1, metrics[0].Deployments)
+	assert.InDelta(t, 48, metrics[0].MedianLeadTimeHours, 1e-9)
+	assert.Equal(t, "fork", metrics[1].Owner)
+	assert.Equal(t, 1, metrics[1].Deployments)
+	assert.InDelta(t, 48, metrics[1].MedianLeadTimeHours, 1e-9)
+}
+
+func TestDORAReports_ReleaseFallback(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	mockNamedCollection(t, db.DeploymentsCollection, []interface{}{
+		gitmetrics.Deployment{RepoName: "repo1", Environment: "production", CommitID: "a1", Status: gitmetrics.DeploymentSuccess, FinishedAt: day(2), Source: "github"},
+	})
+	mockNamedCollection(t, db.ReleasesCollection, []interface{}{
+		gitmetrics.Release{RepoName: "repo1", TagName: "v1", CommitID: "a1", ReleasedAt: day(3)},
+		gitmetrics.Release{RepoName: "repo2", TagName: "v1", CommitID: "b1", ReleasedAt: day(5)},
+	})
+	mockCommitCollection(t, []gitmetrics.Commit{
+		{RepoName: "repo1", CommitID: "a1", CommitDate: day(1)},
+		{RepoName: "repo2", CommitID: "b1", CommitDate: day(4)},
+	})
+
+	metrics, err := DORAReports(context.Background(), Query{}, "")
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	assert.Equal(t, "repo1", metrics[0].Repo)
+	assert.Equal(t, "github", metrics[0].Source)
+	assert.Equal(t, 1, metrics[0].Deployments)
+	assert.InDelta(t, 24, metrics[0].MedianLeadTimeHours, 1e-9)
+
+	assert.Equal(t, "repo2", metrics[1].Repo)
+	assert.Equal(t, ReleaseDeploymentSource, metrics[1].Source)
+	assert.Equal(t, 1, metrics[1].Deployments)
+	assert.InDelta(t, 24, metrics[1].MedianLeadTimeHours, 1e-9)
+}
+
+func TestComputeDORA_TeamAggregate(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	commits := []gitmetrics.Commit{
+		{RepoName: "repo1", CommitID: "a1", CommitDate: at(1)},
+		{RepoName: "repo2", CommitID: "b1", CommitDate: at(1)},
+	}
+	deployments := []gitmetrics.Deployment{
+		{RepoName: "repo1", Environment: "production", CommitID: "a1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(2), Source: "api"},
+		{RepoName: "repo2", Environment: "production", CommitID: "b1", Status: gitmetrics.DeploymentSuccess, FinishedAt: at(5), Source: "github"},
+		{RepoName: "repo2", Environment: "production", CommitID: "b1", Status: gitmetrics.DeploymentFailure, FinishedAt: at(6), Source: "github"},
+	}
+
+	metrics := computeDORA(deployments, commits, at(1), at(15), "platform")
+
+	// The team row pools the deployments of both repositories.
+	assert.Len(t, metrics, 3)
+	team := metrics[0]
+	assert.Equal(t, "platform", team.Team)
+	assert.Empty(t, team.Repo)
+	assert.Equal(t, "production", team.Environment)
+	assert.Equal(t, "api,github", team.Source)
+	assert.Equal(t, 3, team.Deployments)
+	assert.Equal(t, 1, team.FailedDeployments)
+	assert.InDelta(t, 1.5, *team.DeploymentsPerWeek, 1e-9)
+	// Lead times: a1 ships after 24h, b1 after 96h.
+	assert.InDelta(t, 60, team.MedianLeadTimeHours, 1e-9)
+	assert.Equal(t, []string{"repo1", "repo2"}, []string{metrics[1].Repo, metrics[2].Repo})
+}
+
+func TestDORAReports_EnvironmentSkipsReleaseFallback(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	mockNamedCollection(t, db.DeploymentsCollection, []interface{}{
+		gitmetrics.Deployment{RepoName: "repo1", Environment: "production", CommitID: "a1", Status: gitmetrics.DeploymentSuccess, FinishedAt: day(2), Source: "github"},
+	})
+	releaseCollection := mockNamedCollection(t, db.ReleasesCollection, []interface{}{
+		gitmetrics.Release{RepoName: "repo2", TagName: "v1", CommitID: "b1", ReleasedAt: day(5)},
+	})
+	mockCommitCollection(t, []gitmetrics.Commit{{RepoName: "repo1", CommitID: "a1", CommitDate: day(1)}})
+
+	metrics, err := DORAReports(context.Background(), Query{}, "production")
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "production", metrics[0].Environment)
+	releaseCollection.AssertNotCalled(t, "Find", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Default working hours, as hours of the day in the heatmap's timezone.
+const (
+	DefaultWorkStart = 9
+	DefaultWorkEnd   = 18
+)
+
+// HeatmapOptions controls how commits are grouped and which timezone and
+// working hours they are read in. Working hours run from WorkStart up to but
+// excluding WorkEnd. Teams are the teams to group by when grouping by team.
+type HeatmapOptions struct {
+	GroupBy   string
+	Location  *time.Location
+	WorkStart int
+	WorkEnd   int
+	Teams     []teams.Team
+}
+
+// Heatmaps computes a day-of-week by hour-of-day heatmap of the commits
+// matching the query for every author, repository or team, busiest first.
+func Heatmaps(ctx context.Context, q Query, opts HeatmapOptions) ([]Heatmap, error) {
+	if opts.GroupBy == "" {
+		opts.GroupBy = GroupByAuthor
+	}
+	if opts.GroupBy != GroupByAuthor && opts.GroupBy != GroupByRepo && opts.GroupBy != GroupByTeam {
+		return nil, fmt.Errorf("unknown heatmap grouping %q, expected author, repo or team", opts.GroupBy)
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.WorkStart == 0 && opts.WorkEnd == 0 {
+		opts.WorkStart, opts.WorkEnd = DefaultWorkStart, DefaultWorkEnd
+	}
+	if opts.WorkStart < 0 || opts.WorkEnd > 24 || opts.WorkStart >= opts.WorkEnd {
+		return nil, fmt.Errorf("invalid working hours %d-%d", opts.WorkStart, opts.WorkEnd)
+	}
+
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return computeHeatmaps(commits, opts), nil
+}
+
+func computeHeatmaps(commits []gitmetrics.Commit, opts HeatmapOptions) []Heatmap {
+	heatmaps := make(map[string]*Heatmap)
+	for _, commit := range commits {
+		local := commit.CommitDate.In(opts.Location)
+		day := (int(local.Weekday()) + 6) % 7
+		hour := local.Hour()
+		weekend := local.Weekday() == time.Saturday || local.Weekday() == time.Sunday
+		offHours := !weekend && (hour < opts.WorkStart || hour >= opts.WorkEnd)
+
+		for _, key := range groupKeys(commit, opts.GroupBy, opts.Teams) {
+			heatmap, ok := heatmaps[key]
+			if !ok {
+				heatmap = &Heatmap{Key: key, Timezone: opts.Location.String()}
+				heatmaps[key] = heatmap
+			}
+			heatmap.Cells[day][hour]++
+			heatmap.Commits++
+			if weekend {
+				heatmap.WeekendCommits++
+			}
+			if offHours {
+				heatmap.OffHoursCommits++
+			}
+		}
+	}
+
+	result := make([]Heatmap, 0, len(heatmaps))
+	for _, heatmap := range heatmaps {
+		heatmap.OffHoursRatio = float64(heatmap.OffHoursCommits) / float64(heatmap.Commits)
+		heatmap.WeekendRatio = float64(heatmap.WeekendCommits) / float64(heatmap.Commits)
+		result = append(result, *heatmap)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+)
+
+func heatmapCommits() []gitmetrics.Commit {
+	at := func(day, hour int) time.Time { return time.Date(2024, 1, day, hour, 30, 0, 0, time.UTC) }
+	// 2024-01-01 is a Monday.
+	return []gitmetrics.Commit{
+		{CommitID: "a1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: at(1, 14)},
+		{CommitID: "a2", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: at(1, 23)},
+		{CommitID: "a3", Owner: "acme", RepoName: "repo2", CommittedBy: "alice", CommitDate: at(6, 10)},
+		{CommitID: "a4", Owner: "acme", RepoName: "repo2", CommittedBy: "alice", CommitDate: at(2, 9)},
+		{CommitID: "b1", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", CommitDate: at(3, 16)},
+	}
+}
+
+func TestComputeHeatmaps_UTC(t *testing.T) {
+	heatmaps := computeHeatmaps(heatmapCommits(), HeatmapOptions{GroupBy: GroupByAuthor, Location: time.UTC, WorkStart: 9, WorkEnd: 18})
+
+	assert.Len(t, heatmaps, 2)
+	alice := heatmaps[0]
+	assert.Equal(t, "alice", alice.Key)
+	assert.Equal(t, "UTC", alice.Timezone)
+	assert.Equal(t, 4, alice.Commits)
+	assert.Equal(t, 1, alice.Cells[0][14])
+	assert.Equal(t, 1, alice.Cells[0][23])
+	assert.Equal(t, 1, alice.Cells[1][9])
+	assert.Equal(t, 1, alice.Cells[5][10])
+	assert.Equal(t, 1, alice.OffHoursCommits)
+	assert.Equal(t, 1, alice.WeekendCommits)
+	assert.Equal(t, 0.25, alice.OffHoursRatio)
+	assert.Equal(t, 0.25, alice.WeekendRatio)
+
+	assert.Equal(t, "bob", heatmaps[1].Key)
+	assert.Equal(t, 0.0, heatmaps[1].OffHoursRatio)
+}
+
+func TestComputeHeatmaps_Timezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	heatmaps := computeHeatmaps(heatmapCommits(), HeatmapOptions{GroupBy: GroupByRepo, Location: tokyo, WorkStart: 9, WorkEnd: 18})
+
+	repo1 := heatmaps[0]
+	assert.Equal(t, "acme/repo1", repo1.Key)
+	assert.Equal(t, "Asia/Tokyo", repo1.Timezone)
+	// Monday 23:30 UTC is Tuesday 08:30 in Tokyo.
+	assert.Equal(t, 1, repo1.Cells[1][8])
+	// The other two are Monday 23:30 and Thursday 01:30 in Tokyo.
+	assert.Equal(t, 3, repo1.OffHoursCommits)
+
+	repo2 := heatmaps[1]
+	// Saturday 10:30 UTC is Saturday 19:30 in Tokyo.
+	assert.Equal(t, 1, repo2.WeekendCommits)
+	assert.Equal(t, 1, repo2.Cells[5][19])
+}
+
+func TestComputeHeatmaps_Forks(t *testing.T) {
+	heatmaps := computeHeatmaps(withFork(heatmapCommits()), HeatmapOptions{GroupBy: GroupByRepo, Location: time.UTC, WorkStart: 9, WorkEnd: 18})
+	single := computeHeatmaps(heatmapCommits(), HeatmapOptions{GroupBy: GroupByRepo, Location: time.UTC, WorkStart: 9, WorkEnd: 18})
+
+	assert.Len(t, heatmaps, 2*len(single))
+	for _, heatmap := range heatmaps {
+		if heatmap.Key == "fork/repo1" {
+			assert.Equal(t, single[0].Commits, heatmap.Commits)
+		}
+	}
+}
+
+func TestComputeHeatmaps_ByTeam(t *testing.T) {
+	opts := HeatmapOptions{GroupBy: GroupByTeam, Location: time.UTC, WorkStart: 9, WorkEnd: 18, Teams: []teams.Team{{Name: "web", Members: []string{"bob"}}}}
+	heatmaps := computeHeatmaps(heatmapCommits(), opts)
+
+	assert.Len(t, heatmaps, 1)
+	assert.Equal(t, "web", heatmaps[0].Key)
+	assert.Equal(t, 1, heatmaps[0].Commits)
+}
+
+func TestHeatmaps_Defaults(t *testing.T) {
+	mockCommitCollection(t, heatmapCommits())
+
+	heatmaps, err := Heatmaps(context.Background(), Query{}, HeatmapOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", heatmaps[0].Key)
+	assert.Equal(t, "UTC", heatmaps[0].Timezone)
+	assert.Equal(t, 1, heatmaps[0].OffHoursCommits)
+}
+
+func TestHeatmaps_InvalidOptions(t *testing.T) {
+	_, err := Heatmaps(context.Background(), Query{}, HeatmapOptions{GroupBy: "file"})
+	assert.ErrorContains(t, err, "unknown heatmap grouping")
+
+	_, err = Heatmaps(context.Background(), Query{}, HeatmapOptions{WorkStart: 18, WorkEnd: 9})
+	assert.ErrorContains(t, err, "invalid working hours")
+}
@@ -0,0 +1,382 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// File categories.
+const (
+	CategorySource    = "source"
+	CategoryTest      = "test"
+	CategoryDocs      = "docs"
+	CategoryConfig    = "config"
+	CategoryGenerated = "generated"
+)
+
+// LanguageOther is the language of files no rule recognises.
+const LanguageOther = "Other"
+
+// FileClass is the language and category of a file. Vendored files are
+// third-party code committed to the repository; they count as generated
+// because nobody on the team wrote them.
+type FileClass struct {
+	Language string
+	Category string
+	Vendored bool
+}
+
+// languagesByExtension maps lower-case file extensions to languages.
+var languagesByExtension = map[string]string{
+	".go":       "Go",
+	".ts":       "TypeScript",
+	".tsx":      "TypeScript",
+	".mts":      "TypeScript",
+	".js":       "JavaScript",
+	".jsx":      "JavaScript",
+	".mjs":      "JavaScript",
+	".cjs":      "JavaScript",
+	".py":       "Python",
+	".rb":       "Ruby",
+	".java":     "Java",
+	".kt":       "Kotlin",
+	".kts":      "Kotlin",
+	".scala":    "Scala",
+	".rs":       "Rust",
+	".c":        "C",
+	".h":        "C",
+	".cc":       "C++",
+	".cpp":      "C++",
+	".cxx":      "C++",
+	".hpp":      "C++",
+	".cs":       "C#",
+	".swift":    "Swift",
+	".m":        "Objective-C",
+	".php":      "PHP",
+	".sh":       "Shell",
+	".bash":     "Shell",
+	".zsh":      "Shell",
+	".ps1":      "PowerShell",
+	".sql":      "SQL",
+	".html":     "HTML",
+	".htm":      "HTML",
+	".css":      "CSS",
+	".scss":     "SCSS",
+	".sass":     "Sass",
+	".less":     "Less",
+	".vue":      "Vue",
+	".svelte":   "Svelte",
+	".dart":     "Dart",
+	".lua":      "Lua",
+	".r":        "R",
+	".ex":       "Elixir",
+	".exs":      "Elixir",
+	".erl":      "Erlang",
+	".hs":       "Haskell",
+	".clj":      "Clojure",
+	".proto":    "Protocol Buffer",
+	".graphql":  "GraphQL",
+	".gql":      "GraphQL",
+	".tf":       "HCL",
+	".hcl":      "HCL",
+	".yaml":     "YAML",
+	".yml":      "YAML",
+	".json":     "JSON",
+	".toml":     "TOML",
+	".ini":      "INI",
+	".cfg":      "INI",
+	".xml":      "XML",
+	".env":      "Dotenv",
+	".md":       "Markdown",
+	".markdown": "Markdown",
+	".rst":      "reStructuredText",
+	".adoc":     "AsciiDoc",
+	".txt":      "Text",
+}
+
+// languagesByFilename maps lower-case file names that have no telling
+// extension to languages.
+var languagesByFilename = map[string]string{
+	"dockerfile":    "Dockerfile",
+	"makefile":      "Makefile",
+	"go.mod":        "Go Module",
+	"go.sum":        "Go Checksums",
+	"gemfile":       "Ruby",
+	"rakefile":      "Ruby",
+	"jenkinsfile":   "Groovy",
+	".gitignore":    "Ignore List",
+	".dockerignore": "Ignore List",
+	".editorconfig": "EditorConfig",
+	"license":       "Text",
+	"codeowners":    "CODEOWNERS",
+}
+
+// configLanguages are the languages whose files configure rather than
+// implement or document the project.
+var configLanguages = map[string]bool{
+	"YAML": true, "JSON": true, "TOML": true, "INI": true, "XML": true, "Dotenv": true,
+	"HCL": true, "Dockerfile": true, "Makefile": true, "Go Module": true,
+	"Ignore List": true, "EditorConfig": true, "CODEOWNERS": true,
+}
+
+// docsLanguages are the languages of prose.
+var docsLanguages = map[string]bool{
+	"Markdown": true, "reStructuredText": true, "AsciiDoc": true, "Text": true,
+}
+
+// vendoredDirs are directories holding third-party code.
+var vendoredDirs = map[string]bool{
+	"vendor": true, "node_modules": true, "third_party": true, "bower_components": true,
+}
+
+// generatedDirs are directories holding build output.
+var generatedDirs = map[string]bool{
+	"dist": true, "build": true, "out": true, "target": true, "coverage": true,
+}
+
+// generatedFiles are lock files and checksums written by package managers.
+var generatedFiles = map[string]bool{
+	"go.sum": true, "package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true,
+	"cargo.lock": true, "gemfile.lock": true, "poetry.lock": true, "composer.lock": true,
+}
+
+// generatedSuffixes are the name endings code generators conventionally use.
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_generated.go", ".gen.go", "_gen.go",
+	"_pb2.py", "_pb2_grpc.py", ".pb.ts", ".generated.ts",
+	".min.js", ".min.css", ".map", ".snap",
+}
+
+// testDirs are directories holding tests and their fixtures.
+var testDirs = map[string]bool{
+	"test": true, "tests": true, "__tests__": true, "spec": true, "testdata": true,
+	"e2e": true, "__mocks__": true, "fixtures": true,
+}
+
+// testPatterns are the configured extra patterns of test files.
+var testPatterns []string
+
+// SetTestPatterns adds glob patterns of test files to the naming conventions
+// ClassifyFile knows. A pattern without a slash matches file names, e.g.
+// "*_integration.go"; one ending in a slash matches a directory anywhere in
+// the path, e.g. "qa/"; any other pattern matches whole paths, e.g.
+// "e2e/*/*.ts". Matching ignores case.
+func SetTestPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("invalid test pattern %q: %w", pattern, err)
+		}
+	}
+	testPatterns = patterns
+	return nil
+}
+
+// matchesTestPattern reports whether a lower-case path matches one of the
+// configured test patterns.
+func matchesTestPattern(lower string) bool {
+	for _, pattern := range testPatterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case strings.HasSuffix(pattern, "/"):
+			dir := strings.TrimSuffix(pattern, "/")
+			for _, part := range strings.Split(path.Dir(lower), "/") {
+				if ok, _ := path.Match(dir, part); ok {
+					return true
+				}
+			}
+		case strings.Contains(pattern, "/"):
+			if ok, _ := path.Match(pattern, lower); ok {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(pattern, path.Base(lower)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// docsDirs are directories holding documentation.
+var docsDirs = map[string]bool{"docs": true, "doc": true, "documentation": true}
+
+// ClassifyFile returns the language and category of a file from its path,
+// in the spirit of GitHub's linguist: vendored and generated files first,
+// then tests, documentation and configuration, and source code otherwise.
+func ClassifyFile(filename string) FileClass {
+	class := FileClass{Language: fileLanguage(filename)}
+	lower := strings.ToLower(filename)
+	base := path.Base(lower)
+	dirs := strings.Split(path.Dir(lower), "/")
+
+	inDir := func(set map[string]bool) bool {
+		for _, dir := range dirs {
+			if set[dir] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case inDir(vendoredDirs):
+		class.Category, class.Vendored = CategoryGenerated, true
+	case generatedFiles[base] || inDir(generatedDirs) || hasAnySuffix(base, generatedSuffixes):
+		class.Category = CategoryGenerated
+	case isTestFile(base) || inDir(testDirs) || matchesTestPattern(lower):
+		class.Category = CategoryTest
+	case docsLanguages[class.Language] || inDir(docsDirs):
+		class.Category = CategoryDocs
+	case configLanguages[class.Language] || strings.HasPrefix(base, ".") || strings.HasPrefix(lower, ".github/"):
+		class.Category = CategoryConfig
+	default:
+		class.Category = CategorySource
+	}
+	return class
+}
+
+func fileLanguage(filename string) string {
+	base := strings.ToLower(path.Base(filename))
+	if language, ok := languagesByFilename[base]; ok {
+		return language
+	}
+	if strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return "Dockerfile"
+	}
+	if strings.HasPrefix(base, "readme") || strings.HasPrefix(base, "changelog") {
+		if language, ok := languagesByExtension[path.Ext(base)]; ok {
+			return language
+		}
+		return "Text"
+	}
+	if language, ok := languagesByExtension[path.Ext(base)]; ok {
+		return language
+	}
+	return LanguageOther
+}
+
+// isTestFile reports whether a lower-case file name follows the test naming
+// convention of its language.
+func isTestFile(base string) bool {
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	return strings.HasSuffix(base, "_test.go") ||
+		strings.HasSuffix(stem, ".test") || strings.HasSuffix(stem, ".spec") ||
+		strings.HasSuffix(stem, "_test") || strings.HasSuffix(stem, "_spec") ||
+		(strings.HasPrefix(stem, "test_") && path.Ext(base) == ".py") ||
+		(strings.HasSuffix(stem, "test") && (path.Ext(base) == ".java" || path.Ext(base) == ".kt" || path.Ext(base) == ".cs"))
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageOptions selects how language breakdowns are grouped. Teams are the
+// teams to group by when grouping by team.
+type LanguageOptions struct {
+	GroupBy string
+	Teams   []teams.Team
+}
+
+// LanguageBreakdowns classifies the files changed by the commits matching the
+// query and sums their lines per language and per category, for each commit,
+// repository, author or team. Commits stored without per-file changes are
+// left out.
+func LanguageBreakdowns(ctx context.Context, q Query, opts LanguageOptions) ([]LanguageBreakdown, error) {
+	switch opts.GroupBy {
+	case "":
+		opts.GroupBy = GroupByRepo
+	case GroupByCommit, GroupByAuthor, GroupByRepo, GroupByTeam:
+	default:
+		return nil, fmt.Errorf("unknown language grouping %q, expected commit, repo, author or team", opts.GroupBy)
+	}
+
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return computeLanguageBreakdowns(commits, opts), nil
+}
+
+func computeLanguageBreakdowns(commits []gitmetrics.Commit, opts LanguageOptions) []LanguageBreakdown {
+	type totals struct {
+		breakdown  *LanguageBreakdown
+		languages  map[string]*ClassLines
+		categories map[string]*ClassLines
+	}
+	add := func(lines map[string]*ClassLines, name string, change gitmetrics.FileChange) {
+		entry, ok := lines[name]
+		if !ok {
+			entry = &ClassLines{Name: name}
+			lines[name] = entry
+		}
+		entry.Files++
+		entry.LinesAdded += change.Additions
+		entry.LinesDeleted += change.Deletions
+	}
+
+	groups := make(map[string]*totals)
+	for _, commit := range commits {
+		if len(commit.Files) == 0 {
+			continue
+		}
+		// A commit shared by a fork and its upstream is a commit of each.
+		keys := []string{gitmetrics.FullName(commit.Owner, commit.RepoName) + "@" + commit.CommitID}
+		if opts.GroupBy != GroupByCommit {
+			keys = groupKeys(commit, opts.GroupBy, opts.Teams)
+		}
+		for _, key := range keys {
+			group, ok := groups[key]
+			if !ok {
+				group = &totals{
+					breakdown:  &LanguageBreakdown{Key: key},
+					languages:  make(map[string]*ClassLines),
+					categories: make(map[string]*ClassLines),
+				}
+				groups[key] = group
+			}
+			group.breakdown.Commits++
+			for _, change := range commit.Files {
+				class := ClassifyFile(change.Filename)
+				group.breakdown.LinesAdded += change.Additions
+				group.breakdown.LinesDeleted += change.Deletions
+				add(group.languages, class.Language, change)
+				add(group.categories, class.Category, change)
+			}
+		}
+	}
+
+	sorted := func(lines map[string]*ClassLines) []ClassLines {
+		result := make([]ClassLines, 0, len(lines))
+		for _, entry := range lines {
+			result = append(result, *entry)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			a, b := result[i], result[j]
+			if a.LinesAdded+a.LinesDeleted != b.LinesAdded+b.LinesDeleted {
+				return a.LinesAdded+a.LinesDeleted > b.LinesAdded+b.LinesDeleted
+			}
+			return a.Name < b.Name
+		})
+		return result
+	}
+
+	result := make([]LanguageBreakdown, 0, len(groups))
+	for _, group := range groups {
+		group.breakdown.Languages = sorted(group.languages)
+		group.breakdown.Categories = sorted(group.categories)
+		result = append(result, *group.breakdown)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyFile(t *testing.T) {
+	for filename, expected := range map[string]FileClass{
+		"main.go":                           {Language: "Go", Category: CategorySource},
+		"internal/db/mongodb_test.go":       {Language: "Go", Category: CategoryTest},
+		"web/src/App.tsx":                   {Language: "TypeScript", Category: CategorySource},
+		"web/src/App.test.tsx":              {Language: "TypeScript", Category: CategoryTest},
+		"web/src/__tests__/util.ts":         {Language: "TypeScript", Category: CategoryTest},
+		"tests/test_parser.py":              {Language: "Python", Category: CategoryTest},
+		"src/main/java/FooTest.java":        {Language: "Java", Category: CategoryTest},
+		"README.md":                         {Language: "Markdown", Category: CategoryDocs},
+		"docs/architecture.png":             {Language: LanguageOther, Category: CategoryDocs},
+		"LICENSE":                           {Language: "Text", Category: CategoryDocs},
+		"deploy/values.yaml":                {Language: "YAML", Category: CategoryConfig},
+		".github/workflows/ci.yml":          {Language: "YAML", Category: CategoryConfig},
+		"Dockerfile":                        {Language: "Dockerfile", Category: CategoryConfig},
+		"go.mod":                            {Language: "Go Module", Category: CategoryConfig},
+		".eslintrc":                         {Language: LanguageOther, Category: CategoryConfig},
+		"go.sum":                            {Language: "Go Checksums", Category: CategoryGenerated},
+		"package-lock.json":                 {Language: "JSON", Category: CategoryGenerated},
+		"api/v1/service.pb.go":              {Language: "Go", Category: CategoryGenerated},
+		"static/app.min.js":                 {Language: "JavaScript", Category: CategoryGenerated},
+		"vendor/github.com/pkg/errors/x.go": {Language: "Go", Category: CategoryGenerated, Vendored: true},
+		"web/node_modules/react/index.js":   {Language: "JavaScript", Category: CategoryGenerated, Vendored: true},
+	} {
+		assert.Equal(t, expected, ClassifyFile(filename), filename)
+	}
+}
+
+func languageCommits() []gitmetrics.Commit {
+	return []gitmetrics.Commit{
+		{CommitID: "c1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", Files: []gitmetrics.FileChange{
+			{Filename: "main.go", Additions: 10, Deletions: 2},
+			{Filename: "main_test.go", Additions: 20},
+			{Filename: "config.yaml", Additions: 3, Deletions: 3},
+		}},
+		{CommitID: "c2", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", Files: []gitmetrics.FileChange{
+			{Filename: "server.go", Additions: 5},
+			{Filename: "README.md", Additions: 1},
+		}},
+		// Stored without per-file changes.
+		{CommitID: "c3", Owner: "acme", RepoName: "repo2", CommittedBy: "bob", LinesAdded: 100},
+	}
+}
+
+func TestComputeLanguageBreakdowns_ByRepo(t *testing.T) {
+	breakdowns := computeLanguageBreakdowns(languageCommits(), LanguageOptions{GroupBy: GroupByRepo})
+
+	assert.Equal(t, []LanguageBreakdown{{
+		Key: "acme/repo1", Commits: 2, LinesAdded: 39, LinesDeleted: 5,
+		Languages: []ClassLines{
+			{Name: "Go", Files: 3, LinesAdded: 35, LinesDeleted: 2},
+			{Name: "YAML", Files: 1, LinesAdded: 3, LinesDeleted: 3},
+			{Name: "Markdown", Files: 1, LinesAdded: 1},
+		},
+		Categories: []ClassLines{
+			{Name: CategoryTest, Files: 1, LinesAdded: 20},
+			{Name: CategorySource, Files: 2, LinesAdded: 15, LinesDeleted: 2},
+			{Name: CategoryConfig, Files: 1, LinesAdded: 3, LinesDeleted: 3},
+			{Name: CategoryDocs, Files: 1, LinesAdded: 1},
+		},
+	}}, breakdowns)
+}
+
+func TestComputeLanguageBreakdowns_ByCommit(t *testing.T) {
+	breakdowns := computeLanguageBreakdowns(languageCommits(), LanguageOptions{GroupBy: GroupByCommit})
+
+	assert.Len(t, breakdowns, 2)
+	assert.Equal(t, "acme/repo1@c1", breakdowns[0].Key)
+	assert.Equal(t, "acme/repo1@c2", breakdowns[1].Key)
+	assert.Equal(t, 6, breakdowns[1].LinesAdded)
+}
+
+func TestComputeLanguageBreakdowns_Forks(t *testing.T) {
+	breakdowns := computeLanguageBreakdowns(withFork(languageCommits()), LanguageOptions{GroupBy: GroupByRepo})
+
+	assert.Len(t, breakdowns, 2)
+	assert.ElementsMatch(t, []string{"acme/repo1", "fork/repo1"}, []string{breakdowns[0].Key, breakdowns[1].Key})
+	assert.Equal(t, 2, breakdowns[1].Commits)
+
+	breakdowns = computeLanguageBreakdowns(withFork(languageCommits()), LanguageOptions{GroupBy: GroupByCommit})
+	assert.Len(t, breakdowns, 4)
+}
+
+func TestLanguageBreakdowns(t *testing.T) {
+	mockCommitCollection(t, languageCommits())
+
+	breakdowns, err := LanguageBreakdowns(context.Background(), Query{}, LanguageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/repo1", breakdowns[0].Key)
+
+	_, err = LanguageBreakdowns(context.Background(), Query{}, LanguageOptions{GroupBy: GroupByFile})
+	assert.ErrorContains(t, err, "unknown language grouping")
+}
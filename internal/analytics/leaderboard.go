@@ -0,0 +1,193 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Leaderboard metrics.
+const (
+	MetricCommits    = "commits"
+	MetricLines      = "lines"
+	MetricFiles      = "files"
+	MetricActiveDays = "active_days"
+)
+
+// LeaderboardOptions selects what a leaderboard ranks and by what. Teams are
+// the teams to rank when grouping by team.
+type LeaderboardOptions struct {
+	Metric  string
+	GroupBy string
+	Teams   []teams.Team
+}
+
+// contribution accumulates the activity of one leaderboard key.
+type contribution struct {
+	commits int
+	lines   int
+	files   map[string]bool
+	days    map[time.Time]bool
+	// filesWithoutDetails counts file changes of commits stored without
+	// per-file data, which can't be deduplicated.
+	filesWithoutDetails int
+}
+
+func (c *contribution) value(metric string) int {
+	switch metric {
+	case MetricLines:
+		return c.lines
+	case MetricFiles:
+		return len(c.files) + c.filesWithoutDetails
+	case MetricActiveDays:
+		return len(c.days)
+	}
+	return c.commits
+}
+
+// RankLeaderboard ranks authors, repositories or teams by commits, lines changed,
+// distinct files touched or active days over the query's window. When the
+// window has both ends, every entry is compared with the window of the same
+// length just before it.
+func RankLeaderboard(ctx context.Context, q Query, opts LeaderboardOptions) (Leaderboard, error) {
+	parsed, err := ParseLeaderboardOptions(opts.Metric, opts.GroupBy)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	parsed.Teams = opts.Teams
+	opts = parsed
+
+	load := q
+	var previous *Query
+	if !q.From.IsZero() && !q.To.IsZero() {
+		window := q
+		window.From, window.To = q.From.Add(-q.To.Sub(q.From)), q.From
+		previous = &window
+		load.From = previous.From
+	}
+
+	commits, err := LoadCommits(ctx, load)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+
+	return computeLeaderboard(commits, q, previous, opts), nil
+}
+
+// ParseLeaderboardOptions validates a metric and grouping, defaulting to
+// commits per author.
+func ParseLeaderboardOptions(metric, groupBy string) (LeaderboardOptions, error) {
+	opts := LeaderboardOptions{Metric: metric, GroupBy: groupBy}
+	if opts.Metric == "" {
+		opts.Metric = MetricCommits
+	}
+	if opts.GroupBy == "" {
+		opts.GroupBy = GroupByAuthor
+	}
+
+	switch opts.Metric {
+	case MetricCommits, MetricLines, MetricFiles, MetricActiveDays:
+	default:
+		return opts, fmt.Errorf("unknown leaderboard metric %q, expected commits, lines, files or active_days", opts.Metric)
+	}
+	switch opts.GroupBy {
+	case GroupByAuthor, GroupByRepo, GroupByTeam:
+	default:
+		return opts, fmt.Errorf("unknown leaderboard grouping %q, expected author, repo or team", opts.GroupBy)
+	}
+	return opts, nil
+}
+
+func computeLeaderboard(commits []gitmetrics.Commit, q Query, previous *Query, opts LeaderboardOptions) Leaderboard {
+	board := Leaderboard{Metric: opts.Metric, GroupBy: opts.GroupBy, From: q.From, To: q.To, Entries: []LeaderboardEntry{}}
+
+	current := rankContributions(contributions(commits, q, opts), opts.Metric)
+	var before map[string]LeaderboardEntry
+	if previous != nil {
+		board.PreviousFrom, board.PreviousTo = &previous.From, &previous.To
+		before = make(map[string]LeaderboardEntry)
+		for _, entry := range rankContributions(contributions(commits, *previous, opts), opts.Metric) {
+			before[entry.Key] = entry
+		}
+	}
+
+	for _, entry := range current {
+		if prev, ok := before[entry.Key]; ok {
+			entry.PreviousValue = prev.Value
+			entry.PreviousRank = prev.Rank
+		}
+		entry.Delta = entry.Value - entry.PreviousValue
+		board.Entries = append(board.Entries, entry)
+	}
+
+	return board
+}
+
+func contributions(commits []gitmetrics.Commit, q Query, opts LeaderboardOptions) map[string]*contribution {
+	byKey := make(map[string]*contribution)
+	for _, commit := range commits {
+		if (!q.From.IsZero() && commit.CommitDate.Before(q.From)) || (!q.To.IsZero() && !commit.CommitDate.Before(q.To)) {
+			continue
+		}
+
+		for _, key := range groupKeys(commit, opts.GroupBy, opts.Teams) {
+			c, ok := byKey[key]
+			if !ok {
+				c = &contribution{files: make(map[string]bool), days: make(map[time.Time]bool)}
+				byKey[key] = c
+			}
+
+			c.commits++
+			c.lines += commit.LinesAdded + commit.LinesDeleted
+			c.days[gitmetrics.RollupDay(commit.CommitDate)] = true
+			if len(commit.Files) == 0 {
+				c.filesWithoutDetails += commit.FilesAdded + commit.FilesDeleted + commit.FilesUpdated
+			}
+			for _, file := range commit.Files {
+				c.files[gitmetrics.FullName(commit.Owner, commit.RepoName)+"/"+file.Filename] = true
+			}
+		}
+	}
+	return byKey
+}
+
+// rankContributions orders contributions by the metric, highest first, using
+// competition ranking so tied entries share a rank and the next rank is
+// skipped.
+func rankContributions(byKey map[string]*contribution, metric string) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(byKey))
+	for key, c := range byKey {
+		entries = append(entries, LeaderboardEntry{
+			Key:          key,
+			Value:        c.value(metric),
+			Commits:      c.commits,
+			Lines:        c.lines,
+			FilesTouched: c.value(MetricFiles),
+			ActiveDays:   len(c.days),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Key < entries[j].Key
+	})
+
+	for i := range entries {
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+		// Entries are sorted descending, so everything from the first entry
+		// with the same value onwards is at most this value.
+		entries[i].Percentile = 100 * float64(len(entries)-entries[i].Rank+1) / float64(len(entries))
+	}
+
+	return entries
+}
@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func leaderboardCommits() []gitmetrics.Commit {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 10, 0, 0, 0, time.UTC) }
+	return []gitmetrics.Commit{
+		// Previous window: 2024-01-01 to 2024-01-08.
+		{CommitID: "p1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: day(2), LinesAdded: 5},
+		{CommitID: "p2", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", CommitDate: day(3), LinesAdded: 5},
+		{CommitID: "p3", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", CommitDate: day(4), LinesAdded: 5},
+		// Current window: 2024-01-08 to 2024-01-15.
+		{CommitID: "c1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: day(8), LinesAdded: 10, Files: []gitmetrics.FileChange{{Filename: "a.go"}, {Filename: "b.go"}}},
+		{CommitID: "c2", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", CommitDate: day(8), LinesAdded: 5, LinesDeleted: 5, Files: []gitmetrics.FileChange{{Filename: "a.go"}}},
+		{CommitID: "c3", Owner: "acme", RepoName: "repo2", CommittedBy: "alice", CommitDate: day(9), LinesAdded: 1, FilesUpdated: 3},
+		{CommitID: "c4", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", CommitDate: day(10), LinesAdded: 30},
+		{CommitID: "c5", Owner: "acme", RepoName: "repo2", CommittedBy: "bob", CommitDate: day(11), LinesAdded: 1},
+		{CommitID: "c6", Owner: "acme", RepoName: "repo2", CommittedBy: "carol", CommitDate: day(12), LinesAdded: 2},
+	}
+}
+
+func TestComputeLeaderboard_CommitsWithPreviousPeriod(t *testing.T) {
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	previous := &Query{From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: from}
+
+	board := computeLeaderboard(leaderboardCommits(), Query{From: from, To: to}, previous, LeaderboardOptions{Metric: MetricCommits, GroupBy: GroupByAuthor})
+
+	assert.Equal(t, previous.From, *board.PreviousFrom)
+	assert.Equal(t, []LeaderboardEntry{
+		{Rank: 1, Key: "alice", Value: 3, Percentile: 100, Commits: 3, Lines: 21, FilesTouched: 5, ActiveDays: 2, PreviousValue: 1, PreviousRank: 2, Delta: 2},
+		{Rank: 2, Key: "bob", Value: 2, Percentile: 200.0 / 3, Commits: 2, Lines: 31, FilesTouched: 0, ActiveDays: 2, PreviousValue: 2, PreviousRank: 1, Delta: 0},
+		{Rank: 3, Key: "carol", Value: 1, Percentile: 100.0 / 3, Commits: 1, Lines: 2, ActiveDays: 1, Delta: 1},
+	}, board.Entries)
+}
+
+func TestComputeLeaderboard_Ties(t *testing.T) {
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	board := computeLeaderboard(leaderboardCommits(), Query{From: from}, nil, LeaderboardOptions{Metric: MetricActiveDays, GroupBy: GroupByAuthor})
+
+	assert.Nil(t, board.PreviousFrom)
+	assert.Len(t, board.Entries, 3)
+	assert.Equal(t, 1, board.Entries[0].Rank)
+	assert.Equal(t, 1, board.Entries[1].Rank)
+	assert.Equal(t, 100.0, board.Entries[1].Percentile)
+	assert.Equal(t, 3, board.Entries[2].Rank)
+	assert.Equal(t, "carol", board.Entries[2].Key)
+}
+
+func TestComputeLeaderboard_ByRepo(t *testing.T) {
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	board := computeLeaderboard(leaderboardCommits(), Query{From: from}, nil, LeaderboardOptions{Metric: MetricLines, GroupBy: GroupByRepo})
+
+	assert.Equal(t, "acme/repo1", board.Entries[0].Key)
+	assert.Equal(t, 50, board.Entries[0].Value)
+	assert.Equal(t, "acme/repo2", board.Entries[1].Key)
+	assert.Equal(t, 4, board.Entries[1].Value)
+}
+
+func TestComputeLeaderboard_ByRepoWithFork(t *testing.T) {
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	board := computeLeaderboard(withFork(leaderboardCommits()), Query{From: from}, nil, LeaderboardOptions{Metric: MetricLines, GroupBy: GroupByRepo})
+
+	assert.Len(t, board.Entries, 4)
+	assert.Equal(t, []string{"acme/repo1", "fork/repo1"}, []string{board.Entries[0].Key, board.Entries[1].Key})
+	assert.Equal(t, 50, board.Entries[1].Value)
+}
+
+func TestComputeLeaderboard_ByTeam(t *testing.T) {
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	opts := LeaderboardOptions{Metric: MetricCommits, GroupBy: GroupByTeam, Teams: []teams.Team{
+		{Name: "backend", Members: []string{"alice", "bob"}},
+		{Name: "frontend", Members: []string{"bob"}},
+	}}
+	board := computeLeaderboard(leaderboardCommits(), Query{From: from}, nil, opts)
+
+	// carol isn't in any team.
+	assert.Len(t, board.Entries, 2)
+	assert.Equal(t, "backend", board.Entries[0].Key)
+	assert.Equal(t, 5, board.Entries[0].Value)
+	assert.Equal(t, "frontend", board.Entries[1].Key)
+	assert.Equal(t, 2, board.Entries[1].Value)
+}
+
+func TestRankLeaderboard_LoadsPreviousWindow(t *testing.T) {
+	mockCollection := mockCommitCollection(t, leaderboardCommits())
+
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	board, err := RankLeaderboard(context.Background(), Query{Repo: "repo1", From: from, To: to}, LeaderboardOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, MetricCommits, board.Metric)
+	assert.Equal(t, GroupByAuthor, board.GroupBy)
+
+	mockCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"reponame":    "repo1",
+		"commit_date": bson.M{"$gte": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "$lt": to},
+	}, mock.Anything)
+}
+
+func TestParseLeaderboardOptions(t *testing.T) {
+	opts, err := ParseLeaderboardOptions("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, LeaderboardOptions{Metric: MetricCommits, GroupBy: GroupByAuthor}, opts)
+
+	opts, err = ParseLeaderboardOptions(MetricFiles, GroupByRepo)
+	assert.NoError(t, err)
+	assert.Equal(t, LeaderboardOptions{Metric: MetricFiles, GroupBy: GroupByRepo}, opts)
+}
+
+func TestRankLeaderboard_InvalidOptions(t *testing.T) {
+	_, err := RankLeaderboard(context.Background(), Query{}, LeaderboardOptions{Metric: "karma"})
+	assert.ErrorContains(t, err, "unknown leaderboard metric")
+
+	_, err = RankLeaderboard(context.Background(), Query{}, LeaderboardOptions{GroupBy: "file"})
+	assert.ErrorContains(t, err, "unknown leaderboard grouping")
+}
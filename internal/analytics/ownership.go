@@ -0,0 +1,223 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+)
+
+// RootDirectory is the directory name used for repository-wide ownership.
+const RootDirectory = "/"
+
+// fileHistory accumulates the changes made to a single file. Renames carry
+// the history over to the new path and removed files are dropped, so the
+// history describes the files that exist at the end of the query range.
+type fileHistory struct {
+	changes     int
+	churn       int
+	lastChanged time.Time
+	authors     map[string]int
+}
+
+// author identifies a contributor by GitHub login when known, else by name.
+type author struct {
+	name  string
+	login string
+}
+
+func authorOf(commit gitmetrics.Commit) author {
+	return author{name: commit.CommittedBy, login: commit.AuthorLogin}
+}
+
+func (a author) key() string {
+	if a.login != "" {
+		return "@" + a.login
+	}
+	return a.name
+}
+
+func buildFileHistories(commits []gitmetrics.Commit) (map[string]map[string]*fileHistory, map[string]author) {
+	sorted := make([]gitmetrics.Commit, len(commits))
+	copy(sorted, commits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CommitDate.Before(sorted[j].CommitDate)
+	})
+
+	histories := make(map[string]map[string]*fileHistory)
+	authors := make(map[string]author)
+	for _, commit := range sorted {
+		repo := gitmetrics.FullName(commit.Owner, commit.RepoName)
+		files, ok := histories[repo]
+		if !ok {
+			files = make(map[string]*fileHistory)
+			histories[repo] = files
+		}
+		who := authorOf(commit)
+		authors[who.key()] = who
+
+		for _, file := range commit.Files {
+			if file.PreviousFilename != "" {
+				if history, ok := files[file.PreviousFilename]; ok {
+					files[file.Filename] = history
+					delete(files, file.PreviousFilename)
+				}
+			}
+			if file.Status == "removed" {
+				delete(files, file.Filename)
+				continue
+			}
+
+			history, ok := files[file.Filename]
+			if !ok {
+				history = &fileHistory{authors: make(map[string]int)}
+				files[file.Filename] = history
+			}
+			lines := file.Additions + file.Deletions
+			history.changes++
+			history.churn += lines
+			history.lastChanged = commit.CommitDate
+			history.authors[who.key()] += lines
+		}
+	}
+
+	return histories, authors
+}
+
+// Hotspots ranks the files of the matching commits by change frequency times
+// lines changed, highest first. A limit of 0 returns every file.
+func Hotspots(ctx context.Context, q Query, limit int) ([]Hotspot, error) {
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return computeHotspots(commits, limit), nil
+}
+
+func computeHotspots(commits []gitmetrics.Commit, limit int) []Hotspot {
+	histories, _ := buildFileHistories(commits)
+
+	hotspots := []Hotspot{}
+	for repo, files := range histories {
+		for path, history := range files {
+			hotspots = append(hotspots, Hotspot{
+				Repo:        repo,
+				File:        path,
+				Changes:     history.changes,
+				Churn:       history.churn,
+				Score:       history.changes * history.churn,
+				Authors:     len(history.authors),
+				LastChanged: history.lastChanged,
+			})
+		}
+	}
+
+	sort.Slice(hotspots, func(i, j int) bool {
+		a, b := hotspots[i], hotspots[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.File < b.File
+	})
+
+	if limit > 0 && len(hotspots) > limit {
+		hotspots = hotspots[:limit]
+	}
+	return hotspots
+}
+
+// Ownership computes, for every directory up to maxDepth levels below the
+// repository root, who changed the most lines in the files under it. A
+// maxDepth of 0 only reports the repository root.
+func Ownership(ctx context.Context, q Query, maxDepth int) ([]DirectoryOwnership, error) {
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return computeOwnership(commits, maxDepth), nil
+}
+
+func computeOwnership(commits []gitmetrics.Commit, maxDepth int) []DirectoryOwnership {
+	histories, authors := buildFileHistories(commits)
+
+	type dirKey struct{ repo, dir string }
+	contributions := make(map[dirKey]map[string]int)
+	for repo, files := range histories {
+		for path, history := range files {
+			for _, dir := range parentDirectories(path, maxDepth) {
+				key := dirKey{repo, dir}
+				if contributions[key] == nil {
+					contributions[key] = make(map[string]int)
+				}
+				for who, lines := range history.authors {
+					contributions[key][who] += lines
+				}
+			}
+		}
+	}
+
+	result := make([]DirectoryOwnership, 0, len(contributions))
+	for key, byAuthor := range contributions {
+		ownership := DirectoryOwnership{Repo: key.repo, Directory: key.dir}
+		for who, lines := range byAuthor {
+			ownership.LinesChanged += lines
+			ownership.Owners = append(ownership.Owners, OwnerShare{
+				Name:  authors[who].name,
+				Login: authors[who].login,
+				Lines: lines,
+			})
+		}
+		if ownership.LinesChanged == 0 {
+			continue
+		}
+
+		sort.Slice(ownership.Owners, func(i, j int) bool {
+			a, b := ownership.Owners[i], ownership.Owners[j]
+			if a.Lines != b.Lines {
+				return a.Lines > b.Lines
+			}
+			return a.Name < b.Name
+		})
+
+		cumulative := 0.0
+		for i := range ownership.Owners {
+			owner := &ownership.Owners[i]
+			owner.Share = float64(owner.Lines) / float64(ownership.LinesChanged)
+			ownership.Concentration += owner.Share * owner.Share
+			if cumulative <= 0.5 {
+				ownership.BusFactor++
+			}
+			cumulative += owner.Share
+		}
+		ownership.PrimaryOwner = ownership.Owners[0].Name
+		ownership.PrimaryOwnerLogin = ownership.Owners[0].Login
+		ownership.OwnerShare = ownership.Owners[0].Share
+
+		result = append(result, ownership)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Repo != result[j].Repo {
+			return result[i].Repo < result[j].Repo
+		}
+		return result[i].Directory < result[j].Directory
+	})
+	return result
+}
+
+// parentDirectories returns the directories containing path, from the root
+// down to maxDepth levels, e.g. "/", "internal/" and "internal/db/" for
+// "internal/db/mongodb.go".
+func parentDirectories(path string, maxDepth int) []string {
+	dirs := []string{RootDirectory}
+	parts := strings.Split(path, "/")
+	for depth := 1; depth < len(parts) && depth <= maxDepth; depth++ {
+		dirs = append(dirs, strings.Join(parts[:depth], "/")+"/")
+	}
+	return dirs
+}
@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func ownershipCommits() []gitmetrics.Commit {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	return []gitmetrics.Commit{
+		{CommitID: "c1", Owner: "acme", RepoName: "repo1", CommittedBy: "Alice", AuthorLogin: "alice", CommitDate: day(1), Files: []gitmetrics.FileChange{
+			{Filename: "internal/db/mongodb.go", Status: "added", Additions: 60},
+			{Filename: "main.go", Status: "added", Additions: 10},
+			{Filename: "tmp.txt", Status: "added", Additions: 500},
+		}},
+		{CommitID: "c2", Owner: "acme", RepoName: "repo1", CommittedBy: "Bob", CommitDate: day(2), Files: []gitmetrics.FileChange{
+			{Filename: "internal/db/mongodb.go", Status: "modified", Additions: 10, Deletions: 10},
+			{Filename: "internal/server.go", Status: "added", Additions: 20},
+		}},
+		{CommitID: "c3", Owner: "acme", RepoName: "repo1", CommittedBy: "Alice", AuthorLogin: "alice", CommitDate: day(3), Files: []gitmetrics.FileChange{
+			{Filename: "internal/store/mongodb.go", PreviousFilename: "internal/db/mongodb.go", Status: "renamed"},
+			{Filename: "tmp.txt", Status: "removed", Deletions: 500},
+		}},
+	}
+}
+
+func TestComputeHotspots(t *testing.T) {
+	hotspots := computeHotspots(ownershipCommits(), 0)
+
+	assert.Equal(t, []Hotspot{
+		{Repo: "acme/repo1", File: "internal/store/mongodb.go", Changes: 3, Churn: 80, Score: 240, Authors: 2, LastChanged: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{Repo: "acme/repo1", File: "internal/server.go", Changes: 1, Churn: 20, Score: 20, Authors: 1, LastChanged: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Repo: "acme/repo1", File: "main.go", Changes: 1, Churn: 10, Score: 10, Authors: 1, LastChanged: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, hotspots)
+
+	assert.Len(t, computeHotspots(ownershipCommits(), 1), 1)
+}
+
+func TestComputeHotspots_Forks(t *testing.T) {
+	hotspots := computeHotspots(withFork(ownershipCommits()), 0)
+
+	assert.Len(t, hotspots, 6)
+	assert.Equal(t, "acme/repo1", hotspots[0].Repo)
+	assert.Equal(t, "fork/repo1", hotspots[1].Repo)
+	assert.Equal(t, 240, hotspots[1].Score)
+}
+
+func TestComputeOwnership(t *testing.T) {
+	ownership := computeOwnership(ownershipCommits(), 2)
+
+	dirs := make(map[string]DirectoryOwnership)
+	for _, dir := range ownership {
+		dirs[dir.Directory] = dir
+	}
+	assert.Len(t, ownership, 3)
+	assert.Equal(t, "/", ownership[0].Directory)
+	assert.Equal(t, "internal/", ownership[1].Directory)
+	assert.Equal(t, "internal/store/", ownership[2].Directory)
+
+	root := dirs["/"]
+	assert.Equal(t, 110, root.LinesChanged)
+	assert.Equal(t, "Alice", root.PrimaryOwner)
+	assert.Equal(t, "alice", root.PrimaryOwnerLogin)
+	assert.InDelta(t, 70.0/110, root.OwnerShare, 1e-9)
+	assert.InDelta(t, (70.0*70+40*40)/(110*110), root.Concentration, 1e-9)
+	assert.Equal(t, 1, root.BusFactor)
+
+	internal := dirs["internal/"]
+	assert.Equal(t, 100, internal.LinesChanged)
+	assert.Equal(t, []OwnerShare{
+		{Name: "Alice", Login: "alice", Lines: 60, Share: 0.6},
+		{Name: "Bob", Lines: 40, Share: 0.4},
+	}, internal.Owners)
+
+	store := dirs["internal/store/"]
+	assert.Equal(t, 80, store.LinesChanged)
+	assert.InDelta(t, 0.75, store.OwnerShare, 1e-9)
+}
+
+func TestComputeOwnership_EvenSplitBusFactor(t *testing.T) {
+	commits := []gitmetrics.Commit{
+		{RepoName: "repo1", CommittedBy: "Alice", Files: []gitmetrics.FileChange{{Filename: "a.go", Additions: 10}}},
+		{RepoName: "repo1", CommittedBy: "Bob", Files: []gitmetrics.FileChange{{Filename: "b.go", Additions: 10}}},
+	}
+
+	ownership := computeOwnership(commits, 0)
+	assert.Len(t, ownership, 1)
+	assert.Equal(t, 2, ownership[0].BusFactor)
+	assert.InDelta(t, 0.5, ownership[0].Concentration, 1e-9)
+}
+
+func TestParentDirectories(t *testing.T) {
+	assert.Equal(t, []string{"/", "internal/", "internal/db/"}, parentDirectories("internal/db/mongodb.go", 2))
+	assert.Equal(t, []string{"/", "internal/"}, parentDirectories("internal/db/mongodb.go", 1))
+	assert.Equal(t, []string{"/"}, parentDirectories("main.go", 3))
+}
+
+func TestOwnership_LoadsCommits(t *testing.T) {
+	mockCommitCollection(t, ownershipCommits())
+
+	ownership, err := Ownership(context.Background(), Query{Repo: "repo1"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, ownership, 1)
+
+	mockCommitCollection(t, ownershipCommits())
+	hotspots, err := Hotspots(context.Background(), Query{Repo: "repo1"}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, hotspots, 2)
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Filter returns the MongoDB filter matching the commits selected by the query.
+func (q Query) Filter() bson.M {
+	filter := q.ownerFilter()
+	if q.Repo != "" {
+		filter["reponame"] = q.Repo
+	}
+	q.addAuthorFilter(filter, "committed_by", "author_login")
+
+	dateRange := bson.M{}
+	if !q.From.IsZero() {
+		dateRange["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		dateRange["$lt"] = q.To
+	}
+	if len(dateRange) > 0 {
+		filter["commit_date"] = dateRange
+	}
+	if q.ExcludeOutliers {
+		filter["outlier"] = bson.M{"$ne": true}
+	}
+
+	return filter
+}
+
+// ownerFilter returns the filter selecting the repositories of the query's
+// owner, or every repository when no owner is set.
+func (q Query) ownerFilter() bson.M {
+	filter := bson.M{}
+	if q.Owner != "" {
+		filter["owner"] = q.Owner
+	}
+	return filter
+}
+
+// addAuthorFilter restricts filter to the query's author and team members,
+// given the fields holding the author name and GitHub login.
+func (q Query) addAuthorFilter(filter bson.M, nameField, loginField string) {
+	if q.Author != "" {
+		filter[nameField] = q.Author
+	}
+	if q.Team != nil {
+		filter["$or"] = bson.A{
+			bson.M{loginField: bson.M{"$in": q.Team.Logins()}},
+			bson.M{nameField: bson.M{"$in": q.Team.Names()}},
+		}
+	}
+}
+
+// repoFilter returns the filter selecting the query's repository, or the
+// repositories owned by its team when no repository is set.
+func (q Query) repoFilter() bson.M {
+	filter := q.ownerFilter()
+	if q.Repo != "" {
+		filter["reponame"] = q.Repo
+	} else if q.Team != nil {
+		filter["reponame"] = bson.M{"$in": q.Team.Repos}
+	}
+	return filter
+}
+
+// matchesAuthor reports whether a commit is by the query's author and, when
+// the query has a team, by one of its members.
+func (q Query) matchesAuthor(commit gitmetrics.Commit) bool {
+	if q.Author != "" && commit.CommittedBy != q.Author {
+		return false
+	}
+	return q.Team == nil || q.Team.HasMember(commit.CommittedBy, commit.AuthorLogin)
+}
+
+// groupKeys returns the groups a commit counts towards when grouping by
+// author, repository or team. A commit by a member of several teams counts
+// towards each of them, and commits by contributors outside every team are
+// left out when grouping by team.
+func groupKeys(commit gitmetrics.Commit, groupBy string, all []teams.Team) []string {
+	switch groupBy {
+	case GroupByRepo:
+		return []string{gitmetrics.FullName(commit.Owner, commit.RepoName)}
+	case GroupByTeam:
+		return teams.TeamsOf(all, commit.CommittedBy, commit.AuthorLogin)
+	}
+	return []string{commit.CommittedBy}
+}
+
+// LoadCommits returns the stored commits matching the query, oldest first.
+func LoadCommits(ctx context.Context, q Query) ([]gitmetrics.Commit, error) {
+	return findCommits(ctx, q.Filter())
+}
+
+func findCommits(ctx context.Context, filter bson.M) ([]gitmetrics.Commit, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "commit_date", Value: 1}})
+	cursor, err := db.GetCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commits: %w", err)
+	}
+
+	var commits []gitmetrics.Commit
+	if err := cursor.All(ctx, &commits); err != nil {
+		return nil, fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	return commits, nil
+}
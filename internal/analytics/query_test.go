@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mockCommitCollection makes db.GetCollection return a mock collection whose
+// Find yields the given commits.
+func mockCommitCollection(t *testing.T, commits []gitmetrics.Commit) *db.MockCollection {
+	docs := make([]interface{}, len(commits))
+	for i, commit := range commits {
+		docs[i] = commit
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(cursor, nil)
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	t.Cleanup(func() { db.GetCollectionFunc = originalGetCollectionFunc })
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return mockCollection
+	}
+
+	return mockCollection
+}
+
+func TestQueryFilter(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	filter := Query{Repo: "repo1", Author: "author1", From: from, To: to}.Filter()
+	assert.Equal(t, bson.M{
+		"reponame":     "repo1",
+		"committed_by": "author1",
+		"commit_date":  bson.M{"$gte": from, "$lt": to},
+	}, filter)
+
+	assert.Equal(t, bson.M{}, Query{}.Filter())
+	assert.Equal(t, bson.M{"outlier": bson.M{"$ne": true}}, Query{ExcludeOutliers: true}.Filter())
+	// A fork is selected apart from its upstream by owner.
+	assert.Equal(t, bson.M{"owner": "acme", "reponame": "repo1"}, Query{Owner: "acme", Repo: "repo1"}.Filter())
+}
+
+func TestQueryFilter_Team(t *testing.T) {
+	team := &teams.Team{Name: "platform", Members: []string{"@alice", "Bob"}, Repos: []string{"repo1", "repo2"}}
+	q := Query{Team: team}
+
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"author_login": bson.M{"$in": []string{"alice"}}},
+		bson.M{"committed_by": bson.M{"$in": []string{"Bob"}}},
+	}}, q.Filter())
+	assert.Equal(t, bson.M{"reponame": bson.M{"$in": []string{"repo1", "repo2"}}}, q.repoFilter())
+	assert.Equal(t, bson.M{"reponame": "repo3"}, Query{Repo: "repo3", Team: team}.repoFilter())
+	assert.Equal(t, bson.M{"owner": "acme", "reponame": bson.M{"$in": []string{"repo1", "repo2"}}}, Query{Owner: "acme", Team: team}.repoFilter())
+
+	assert.True(t, q.matchesAuthor(gitmetrics.Commit{CommittedBy: "Alice", AuthorLogin: "alice"}))
+	assert.False(t, q.matchesAuthor(gitmetrics.Commit{CommittedBy: "Carol"}))
+	assert.False(t, Query{Author: "Bob", Team: team}.matchesAuthor(gitmetrics.Commit{CommittedBy: "Alice", AuthorLogin: "alice"}))
+}
+
+func TestLoadCommits_Success(t *testing.T) {
+	commits := []gitmetrics.Commit{
+		{CommitID: "a", RepoName: "repo1", CommitDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{CommitID: "b", RepoName: "repo1", CommitDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	mockCollection := mockCommitCollection(t, commits)
+
+	loaded, err := LoadCommits(context.Background(), Query{Repo: "repo1"})
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 2)
+	assert.Equal(t, "a", loaded[0].CommitID)
+	mockCollection.AssertCalled(t, "Find", mock.Anything, bson.M{"reponame": "repo1"}, mock.Anything)
+}
+
+func TestLoadCommits_Error(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("connection lost"))
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return mockCollection
+	}
+
+	commits, err := LoadCommits(context.Background(), Query{})
+	assert.Error(t, err)
+	assert.Nil(t, commits)
+	assert.Contains(t, err.Error(), "failed to query commits")
+}
+
+// withFork returns commits followed by a copy of each in a fork of the same
+// name, which shares their IDs.
+func withFork(commits []gitmetrics.Commit) []gitmetrics.Commit {
+	result := append([]gitmetrics.Commit(nil), commits...)
+	for _, commit := range commits {
+		commit.Owner = "fork"
+		result = append(result, commit)
+	}
+	return result
+}
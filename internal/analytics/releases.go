@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoadReleases returns the stored releases of the query's repository that
+// were released within its date range, oldest first.
+func LoadReleases(ctx context.Context, q Query) ([]gitmetrics.Release, error) {
+	filter := q.repoFilter()
+	dateRange := bson.M{}
+	if !q.From.IsZero() {
+		dateRange["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		dateRange["$lt"] = q.To
+	}
+	if len(dateRange) > 0 {
+		filter["released_at"] = dateRange
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "released_at", Value: 1}})
+	cursor, err := db.GetNamedCollection(db.ReleasesCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+
+	var releases []gitmetrics.Release
+	if err := cursor.All(ctx, &releases); err != nil {
+		return nil, fmt.Errorf("failed to decode releases: %w", err)
+	}
+
+	return releases, nil
+}
+
+// ReleaseReports computes per-release and per-repository release metrics for
+// the releases published within the query's range. Commit counts, lines and
+// lead times only include commits by the query's author or team members when
+// one is set.
+func ReleaseReports(ctx context.Context, q Query) ([]RepoReleaseReport, error) {
+	releases, err := LoadReleases(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return []RepoReleaseReport{}, nil
+	}
+
+	tags := make([]string, 0, len(releases))
+	for _, release := range releases {
+		tags = append(tags, release.TagName)
+	}
+	filter := q.repoFilter()
+	q.addAuthorFilter(filter, "committed_by", "author_login")
+	filter["release_tag"] = bson.M{"$in": tags}
+
+	commits, err := findCommits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildReleaseReports(releases, commits, q.From, q.To), nil
+}
+
+func buildReleaseReports(releases []gitmetrics.Release, commits []gitmetrics.Commit, from, to time.Time) []RepoReleaseReport {
+	type releaseKey struct{ owner, repo, tag string }
+	commitsByRelease := make(map[releaseKey][]gitmetrics.Commit)
+	for _, commit := range commits {
+		key := releaseKey{commit.Owner, commit.RepoName, commit.ReleaseTag}
+		commitsByRelease[key] = append(commitsByRelease[key], commit)
+	}
+
+	reports := make(map[string]*RepoReleaseReport)
+	repoLeadTimes := make(map[string][]float64)
+	for _, release := range releases {
+		repo := gitmetrics.FullName(release.Owner, release.RepoName)
+		report, ok := reports[repo]
+		if !ok {
+			report = &RepoReleaseReport{Owner: release.Owner, Repo: release.RepoName}
+			reports[repo] = report
+		}
+
+		metrics := ReleaseMetrics{
+			Repo:       release.RepoName,
+			TagName:    release.TagName,
+			ReleasedAt: release.ReleasedAt,
+		}
+		var leadTimes []float64
+		for _, commit := range commitsByRelease[releaseKey{release.Owner, release.RepoName, release.TagName}] {
+			metrics.Commits++
+			metrics.LinesAdded += commit.LinesAdded
+			metrics.LinesDeleted += commit.LinesDeleted
+			leadTimes = append(leadTimes, release.ReleasedAt.Sub(commit.CommitDate).Hours())
+		}
+		metrics.MeanLeadTimeHours = mean(leadTimes)
+		metrics.MedianLeadTimeHours = median(leadTimes)
+
+		report.Releases = append(report.Releases, metrics)
+		repoLeadTimes[repo] = append(repoLeadTimes[repo], leadTimes...)
+	}
+
+	result := make([]RepoReleaseReport, 0, len(reports))
+	for repo, report := range reports {
+		report.ReleaseCount = len(report.Releases)
+		report.MedianLeadTimeHours = median(repoLeadTimes[repo])
+		report.ReleasesPerWeek, report.MeanDaysBetweenReleases = releaseFrequency(report.Releases, from, to)
+		result = append(result, *report)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Repo != result[j].Repo {
+			return result[i].Repo < result[j].Repo
+		}
+		return result[i].Owner < result[j].Owner
+	})
+	return result
+}
+
+// releaseFrequency returns the number of releases per week and the mean gap
+// between consecutive releases in days.
+func releaseFrequency(releases []ReleaseMetrics, from, to time.Time) (*float64, float64) {
+	times := make([]time.Time, len(releases))
+	var gaps []float64
+	for i, release := range releases {
+		times[i] = release.ReleasedAt
+		if i > 0 {
+			gaps = append(gaps, release.ReleasedAt.Sub(releases[i-1].ReleasedAt).Hours()/24)
+		}
+	}
+
+	return ratePerWeek(times, from, to), mean(gaps)
+}
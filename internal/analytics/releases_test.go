@@ -0,0 +1,144 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mockNamedCollection makes db.GetNamedCollection return a mock collection
+// for name whose Find yields docs. Other names fall through to the original.
+func mockNamedCollection(t *testing.T, name string, docs []interface{}) *db.MockCollection {
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(cursor, nil)
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	t.Cleanup(func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc })
+	db.GetNamedCollectionFunc = func(requested string) db.CollectionInterface {
+		if requested == name {
+			return mockCollection
+		}
+		return originalGetNamedCollectionFunc(requested)
+	}
+
+	return mockCollection
+}
+
+func TestReleaseReports(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	releaseCollection := mockNamedCollection(t, db.ReleasesCollection, []interface{}{
+		gitmetrics.Release{RepoName: "repo1", TagName: "v1.0.0", ReleasedAt: day(8)},
+		gitmetrics.Release{RepoName: "repo1", TagName: "v1.1.0", ReleasedAt: day(22)},
+	})
+	commitCollection := mockCommitCollection(t, []gitmetrics.Commit{
+		{RepoName: "repo1", ReleaseTag: "v1.0.0", CommitDate: day(1), LinesAdded: 10, LinesDeleted: 1},
+		{RepoName: "repo1", ReleaseTag: "v1.0.0", CommitDate: day(7), LinesAdded: 5},
+		{RepoName: "repo1", ReleaseTag: "v1.1.0", CommitDate: day(21), LinesAdded: 1, LinesDeleted: 2},
+	})
+
+	q := Query{Repo: "repo1", From: day(1), To: day(29)}
+	reports, err := ReleaseReports(context.Background(), q)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+
+	report := reports[0]
+	assert.Equal(t, "repo1", report.Repo)
+	assert.Equal(t, 2, report.ReleaseCount)
+	assert.InDelta(t, 0.5, *report.ReleasesPerWeek, 1e-9)
+	assert.InDelta(t, 14, report.MeanDaysBetweenReleases, 1e-9)
+	assert.InDelta(t, 24, report.MedianLeadTimeHours, 1e-9)
+
+	assert.Equal(t, ReleaseMetrics{
+		Repo:                "repo1",
+		TagName:             "v1.0.0",
+		ReleasedAt:          day(8),
+		Commits:             2,
+		LinesAdded:          15,
+		LinesDeleted:        1,
+		MeanLeadTimeHours:   96,
+		MedianLeadTimeHours: 96,
+	}, report.Releases[0])
+	assert.Equal(t, 1, report.Releases[1].Commits)
+	assert.InDelta(t, 24, report.Releases[1].MeanLeadTimeHours, 1e-9)
+
+	releaseCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"reponame":    "repo1",
+		"released_at": bson.M{"$gte": day(1), "$lt": day(29)},
+	}, mock.Anything)
+	commitCollection.AssertCalled(t, "Find", mock.Anything, bson.M{
+		"reponame":    "repo1",
+		"release_tag": bson.M{"$in": []string{"v1.0.0", "v1.1.0"}},
+	}, mock.Anything)
+}
+
+func TestBuildReleaseReports_Forks(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	releases := []gitmetrics.Release{
+		{Owner: "acme", RepoName: "repo1", TagName: "v1.0.0", ReleasedAt: day(8)},
+		{Owner: "fork", RepoName: "repo1", TagName: "v1.0.0", ReleasedAt: day(10)},
+	}
+	commits := []gitmetrics.Commit{
+		{Owner: "acme", RepoName: "repo1", ReleaseTag: "v1.0.0", CommitDate: day(7)},
+		{Owner: "fork", RepoName: "repo1", ReleaseTag: "v1.0.0", CommitDate: day(7)},
+		{Owner: "fork", RepoName: "repo1", ReleaseTag: "v1.0.0", CommitDate: day(9)},
+	}
+
+	reports := buildReleaseReports(releases, commits, time.Time{}, time.Time{})
+
+	// A fork's release of the same tag is reported apart from its upstream's.
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "acme", reports[0].Owner)
+	assert.Equal(t, 1, reports[0].Releases[0].Commits)
+	assert.Equal(t, "fork", reports[1].Owner)
+	assert.Equal(t, 2, reports[1].Releases[0].Commits)
+}
+
+func TestReleaseReports_NoReleases(t *testing.T) {
+	mockNamedCollection(t, db.ReleasesCollection, nil)
+
+	reports, err := ReleaseReports(context.Background(), Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, reports)
+}
+
+func TestReleaseReports_Error(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("connection lost"))
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	defer func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		return mockCollection
+	}
+
+	_, err := ReleaseReports(context.Background(), Query{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to query releases")
+}
+
+func TestReleaseFrequency_OpenWindow(t *testing.T) {
+	releases := []ReleaseMetrics{
+		{ReleasedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ReleasedAt: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{ReleasedAt: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	perWeek, gap := releaseFrequency(releases, time.Time{}, time.Time{})
+	assert.InDelta(t, 1.5, *perWeek, 1e-9)
+	assert.InDelta(t, 7, gap, 1e-9)
+
+	// A single release has no rate without a window, rather than a rate of 0.
+	perWeek, gap = releaseFrequency(releases[:1], time.Time{}, time.Time{})
+	assert.Nil(t, perWeek)
+	assert.Zero(t, gap)
+}
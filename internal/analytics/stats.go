@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// mean returns the arithmetic mean of values, or 0 for an empty slice.
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// median returns the median of values, or 0 for an empty slice.
+// The input is not modified.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// ratePerWeek returns how many of the given events happen per week, over
+// the requested window. An end of the window that isn't set is taken from
+// the events themselves. It returns nil when that leaves no time to measure
+// over, e.g. for a single event without a window, since the rate is then
+// undefined rather than zero.
+func ratePerWeek(times []time.Time, from, to time.Time) *float64 {
+	rate := 0.0
+	if len(times) == 0 {
+		return &rate
+	}
+
+	first, last := times[0], times[0]
+	for _, t := range times {
+		if t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	if !from.IsZero() {
+		first = from
+	}
+	if !to.IsZero() {
+		last = to
+	}
+
+	weeks := last.Sub(first).Hours() / (24 * 7)
+	if weeks <= 0 {
+		return nil
+	}
+	rate = float64(len(times)) / weeks
+	return &rate
+}
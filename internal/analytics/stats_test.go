@@ -0,0 +1,39 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMean(t *testing.T) {
+	assert.Zero(t, mean(nil))
+	assert.Equal(t, 2.5, mean([]float64{1, 2, 3, 4}))
+}
+
+func TestMedian(t *testing.T) {
+	assert.Zero(t, median(nil))
+	assert.Equal(t, 3.0, median([]float64{5, 1, 3}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 3, 2}))
+
+	values := []float64{3, 1, 2}
+	median(values)
+	assert.Equal(t, []float64{3, 1, 2}, values)
+}
+
+func TestRatePerWeek(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	twoWeeks := []time.Time{start, start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)}
+
+	assert.InDelta(t, 1.5, *ratePerWeek(twoWeeks, time.Time{}, time.Time{}), 1e-9)
+	assert.InDelta(t, 0.75, *ratePerWeek(twoWeeks, start, start.AddDate(0, 0, 28)), 1e-9)
+	// Only the start of the window is set; the last event ends it.
+	assert.InDelta(t, 1.0, *ratePerWeek(twoWeeks, start.AddDate(0, 0, -7), time.Time{}), 1e-9)
+	assert.Zero(t, *ratePerWeek(nil, time.Time{}, time.Time{}))
+
+	// Events at a single instant span no time, so the rate is undefined.
+	assert.Nil(t, ratePerWeek([]time.Time{start}, time.Time{}, time.Time{}))
+	assert.Nil(t, ratePerWeek([]time.Time{start, start}, time.Time{}, time.Time{}))
+	assert.InDelta(t, 2.0, *ratePerWeek([]time.Time{start, start}, start, start.AddDate(0, 0, 7)), 1e-9)
+}
@@ -0,0 +1,173 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// TestRatioOptions selects how test ratios are grouped and whether only
+// groups with untested changes are reported. Teams are the teams to group by
+// when grouping by team.
+type TestRatioOptions struct {
+	GroupBy      string
+	UntestedOnly bool
+	Teams        []teams.Team
+}
+
+// change is a unit of work whose tests are judged together: a pull request,
+// or a commit that isn't part of one.
+type change struct {
+	key     string
+	repo    string
+	commits []gitmetrics.Commit
+}
+
+// TestRatios compares the test lines with the production lines changed by the
+// commits matching the query, per commit, pull request, author, repository or
+// team. A change ships without tests when it changes production code but no
+// tests; commits of the same pull request are judged together, so tests added
+// in a separate commit of the pull request count. Commits stored without
+// per-file changes are left out.
+func TestRatios(ctx context.Context, q Query, opts TestRatioOptions) ([]TestRatio, error) {
+	switch opts.GroupBy {
+	case "":
+		opts.GroupBy = GroupByAuthor
+	case GroupByCommit, GroupByPullRequest, GroupByAuthor, GroupByRepo, GroupByTeam:
+	default:
+		return nil, fmt.Errorf("unknown test ratio grouping %q, expected commit, pr, author, repo or team", opts.GroupBy)
+	}
+
+	commits, err := LoadCommits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return computeTestRatios(commits, opts), nil
+}
+
+// testAndProductionLines returns the lines a commit changed in test files and
+// in source files. Documentation, configuration and generated files count as
+// neither.
+func testAndProductionLines(commit gitmetrics.Commit) (int, int) {
+	test, production := 0, 0
+	for _, file := range commit.Files {
+		switch ClassifyFile(file.Filename).Category {
+		case CategoryTest:
+			test += file.Additions + file.Deletions
+		case CategorySource:
+			production += file.Additions + file.Deletions
+		}
+	}
+	return test, production
+}
+
+func computeTestRatios(commits []gitmetrics.Commit, opts TestRatioOptions) []TestRatio {
+	var changes []*change
+	byKey := make(map[string]*change)
+	for _, commit := range commits {
+		if len(commit.Files) == 0 {
+			continue
+		}
+		repo := gitmetrics.FullName(commit.Owner, commit.RepoName)
+		key := repo + "@" + commit.CommitID
+		if commit.PullRequest != 0 {
+			key = fmt.Sprintf("%s#%d", repo, commit.PullRequest)
+		}
+		c, ok := byKey[key]
+		if !ok {
+			c = &change{key: key, repo: repo}
+			byKey[key] = c
+			changes = append(changes, c)
+		}
+		c.commits = append(c.commits, commit)
+	}
+
+	// A commit shared by a fork and its upstream has a ratio in each.
+	type ratioKey struct{ repo, key string }
+	ratios := make(map[ratioKey]*TestRatio)
+	entry := func(key, repo string) *TestRatio {
+		ratio, ok := ratios[ratioKey{repo, key}]
+		if !ok {
+			ratio = &TestRatio{Key: key, Repo: repo}
+			ratios[ratioKey{repo, key}] = ratio
+		}
+		return ratio
+	}
+
+	for _, c := range changes {
+		changeTest := 0
+		keys := make(map[ratioKey]bool)
+		for _, commit := range c.commits {
+			test, production := testAndProductionLines(commit)
+			changeTest += test
+
+			switch opts.GroupBy {
+			case GroupByCommit:
+				ratio := entry(commit.CommitID, c.repo)
+				ratio.TestLines += test
+				ratio.ProductionLines += production
+				k := ratioKey{c.repo, commit.CommitID}
+				keys[k] = keys[k] || production > 0
+			case GroupByPullRequest:
+				if commit.PullRequest == 0 {
+					continue
+				}
+				ratio := entry(c.key, c.repo)
+				ratio.TestLines += test
+				ratio.ProductionLines += production
+				k := ratioKey{c.repo, c.key}
+				keys[k] = keys[k] || production > 0
+			default:
+				for _, key := range groupKeys(commit, opts.GroupBy, opts.Teams) {
+					ratio := entry(key, "")
+					ratio.TestLines += test
+					ratio.ProductionLines += production
+					k := ratioKey{"", key}
+					keys[k] = keys[k] || production > 0
+				}
+			}
+		}
+
+		// A change counts once towards each group whose commits changed
+		// production code in it.
+		for key, changedProduction := range keys {
+			if !changedProduction {
+				continue
+			}
+			ratios[key].Changes++
+			if changeTest == 0 {
+				ratios[key].ChangesWithoutTests++
+			}
+		}
+	}
+
+	result := make([]TestRatio, 0, len(ratios))
+	for _, ratio := range ratios {
+		if opts.UntestedOnly && ratio.ChangesWithoutTests == 0 {
+			continue
+		}
+		if ratio.ProductionLines > 0 {
+			value := float64(ratio.TestLines) / float64(ratio.ProductionLines)
+			ratio.Ratio = &value
+		}
+		if ratio.Changes > 0 {
+			ratio.UntestedRate = float64(ratio.ChangesWithoutTests) / float64(ratio.Changes)
+		}
+		result = append(result, *ratio)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.ChangesWithoutTests != b.ChangesWithoutTests {
+			return a.ChangesWithoutTests > b.ChangesWithoutTests
+		}
+		if a.UntestedRate != b.UntestedRate {
+			return a.UntestedRate > b.UntestedRate
+		}
+		return a.Key < b.Key
+	})
+	return result
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRatioCommits() []gitmetrics.Commit {
+	return []gitmetrics.Commit{
+		// Pull request 7 adds its tests in a separate commit.
+		{CommitID: "c1", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", PullRequest: 7, Files: []gitmetrics.FileChange{
+			{Filename: "server.go", Additions: 40, Deletions: 10},
+		}},
+		{CommitID: "c2", Owner: "acme", RepoName: "repo1", CommittedBy: "alice", PullRequest: 7, Files: []gitmetrics.FileChange{
+			{Filename: "server_test.go", Additions: 25},
+		}},
+		// Pushed without a pull request or tests.
+		{CommitID: "c3", Owner: "acme", RepoName: "repo1", CommittedBy: "bob", Files: []gitmetrics.FileChange{
+			{Filename: "db.go", Additions: 20},
+			{Filename: "README.md", Additions: 5},
+		}},
+		// Documentation only, so it doesn't need tests.
+		{CommitID: "c4", Owner: "acme", RepoName: "repo2", CommittedBy: "bob", Files: []gitmetrics.FileChange{
+			{Filename: "docs/setup.md", Additions: 30},
+		}},
+		{CommitID: "c5", Owner: "acme", RepoName: "repo2", CommittedBy: "carol", LinesAdded: 10},
+	}
+}
+
+func TestComputeTestRatios_ByAuthor(t *testing.T) {
+	ratios := computeTestRatios(testRatioCommits(), TestRatioOptions{GroupBy: GroupByAuthor})
+
+	half := 0.5
+	assert.Equal(t, []TestRatio{
+		{Key: "bob", TestLines: 0, ProductionLines: 20, Ratio: new(float64), Changes: 1, ChangesWithoutTests: 1, UntestedRate: 1},
+		{Key: "alice", TestLines: 25, ProductionLines: 50, Ratio: &half, Changes: 1},
+	}, ratios)
+}
+
+func TestComputeTestRatios_ByCommitAndPullRequest(t *testing.T) {
+	ratios := computeTestRatios(testRatioCommits(), TestRatioOptions{GroupBy: GroupByCommit})
+	assert.Len(t, ratios, 4)
+	// c1 is judged with the tests of its pull request.
+	for _, ratio := range ratios {
+		if ratio.Key == "c1" {
+			assert.Equal(t, 1, ratio.Changes)
+			assert.Equal(t, 0, ratio.ChangesWithoutTests)
+			assert.Equal(t, 0.0, *ratio.Ratio)
+		}
+		if ratio.Key == "c2" {
+			assert.Equal(t, 0, ratio.Changes)
+		}
+		if ratio.Key == "c4" {
+			assert.Nil(t, ratio.Ratio)
+			assert.Equal(t, 0, ratio.Changes)
+		}
+	}
+	assert.Equal(t, "c3", ratios[0].Key)
+
+	ratios = computeTestRatios(testRatioCommits(), TestRatioOptions{GroupBy: GroupByPullRequest})
+	assert.Equal(t, []string{"acme/repo1#7"}, []string{ratios[0].Key})
+	assert.Equal(t, "acme/repo1", ratios[0].Repo)
+	assert.Equal(t, 1, ratios[0].Changes)
+}
+
+func TestComputeTestRatios_Forks(t *testing.T) {
+	// Fork and upstream pull request numbers are independent.
+	ratios := computeTestRatios(withFork(testRatioCommits()), TestRatioOptions{GroupBy: GroupByPullRequest})
+	assert.ElementsMatch(t, []string{"acme/repo1#7", "fork/repo1#7"}, []string{ratios[0].Key, ratios[1].Key})
+	assert.Equal(t, 1, ratios[0].Changes)
+	assert.Equal(t, 1, ratios[1].Changes)
+
+	single := computeTestRatios(testRatioCommits(), TestRatioOptions{GroupBy: GroupByCommit})
+	ratios = computeTestRatios(withFork(testRatioCommits()), TestRatioOptions{GroupBy: GroupByCommit})
+	assert.Len(t, ratios, 2*len(single))
+	for _, ratio := range ratios {
+		if ratio.Key == "c3" {
+			assert.Equal(t, 1, ratio.Changes, ratio.Repo)
+		}
+	}
+}
+
+func TestComputeTestRatios_UntestedOnly(t *testing.T) {
+	ratios := computeTestRatios(testRatioCommits(), TestRatioOptions{GroupBy: GroupByRepo, UntestedOnly: true})
+
+	assert.Len(t, ratios, 1)
+	assert.Equal(t, "acme/repo1", ratios[0].Key)
+	assert.Equal(t, 2, ratios[0].Changes)
+	assert.Equal(t, 0.5, ratios[0].UntestedRate)
+}
+
+func TestTestRatios(t *testing.T) {
+	mockCommitCollection(t, testRatioCommits())
+
+	ratios, err := TestRatios(context.Background(), Query{}, TestRatioOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", ratios[0].Key)
+
+	_, err = TestRatios(context.Background(), Query{}, TestRatioOptions{GroupBy: GroupByFile})
+	assert.ErrorContains(t, err, "unknown test ratio grouping")
+}
+
+func TestSetTestPatterns(t *testing.T) {
+	t.Cleanup(func() { testPatterns = nil })
+
+	assert.Error(t, SetTestPatterns([]string{"[a-"}))
+	assert.NoError(t, SetTestPatterns([]string{"*_integration.go", "QA/", "e2e-*/*.ts"}))
+
+	assert.Equal(t, CategoryTest, ClassifyFile("store_integration.go").Category)
+	assert.Equal(t, CategoryTest, ClassifyFile("tools/qa/load.py").Category)
+	assert.Equal(t, CategoryTest, ClassifyFile("e2e-web/login.ts").Category)
+	assert.Equal(t, CategorySource, ClassifyFile("web/login.ts").Category)
+}
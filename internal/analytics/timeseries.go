@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// TotalSeries is the key of the single series returned without grouping.
+const TotalSeries = "total"
+
+// DefaultMovingAverageWindow is the number of periods averaged when the
+// caller doesn't choose a window.
+const DefaultMovingAverageWindow = 4
+
+// MaxTimeSeriesPeriods is the most periods a time series may have, ten years
+// of daily buckets, so a wide range can't allocate without bound.
+const MaxTimeSeriesPeriods = 3660
+
+// ErrTooManyPeriods is returned when the range of a time series covers more
+// than MaxTimeSeriesPeriods periods.
+var ErrTooManyPeriods = errors.New("time series range is too long")
+
+// seriesMetrics reads the numeric commit fields that can be charted from a
+// daily rollup.
+var seriesMetrics = map[string]func(gitmetrics.DailyRollup) int{
+	MetricCommits:   func(r gitmetrics.DailyRollup) int { return r.Commits },
+	"lines_added":   func(r gitmetrics.DailyRollup) int { return r.LinesAdded },
+	"lines_deleted": func(r gitmetrics.DailyRollup) int { return r.LinesDeleted },
+	"files_added":   func(r gitmetrics.DailyRollup) int { return r.FilesAdded },
+	"files_deleted": func(r gitmetrics.DailyRollup) int { return r.FilesDeleted },
+	"files_updated": func(r gitmetrics.DailyRollup) int { return r.FilesUpdated },
+}
+
+// TimeSeriesOptions selects the charted metric and how it is grouped and
+// bucketed. An empty GroupBy returns a single total series. Teams are the
+// teams to group by when grouping by team.
+type TimeSeriesOptions struct {
+	Metric  string
+	GroupBy string
+	Bucket  Bucket
+	Window  int
+	Teams   []teams.Team
+}
+
+// ParseTimeSeriesOptions validates a metric and grouping, defaulting to the
+// commit count of all matching commits.
+func ParseTimeSeriesOptions(metric, groupBy string) (TimeSeriesOptions, error) {
+	opts := TimeSeriesOptions{Metric: metric, GroupBy: groupBy}
+	if opts.Metric == "" {
+		opts.Metric = MetricCommits
+	}
+	if _, ok := seriesMetrics[opts.Metric]; !ok {
+		names := make([]string, 0, len(seriesMetrics))
+		for name := range seriesMetrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return opts, fmt.Errorf("unknown time-series metric %q, expected one of %s", opts.Metric, strings.Join(names, ", "))
+	}
+
+	switch opts.GroupBy {
+	case "", GroupByAuthor, GroupByRepo, GroupByTeam:
+	default:
+		return opts, fmt.Errorf("unknown time-series grouping %q, expected author, repo or team", opts.GroupBy)
+	}
+	return opts, nil
+}
+
+// MetricTimeSeries returns the bucketed series of a metric for the query,
+// read from the daily rollups. Every series covers the same periods, from the
+// query's start (or the first activity) to its end (or the last activity),
+// with missing periods filled with zero. It returns ErrTooManyPeriods when
+// that is more than MaxTimeSeriesPeriods periods.
+func MetricTimeSeries(ctx context.Context, q Query, opts TimeSeriesOptions) ([]TimeSeries, error) {
+	parsed, err := ParseTimeSeriesOptions(opts.Metric, opts.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	opts.Metric, opts.GroupBy = parsed.Metric, parsed.GroupBy
+	if opts.Bucket == "" {
+		opts.Bucket = BucketWeek
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultMovingAverageWindow
+	}
+
+	rollups, err := LoadRollups(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return buildTimeSeries(rollups, q, opts)
+}
+
+func rollupGroupKeys(rollup gitmetrics.DailyRollup, opts TimeSeriesOptions) []string {
+	switch opts.GroupBy {
+	case GroupByAuthor:
+		return []string{rollup.Author}
+	case GroupByRepo:
+		return []string{gitmetrics.FullName(rollup.Owner, rollup.RepoName)}
+	case GroupByTeam:
+		return teams.TeamsOf(opts.Teams, rollup.Author, rollup.AuthorLogin)
+	}
+	return []string{TotalSeries}
+}
+
+func buildTimeSeries(rollups []gitmetrics.DailyRollup, q Query, opts TimeSeriesOptions) ([]TimeSeries, error) {
+	value := seriesMetrics[opts.Metric]
+
+	values := make(map[string]map[time.Time]int)
+	var first, last time.Time
+	for _, rollup := range rollups {
+		period := opts.Bucket.Truncate(rollup.Day.UTC())
+		if first.IsZero() || period.Before(first) {
+			first = period
+		}
+		if period.After(last) {
+			last = period
+		}
+		for _, key := range rollupGroupKeys(rollup, opts) {
+			if values[key] == nil {
+				values[key] = make(map[time.Time]int)
+			}
+			values[key][period] += value(rollup)
+		}
+	}
+
+	if !q.From.IsZero() {
+		first = opts.Bucket.Truncate(q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		last = opts.Bucket.Truncate(q.To.UTC().Add(-time.Nanosecond))
+	}
+	var periods []time.Time
+	if !first.IsZero() {
+		for period := first; !period.After(last); period = opts.Bucket.Next(period) {
+			if len(periods) == MaxTimeSeriesPeriods {
+				return nil, fmt.Errorf("%w: more than %d %s buckets from %s to %s", ErrTooManyPeriods,
+					MaxTimeSeriesPeriods, opts.Bucket, first.Format("2006-01-02"), last.Format("2006-01-02"))
+			}
+			periods = append(periods, period)
+		}
+	}
+
+	if opts.GroupBy == "" && values[TotalSeries] == nil {
+		values[TotalSeries] = map[time.Time]int{}
+	}
+
+	result := make([]TimeSeries, 0, len(values))
+	for key, byPeriod := range values {
+		series := TimeSeries{Key: key, Metric: opts.Metric, Points: make([]TimeSeriesPoint, len(periods))}
+		sum := 0
+		for i, period := range periods {
+			sum += byPeriod[period]
+			if i >= opts.Window {
+				sum -= byPeriod[periods[i-opts.Window]]
+			}
+			count := i + 1
+			if count > opts.Window {
+				count = opts.Window
+			}
+			series.Points[i] = TimeSeriesPoint{
+				Period:        period,
+				Value:         byPeriod[period],
+				MovingAverage: float64(sum) / float64(count),
+			}
+		}
+		result = append(result, series)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
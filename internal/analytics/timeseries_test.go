@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func timeSeriesRollups() []gitmetrics.DailyRollup {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	return []gitmetrics.DailyRollup{
+		{RepoName: "repo1", Author: "alice", Day: day(1), Commits: 2, LinesAdded: 10},
+		{RepoName: "repo2", Author: "bob", Day: day(2), Commits: 1, LinesAdded: 4},
+		// Nothing in the week of 2024-01-08.
+		{RepoName: "repo1", Author: "bob", Day: day(16), Commits: 3, LinesAdded: 20},
+	}
+}
+
+func TestBuildTimeSeries_FillsGapsWithMovingAverage(t *testing.T) {
+	week := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	opts := TimeSeriesOptions{Metric: "lines_added", Bucket: BucketWeek, Window: 2}
+
+	series, err := buildTimeSeries(timeSeriesRollups(), Query{}, opts)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []TimeSeries{{Key: TotalSeries, Metric: "lines_added", Points: []TimeSeriesPoint{
+		{Period: week(1), Value: 14, MovingAverage: 14},
+		{Period: week(8), Value: 0, MovingAverage: 7},
+		{Period: week(15), Value: 20, MovingAverage: 10},
+	}}}, series)
+}
+
+func TestBuildTimeSeries_GroupedOverQueryRange(t *testing.T) {
+	week := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	q := Query{From: week(1), To: week(29)}
+	opts := TimeSeriesOptions{Metric: MetricCommits, GroupBy: GroupByRepo, Bucket: BucketWeek, Window: 4}
+
+	series, err := buildTimeSeries(timeSeriesRollups(), q, opts)
+	assert.NoError(t, err)
+
+	assert.Len(t, series, 2)
+	assert.Equal(t, "repo1", series[0].Key)
+	assert.Equal(t, "repo2", series[1].Key)
+	// Both series span the whole query range, up to the week ending at To.
+	for _, s := range series {
+		assert.Len(t, s.Points, 4)
+		assert.Equal(t, week(22), s.Points[3].Period)
+	}
+	assert.Equal(t, []int{2, 0, 3, 0}, []int{series[0].Points[0].Value, series[0].Points[1].Value, series[0].Points[2].Value, series[0].Points[3].Value})
+	assert.Equal(t, 1.25, series[0].Points[3].MovingAverage)
+}
+
+func TestBuildTimeSeries_ByTeam(t *testing.T) {
+	opts := TimeSeriesOptions{Metric: MetricCommits, GroupBy: GroupByTeam, Bucket: BucketMonth, Window: 1, Teams: []teams.Team{
+		{Name: "backend", Members: []string{"alice", "bob"}},
+		{Name: "frontend", Members: []string{"bob"}},
+	}}
+
+	series, err := buildTimeSeries(timeSeriesRollups(), Query{}, opts)
+	assert.NoError(t, err)
+
+	assert.Len(t, series, 2)
+	assert.Equal(t, "backend", series[0].Key)
+	assert.Equal(t, 6, series[0].Points[0].Value)
+	assert.Equal(t, "frontend", series[1].Key)
+	assert.Equal(t, 4, series[1].Points[0].Value)
+}
+
+func TestBuildTimeSeries_NoActivity(t *testing.T) {
+	series, err := buildTimeSeries(nil, Query{}, TimeSeriesOptions{Metric: MetricCommits, Bucket: BucketDay, Window: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []TimeSeries{{Key: TotalSeries, Metric: MetricCommits, Points: []TimeSeriesPoint{}}}, series)
+}
+
+func TestBuildTimeSeries_TooManyPeriods(t *testing.T) {
+	q := Query{From: time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)}
+
+	_, err := buildTimeSeries(timeSeriesRollups(), q, TimeSeriesOptions{Metric: MetricCommits, Bucket: BucketDay, Window: 1})
+
+	assert.ErrorIs(t, err, ErrTooManyPeriods)
+}
+
+func TestMetricTimeSeries(t *testing.T) {
+	docs := make([]interface{}, 0)
+	for _, rollup := range timeSeriesRollups() {
+		docs = append(docs, rollup)
+	}
+	rollupCollection := mockNamedCollection(t, db.RollupsCollection, docs)
+
+	series, err := MetricTimeSeries(context.Background(), Query{Author: "bob"}, TimeSeriesOptions{GroupBy: GroupByAuthor})
+	assert.NoError(t, err)
+
+	// Defaults to weekly commit counts.
+	assert.Equal(t, MetricCommits, series[0].Metric)
+	assert.Len(t, series[0].Points, 3)
+	rollupCollection.AssertCalled(t, "Find", mock.Anything, bson.M{"author": "bob"}, mock.Anything)
+}
+
+func TestParseTimeSeriesOptions(t *testing.T) {
+	opts, err := ParseTimeSeriesOptions("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, TimeSeriesOptions{Metric: MetricCommits}, opts)
+
+	_, err = ParseTimeSeriesOptions("karma", "")
+	assert.ErrorContains(t, err, "unknown time-series metric")
+
+	_, err = ParseTimeSeriesOptions("files_updated", "file")
+	assert.ErrorContains(t, err, "unknown time-series grouping")
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/telemetry"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// instrumentedCollection records the latency of every operation on a
+// collection.
+type instrumentedCollection struct {
+	CollectionInterface
+	name string
+}
+
+func (c *instrumentedCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	start := time.Now()
+	result, err := c.CollectionInterface.UpdateOne(ctx, filter, update, opts...)
+	telemetry.ObserveMongoOperation(c.name, "update_one", err, time.Since(start))
+	return result, err
+}
+
+func (c *instrumentedCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	start := time.Now()
+	result, err := c.CollectionInterface.UpdateMany(ctx, filter, update, opts...)
+	telemetry.ObserveMongoOperation(c.name, "update_many", err, time.Since(start))
+	return result, err
+}
+
+func (c *instrumentedCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	start := time.Now()
+	cursor, err := c.CollectionInterface.Find(ctx, filter, opts...)
+	telemetry.ObserveMongoOperation(c.name, "find", err, time.Since(start))
+	return cursor, err
+}
+
+func (c *instrumentedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	start := time.Now()
+	result, err := c.CollectionInterface.DeleteMany(ctx, filter, opts...)
+	telemetry.ObserveMongoOperation(c.name, "delete_many", err, time.Since(start))
+	return result, err
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestGetNamedCollection_RecordsLatency(t *testing.T) {
+	mockCollection := new(MockCollection)
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"reponame": "repo1"}, mock.Anything).Return(&mongo.DeleteResult{DeletedCount: 2}, nil)
+	mockCollection.On("Find", mock.Anything, bson.M{}, mock.Anything).Return(nil, errors.New("database unavailable"))
+
+	originalGetNamedCollectionFunc := GetNamedCollectionFunc
+	defer func() { GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	GetNamedCollectionFunc = func(name string) CollectionInterface {
+		return mockCollection
+	}
+
+	series := testutil.CollectAndCount(telemetry.MongoOperationDuration)
+	collection := GetNamedCollection("instrumented")
+	result, err := collection.DeleteMany(context.Background(), bson.M{"reponame": "repo1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.DeletedCount)
+	_, err = collection.Find(context.Background(), bson.M{})
+	assert.Error(t, err)
+
+	mockCollection.AssertExpectations(t)
+	// One series for the successful delete and one for the failed find.
+	assert.Equal(t, series+2, testutil.CollectAndCount(telemetry.MongoOperationDuration))
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -33,6 +35,13 @@ func (m *MongoClientWrapper) Database(name string, opts ...*options.DatabaseOpti
 // MongoClient holds the actual MongoDB client or a mock for testing.
 var MongoClient MongoClientInterface
 
+// mongoClientMu guards MongoClient while ReconnectMongoDB replaces it.
+var mongoClientMu sync.RWMutex
+
+// disconnectGracePeriod is how long a replaced client is kept open so
+// operations already using it can finish.
+var disconnectGracePeriod = 30 * time.Second
+
 // MongoConnectFuncType defines the function type for connecting to MongoDB.
 type MongoConnectFuncType func(ctx context.Context, uri string) (MongoClientInterface, error)
 
@@ -52,19 +61,88 @@ type CollectionGetterFunc func() CollectionInterface
 // GetCollectionFunc is a package-level variable holding the function to get a collection.
 var GetCollectionFunc CollectionGetterFunc = defaultGetCollection
 
+// Default names of the collections; see Names to store them under others.
+const (
+	CommitsCollection     = "git_metrics"
+	ReleasesCollection    = "releases"
+	DeploymentsCollection = "deployments"
+	RollupsCollection     = "daily_rollups"
+	TeamsCollection       = "teams"
+	AnomaliesCollection   = "anomalies"
+	MigrationsCollection  = "migrations"
+)
+
+// NamedCollectionGetterFunc is a function type for getting a collection by name.
+type NamedCollectionGetterFunc func(name string) CollectionInterface
+
+// GetNamedCollectionFunc is a package-level variable holding the function to get a collection by name.
+var GetNamedCollectionFunc NamedCollectionGetterFunc = defaultGetNamedCollection
+
 // CollectionInterface defines the methods to be mocked for MongoDB collection.
 type CollectionInterface interface {
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 }
 
-// defaultGetCollection returns the default collection.
+// defaultGetCollection returns the default collection, in the database
+// named by the context of each operation.
 func defaultGetCollection() CollectionInterface {
-	return MongoClient.Database("dashboard").Collection("git_metrics")
+	return &routedCollection{name: CommitsCollection}
+}
+
+// defaultGetNamedCollection returns the named collection, in the database
+// named by the context of each operation.
+func defaultGetNamedCollection(name string) CollectionInterface {
+	return &routedCollection{name: name}
+}
+
+// IndexCreatorFunc is a function type for creating indexes on a collection.
+type IndexCreatorFunc func(ctx context.Context, name string, models []mongo.IndexModel) error
+
+// CreateIndexesFunc is a package-level variable holding the function to create indexes.
+var CreateIndexesFunc IndexCreatorFunc = defaultCreateIndexes
+
+// defaultCreateIndexes creates the indexes on the named collection, in the
+// database named by the context. Indexes that already exist are left as is.
+func defaultCreateIndexes(ctx context.Context, name string, models []mongo.IndexModel) error {
+	_, err := (&routedCollection{name: name}).collection(ctx).Indexes().CreateMany(ctx, models)
+	return err
+}
+
+// IndexDropperFunc is a function type for dropping an index of a collection.
+type IndexDropperFunc func(ctx context.Context, name string, index string) error
+
+// DropIndexFunc is a package-level variable holding the function to drop an index.
+var DropIndexFunc IndexDropperFunc = defaultDropIndex
+
+// defaultDropIndex drops the named index of the collection, in the database
+// named by the context. An index or collection that doesn't exist isn't an
+// error.
+func defaultDropIndex(ctx context.Context, name string, index string) error {
+	_, err := (&routedCollection{name: name}).collection(ctx).Indexes().DropOne(ctx, index)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == indexNotFoundCode || commandErr.Code == namespaceNotFoundCode) {
+		return nil
+	}
+	return err
 }
 
+// Codes of the MongoDB server errors defaultDropIndex ignores.
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
 // GetCollection returns a collection from the MongoDB database.
 func GetCollection() CollectionInterface {
-	return GetCollectionFunc()
+	return &instrumentedCollection{CollectionInterface: GetCollectionFunc(), name: CommitsCollection}
+}
+
+// GetNamedCollection returns the named collection from the MongoDB database.
+func GetNamedCollection(name string) CollectionInterface {
+	return &instrumentedCollection{CollectionInterface: GetNamedCollectionFunc(name), name: name}
 }
 
 // MockCollection is a mock type for the mongo.Collection used for testing.
@@ -77,6 +155,24 @@ func (m *MockCollection) UpdateOne(ctx context.Context, filter interface{}, upda
 	return args.Get(0).(*mongo.UpdateResult), args.Error(1)
 }
 
+func (m *MockCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	args := m.Called(ctx, filter, update, opts)
+	return args.Get(0).(*mongo.UpdateResult), args.Error(1)
+}
+
+func (m *MockCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	args := m.Called(ctx, filter, opts)
+	if args.Get(0) != nil {
+		return args.Get(0).(*mongo.Cursor), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	args := m.Called(ctx, filter, opts)
+	return args.Get(0).(*mongo.DeleteResult), args.Error(1)
+}
+
 // MockDatabase is a mock type for the mongo.Database used for testing.
 type MockDatabase struct {
 	mock.Mock
@@ -118,3 +214,35 @@ func InitializeMongoDB(uri string) error {
 	log.Println("Connected to MongoDB successfully")
 	return nil
 }
+
+// ReconnectMongoDB connects to uri and, once the new client answers a ping,
+// replaces MongoClient with it. The previous client is disconnected after a
+// grace period. On error the previous client is kept.
+func ReconnectMongoDB(uri string) error {
+	client, err := DefaultMongoConnectFunc(context.Background(), uri)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		return err
+	}
+
+	mongoClientMu.Lock()
+	previous := MongoClient
+	MongoClient = client
+	mongoClientMu.Unlock()
+
+	if wrapper, ok := previous.(*MongoClientWrapper); ok && wrapper.Client != nil {
+		time.AfterFunc(disconnectGracePeriod, func() {
+			if err := wrapper.Client.Disconnect(context.Background()); err != nil {
+				log.Printf("Failed to disconnect the previous MongoDB client: %v", err)
+			}
+		})
+	}
+
+	log.Println("Reconnected to MongoDB successfully")
+	return nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"sync"
+)
+
+// Names are the names databases and collections are stored under.
+type Names struct {
+	// Database is used when the context names none; DefaultDatabase if empty.
+	Database string
+	// Prefix is prepended to the name of every database, so several
+	// deployments can share a cluster.
+	Prefix string
+	// Collections maps the default name of a collection, e.g.
+	// ReleasesCollection, to the name it is stored under.
+	Collections map[string]string
+}
+
+var (
+	namesMu sync.RWMutex
+	names   Names
+)
+
+// SetNames sets the names used by the collections returned by GetCollection
+// and GetNamedCollection.
+func SetNames(n Names) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	names = n
+}
+
+// DatabaseName returns the name of the database the context's operations
+// are stored in, with the prefix applied.
+func DatabaseName(ctx context.Context) string {
+	database := DatabaseFrom(ctx)
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return names.Prefix + database
+}
+
+// CollectionName returns the name the collection is stored under.
+func CollectionName(name string) string {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	if stored, ok := names.Collections[name]; ok && stored != "" {
+		return stored
+	}
+	return name
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestNames(t *testing.T) {
+	defer SetNames(Names{})
+	SetNames(Names{
+		Database:    "metrics",
+		Prefix:      "staging_",
+		Collections: map[string]string{CommitsCollection: "commits", ReleasesCollection: ""},
+	})
+
+	assert.Equal(t, "metrics", DatabaseFrom(context.Background()))
+	assert.Equal(t, "staging_metrics", DatabaseName(context.Background()))
+	assert.Equal(t, "staging_payments", DatabaseName(WithDatabase(context.Background(), "payments")))
+	assert.Equal(t, "commits", CollectionName(CommitsCollection))
+	assert.Equal(t, ReleasesCollection, CollectionName(ReleasesCollection))
+	assert.Equal(t, TeamsCollection, CollectionName(TeamsCollection))
+}
+
+func TestRoutedCollection_UsesNames(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	assert.NoError(t, err)
+	originalClient := MongoClient
+	defer func() { MongoClient = originalClient }()
+	MongoClient = &MongoClientWrapper{Client: client}
+	defer SetNames(Names{})
+	SetNames(Names{Prefix: "staging_", Collections: map[string]string{CommitsCollection: "commits"}})
+
+	resolved := defaultGetCollection().(*routedCollection).collection(context.Background())
+	assert.Equal(t, "staging_"+DefaultDatabase, resolved.Database().Name())
+	assert.Equal(t, "commits", resolved.Name())
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultDatabase is the database used when the context names none.
+const DefaultDatabase = "dashboard"
+
+type databaseKey struct{}
+
+// WithDatabase returns a context whose collection operations use the named
+// database, keeping the data of each tenant in its own database.
+func WithDatabase(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, databaseKey{}, name)
+}
+
+// DatabaseFrom returns the database named by the context, or the database
+// set by SetNames, or DefaultDatabase. The prefix isn't applied; see
+// DatabaseName.
+func DatabaseFrom(ctx context.Context) string {
+	if name, ok := ctx.Value(databaseKey{}).(string); ok && name != "" {
+		return name
+	}
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	if names.Database != "" {
+		return names.Database
+	}
+	return DefaultDatabase
+}
+
+// routedCollection resolves the database of every operation from its
+// context, so one collection value serves every tenant. name is the default
+// name of the collection; see CollectionName.
+type routedCollection struct {
+	name string
+}
+
+func (c *routedCollection) collection(ctx context.Context) *mongo.Collection {
+	mongoClientMu.RLock()
+	defer mongoClientMu.RUnlock()
+	return MongoClient.Database(DatabaseName(ctx)).Collection(CollectionName(c.name))
+}
+
+func (c *routedCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.collection(ctx).UpdateOne(ctx, filter, update, opts...)
+}
+
+func (c *routedCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.collection(ctx).UpdateMany(ctx, filter, update, opts...)
+}
+
+func (c *routedCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	return c.collection(ctx).Find(ctx, filter, opts...)
+}
+
+func (c *routedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.collection(ctx).DeleteMany(ctx, filter, opts...)
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestDatabaseFrom(t *testing.T) {
+	assert.Equal(t, DefaultDatabase, DatabaseFrom(context.Background()))
+	assert.Equal(t, "payments", DatabaseFrom(WithDatabase(context.Background(), "payments")))
+	assert.Equal(t, DefaultDatabase, DatabaseFrom(WithDatabase(context.Background(), "")))
+}
+
+func TestRoutedCollection_UsesDatabaseOfContext(t *testing.T) {
+	// Connecting doesn't reach the server until the first operation.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	assert.NoError(t, err)
+	originalClient := MongoClient
+	defer func() { MongoClient = originalClient }()
+	MongoClient = &MongoClientWrapper{Client: client}
+
+	collection := defaultGetNamedCollection(ReleasesCollection).(*routedCollection)
+
+	resolved := collection.collection(WithDatabase(context.Background(), "payments"))
+	assert.Equal(t, "payments", resolved.Database().Name())
+	assert.Equal(t, "releases", resolved.Name())
+	assert.Equal(t, DefaultDatabase, collection.collection(context.Background()).Database().Name())
+}
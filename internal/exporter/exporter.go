@@ -0,0 +1,226 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/analytics"
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Windows are the trailing windows the exporter reports, in days. A window of
+// n days covers today and the n-1 UTC days before it.
+var Windows = []int{1, 7, 30}
+
+// DefaultMaxLabels is the default number of repositories and of authors
+// exported with their own label value.
+const DefaultMaxLabels = 50
+
+// DefaultCacheTTL is how long computed metrics are served before the stored
+// data is read again.
+const DefaultCacheTTL = 5 * time.Minute
+
+// OtherLabel is the label value the repositories and authors beyond the
+// label limit are summed under. It is chosen not to look like a repository
+// or author name; one that is named OtherLabel all the same is collapsed,
+// since it couldn't be told apart from the sum.
+const OtherLabel = "__other__"
+
+// LoadRollupsFunc reads the daily rollups; a variable so tests can swap it.
+var LoadRollupsFunc = analytics.LoadRollups
+
+// Options control the cardinality and freshness of the exported metrics,
+// and the database they are read from. Zero values use the defaults.
+type Options struct {
+	MaxLabels int
+	CacheTTL  time.Duration
+	Database  string
+}
+
+var (
+	commitsDesc = prometheus.NewDesc("git_metrics_commits",
+		"Commits over the trailing window.", []string{"dimension", "key", "window"}, nil)
+	linesAddedDesc = prometheus.NewDesc("git_metrics_lines_added",
+		"Lines added over the trailing window.", []string{"dimension", "key", "window"}, nil)
+	linesDeletedDesc = prometheus.NewDesc("git_metrics_lines_deleted",
+		"Lines deleted over the trailing window.", []string{"dimension", "key", "window"}, nil)
+	collapsedDesc = prometheus.NewDesc("git_metrics_export_collapsed_keys",
+		"Repositories or authors summed under the other label because of the label limit.", []string{"dimension"}, nil)
+)
+
+// sample is one exported value set.
+type sample struct {
+	dimension, key, window  string
+	commits, added, deleted int
+}
+
+// snapshot is the computed metrics served from the cache.
+type snapshot struct {
+	samples   []sample
+	collapsed map[string]int
+}
+
+// Collector exports commit and line counts per repository and per author
+// over trailing windows, computed from the daily rollups. Results are cached
+// so frequent scrapes don't query MongoDB each time.
+type Collector struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	cached  *snapshot
+	expires time.Time
+}
+
+// NewCollector returns a collector with the given options.
+func NewCollector(opts Options) *Collector {
+	if opts.MaxLabels <= 0 {
+		opts.MaxLabels = DefaultMaxLabels
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	return &Collector{opts: opts, now: time.Now}
+}
+
+// Handler serves the collector's metrics in the Prometheus text format.
+func Handler(c *Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- commitsDesc
+	ch <- linesAddedDesc
+	ch <- linesDeletedDesc
+	ch <- collapsedDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	snap, err := c.snapshot(db.WithDatabase(context.Background(), c.opts.Database))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(commitsDesc, err)
+		return
+	}
+
+	for _, s := range snap.samples {
+		ch <- prometheus.MustNewConstMetric(commitsDesc, prometheus.GaugeValue, float64(s.commits), s.dimension, s.key, s.window)
+		ch <- prometheus.MustNewConstMetric(linesAddedDesc, prometheus.GaugeValue, float64(s.added), s.dimension, s.key, s.window)
+		ch <- prometheus.MustNewConstMetric(linesDeletedDesc, prometheus.GaugeValue, float64(s.deleted), s.dimension, s.key, s.window)
+	}
+	for dimension, count := range snap.collapsed {
+		ch <- prometheus.MustNewConstMetric(collapsedDesc, prometheus.GaugeValue, float64(count), dimension)
+	}
+}
+
+// snapshot returns the cached metrics, computing them when the cache has
+// expired. When computing fails the previous metrics are kept, if any.
+func (c *Collector) snapshot(ctx context.Context) (*snapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.cached != nil && now.Before(c.expires) {
+		return c.cached, nil
+	}
+
+	today := gitmetrics.RollupDay(now)
+	longest := Windows[len(Windows)-1]
+	rollups, err := LoadRollupsFunc(ctx, analytics.Query{From: today.AddDate(0, 0, 1-longest)})
+	if err != nil {
+		if c.cached != nil {
+			return c.cached, nil
+		}
+		return nil, fmt.Errorf("failed to load rollups: %w", err)
+	}
+
+	c.cached = buildSnapshot(rollups, today, c.opts.MaxLabels)
+	c.expires = now.Add(c.opts.CacheTTL)
+	return c.cached, nil
+}
+
+// buildSnapshot sums the rollups per repository and author for every window.
+// Only the maxLabels repositories and authors with the most commits over the
+// longest window keep their own label; the others are summed under
+// OtherLabel.
+func buildSnapshot(rollups []gitmetrics.DailyRollup, today time.Time, maxLabels int) *snapshot {
+	snap := &snapshot{collapsed: make(map[string]int)}
+	dimensions := map[string]func(gitmetrics.DailyRollup) string{
+		"repo":   func(r gitmetrics.DailyRollup) string { return gitmetrics.FullName(r.Owner, r.RepoName) },
+		"author": func(r gitmetrics.DailyRollup) string { return r.Author },
+	}
+
+	for _, dimension := range []string{"repo", "author"} {
+		keyOf := dimensions[dimension]
+
+		totals := make(map[string]int)
+		for _, rollup := range rollups {
+			totals[keyOf(rollup)] += rollup.Commits
+		}
+		keys := make([]string, 0, len(totals))
+		for key := range totals {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if totals[keys[i]] != totals[keys[j]] {
+				return totals[keys[i]] > totals[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		kept := make(map[string]bool)
+		for _, key := range keys {
+			if len(kept) < maxLabels && key != OtherLabel {
+				kept[key] = true
+			}
+		}
+		snap.collapsed[dimension] = len(keys) - len(kept)
+
+		for _, days := range Windows {
+			window := fmt.Sprintf("%dd", days)
+			since := today.AddDate(0, 0, 1-days)
+
+			sums := make(map[string]*sample)
+			for key := range kept {
+				sums[key] = &sample{dimension: dimension, key: key, window: window}
+			}
+			var other *sample
+			if len(kept) < len(keys) {
+				other = &sample{dimension: dimension, key: OtherLabel, window: window}
+			}
+			for _, rollup := range rollups {
+				if rollup.Day.Before(since) {
+					continue
+				}
+				s := sums[keyOf(rollup)]
+				if !kept[keyOf(rollup)] {
+					s = other
+				}
+				s.commits += rollup.Commits
+				s.added += rollup.LinesAdded
+				s.deleted += rollup.LinesDeleted
+			}
+
+			labels := make([]string, 0, len(sums))
+			for label := range sums {
+				labels = append(labels, label)
+			}
+			sort.Strings(labels)
+			for _, label := range labels {
+				snap.samples = append(snap.samples, *sums[label])
+			}
+			if other != nil {
+				snap.samples = append(snap.samples, *other)
+			}
+		}
+	}
+
+	return snap
+}
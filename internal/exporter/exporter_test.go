@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/analytics"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC)
+
+func exporterRollups() []gitmetrics.DailyRollup {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	return []gitmetrics.DailyRollup{
+		{RepoName: "repo1", Author: "alice", Day: day(31), Commits: 2, LinesAdded: 10, LinesDeleted: 1},
+		{RepoName: "repo1", Author: "bob", Day: day(26), Commits: 1, LinesAdded: 5},
+		{RepoName: "repo2", Author: "alice", Day: day(10), Commits: 4, LinesAdded: 40, LinesDeleted: 4},
+		{RepoName: "repo3", Author: "carol", Day: day(5), Commits: 1, LinesAdded: 1},
+	}
+}
+
+func findSample(snap *snapshot, dimension, key, window string) *sample {
+	for i, s := range snap.samples {
+		if s.dimension == dimension && s.key == key && s.window == window {
+			return &snap.samples[i]
+		}
+	}
+	return nil
+}
+
+func TestBuildSnapshot_Windows(t *testing.T) {
+	snap := buildSnapshot(exporterRollups(), gitmetrics.RollupDay(now), 10)
+
+	assert.Equal(t, &sample{dimension: "repo", key: "repo1", window: "1d", commits: 2, added: 10, deleted: 1}, findSample(snap, "repo", "repo1", "1d"))
+	assert.Equal(t, 3, findSample(snap, "repo", "repo1", "7d").commits)
+	assert.Equal(t, 6, findSample(snap, "author", "alice", "30d").commits)
+	// Keys without activity in a window are exported as 0 so series don't vanish.
+	assert.Equal(t, 0, findSample(snap, "repo", "repo2", "7d").commits)
+	assert.Equal(t, map[string]int{"repo": 0, "author": 0}, snap.collapsed)
+}
+
+func TestBuildSnapshot_CollapsesBeyondLabelLimit(t *testing.T) {
+	snap := buildSnapshot(exporterRollups(), gitmetrics.RollupDay(now), 2)
+
+	assert.Nil(t, findSample(snap, "repo", "repo3", "30d"))
+	assert.Equal(t, 1, findSample(snap, "repo", OtherLabel, "30d").commits)
+	// bob and carol tie on commits; the tie is broken by name.
+	assert.NotNil(t, findSample(snap, "author", "bob", "30d"))
+	assert.Equal(t, 1, findSample(snap, "author", OtherLabel, "30d").commits)
+	assert.Equal(t, map[string]int{"repo": 1, "author": 1}, snap.collapsed)
+}
+
+func TestBuildSnapshot_KeyNamedLikeOverflow(t *testing.T) {
+	day := gitmetrics.RollupDay(now)
+	rollups := []gitmetrics.DailyRollup{
+		{RepoName: OtherLabel, Author: "alice", Day: day, Commits: 5},
+		{RepoName: "repo1", Author: "alice", Day: day, Commits: 3},
+		{RepoName: "repo2", Author: "alice", Day: day, Commits: 1},
+	}
+
+	snap := buildSnapshot(rollups, day, 2)
+
+	var others []int
+	for _, s := range snap.samples {
+		if s.dimension == "repo" && s.key == OtherLabel && s.window == "1d" {
+			others = append(others, s.commits)
+		}
+	}
+	// The repository named like the overflow is collapsed into it rather
+	// than exported as a second series with the same labels.
+	assert.Equal(t, []int{5}, others)
+	assert.Equal(t, 3, findSample(snap, "repo", "repo1", "1d").commits)
+	assert.Equal(t, 1, findSample(snap, "repo", "repo2", "1d").commits)
+	assert.Equal(t, 1, snap.collapsed["repo"])
+}
+
+func TestBuildSnapshot_ForkKeptApart(t *testing.T) {
+	day := gitmetrics.RollupDay(now)
+	rollups := []gitmetrics.DailyRollup{
+		{Owner: "acme", RepoName: "repo1", Author: "alice", Day: day, Commits: 2},
+		{Owner: "fork", RepoName: "repo1", Author: "alice", Day: day, Commits: 2},
+	}
+
+	snap := buildSnapshot(rollups, day, 10)
+
+	assert.Equal(t, 2, findSample(snap, "repo", "acme/repo1", "1d").commits)
+	assert.Equal(t, 2, findSample(snap, "repo", "fork/repo1", "1d").commits)
+	assert.Nil(t, findSample(snap, "repo", "repo1", "1d"))
+}
+
+func TestHandler_CachesAndKeepsStaleMetricsOnError(t *testing.T) {
+	original := LoadRollupsFunc
+	defer func() { LoadRollupsFunc = original }()
+
+	calls := 0
+	var loadErr error
+	var from time.Time
+	LoadRollupsFunc = func(ctx context.Context, q analytics.Query) ([]gitmetrics.DailyRollup, error) {
+		calls++
+		from = q.From
+		return exporterRollups(), loadErr
+	}
+
+	collector := NewCollector(Options{CacheTTL: time.Minute})
+	collector.now = func() time.Time { return now }
+	handler := Handler(collector)
+
+	scrape := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/git", nil))
+		return rec
+	}
+
+	rec := scrape()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `git_metrics_commits{dimension="repo",key="repo1",window="7d"} 3`)
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), from)
+
+	scrape()
+	assert.Equal(t, 1, calls)
+
+	collector.now = func() time.Time { return now.Add(2 * time.Minute) }
+	loadErr = errors.New("mongo down")
+	rec = scrape()
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), `key="repo1"`))
+}
+
+func TestHandler_ErrorWithoutCache(t *testing.T) {
+	original := LoadRollupsFunc
+	defer func() { LoadRollupsFunc = original }()
+	LoadRollupsFunc = func(ctx context.Context, q analytics.Query) ([]gitmetrics.DailyRollup, error) {
+		return nil, errors.New("mongo down")
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(NewCollector(Options{})).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/git", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,61 @@
+package gitmetrics
+
+import (
+	"github.com/machinebox/graphql"
+)
+
+// FetchCodeOwners returns the path and content of the CODEOWNERS file on the
+// default branch of a repository, looking in the same locations as GitHub and
+// in the same order. Both are empty when the repository has no CODEOWNERS.
+func FetchCodeOwners(client GraphQLClient, user, repo, token string) (string, string, error) {
+	req := graphql.NewRequest(`
+		query($user: String!, $repo: String!) {
+			repository(owner: $user, name: $repo) {
+				github: object(expression: "HEAD:.github/CODEOWNERS") {
+					... on Blob {
+						text
+					}
+				}
+				root: object(expression: "HEAD:CODEOWNERS") {
+					... on Blob {
+						text
+					}
+				}
+				docs: object(expression: "HEAD:docs/CODEOWNERS") {
+					... on Blob {
+						text
+					}
+				}
+			}
+		}
+	`)
+
+	req.Var("user", user)
+	req.Var("repo", repo)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	type blob struct {
+		Text string `json:"text"`
+	}
+	var respData struct {
+		Repository struct {
+			GitHub *blob `json:"github"`
+			Root   *blob `json:"root"`
+			Docs   *blob `json:"docs"`
+		} `json:"repository"`
+	}
+
+	if err := runGraphQL(client, "codeowners", req, &respData); err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case respData.Repository.GitHub != nil:
+		return ".github/CODEOWNERS", respData.Repository.GitHub.Text, nil
+	case respData.Repository.Root != nil:
+		return "CODEOWNERS", respData.Repository.Root.Text, nil
+	case respData.Repository.Docs != nil:
+		return "docs/CODEOWNERS", respData.Repository.Docs.Text, nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,37 @@
+package gitmetrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFetchCodeOwners_Precedence(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"github":null,"root":{"text":"* @alice\n"},"docs":{"text":"* @bob\n"}}}`)
+
+	path, content, err := FetchCodeOwners(mockClient, "user", "repo", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "CODEOWNERS", path)
+	assert.Equal(t, "* @alice\n", content)
+}
+
+func TestFetchCodeOwners_Missing(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"github":null,"root":null,"docs":null}}`)
+
+	path, content, err := FetchCodeOwners(mockClient, "user", "repo", "token")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Empty(t, content)
+}
+
+func TestFetchCodeOwners_Error(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("graphql error"))
+
+	_, _, err := FetchCodeOwners(mockClient, "user", "repo", "token")
+	assert.EqualError(t, err, "graphql error")
+}
@@ -0,0 +1,88 @@
+package gitmetrics
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	conventionalHeaderRegex = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: (.+)$`)
+	conventionalFooterRegex = regexp.MustCompile(`^(BREAKING CHANGE|BREAKING-CHANGE|[A-Za-z][A-Za-z-]*)(?:: | #)(.*)$`)
+)
+
+// ParseConventionalCommit splits a commit message into the parts defined by
+// the Conventional Commits specification. Messages that don't follow the
+// specification are returned with an empty Type and the first line as Subject.
+func ParseConventionalCommit(message string) ConventionalCommit {
+	message = strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n"))
+	header, rest, _ := strings.Cut(message, "\n")
+
+	parsed := ConventionalCommit{Subject: strings.TrimSpace(header)}
+	match := conventionalHeaderRegex.FindStringSubmatch(parsed.Subject)
+	if match == nil {
+		parsed.Body = strings.TrimSpace(rest)
+		return parsed
+	}
+
+	parsed.Type = strings.ToLower(match[1])
+	parsed.Scope = strings.TrimSpace(match[2])
+	parsed.Breaking = match[3] == "!"
+	parsed.Subject = strings.TrimSpace(match[4])
+
+	paragraphs := splitParagraphs(rest)
+	if len(paragraphs) > 0 {
+		if footers, ok := parseFooters(paragraphs[len(paragraphs)-1]); ok {
+			parsed.Footers = footers
+			paragraphs = paragraphs[:len(paragraphs)-1]
+		}
+	}
+	parsed.Body = strings.Join(paragraphs, "\n\n")
+
+	for _, footer := range parsed.Footers {
+		if footer.Token == "BREAKING CHANGE" || footer.Token == "BREAKING-CHANGE" {
+			parsed.Breaking = true
+		}
+	}
+
+	return parsed
+}
+
+// BreakingDescription returns the text of the BREAKING CHANGE footer, if any.
+func (c ConventionalCommit) BreakingDescription() string {
+	for _, footer := range c.Footers {
+		if footer.Token == "BREAKING CHANGE" || footer.Token == "BREAKING-CHANGE" {
+			return footer.Value
+		}
+	}
+	return ""
+}
+
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// parseFooters parses the trailing paragraph of a message as footers. It only
+// succeeds when the paragraph starts with a footer token; following lines that
+// aren't footers themselves are treated as continuations of the previous value.
+func parseFooters(paragraph string) ([]Footer, bool) {
+	var footers []Footer
+	for _, line := range strings.Split(paragraph, "\n") {
+		if match := conventionalFooterRegex.FindStringSubmatch(line); match != nil {
+			footers = append(footers, Footer{Token: match[1], Value: strings.TrimSpace(match[2])})
+			continue
+		}
+		if len(footers) == 0 {
+			return nil, false
+		}
+		last := &footers[len(footers)-1]
+		last.Value = strings.TrimSpace(last.Value + "\n" + line)
+	}
+	return footers, len(footers) > 0
+}
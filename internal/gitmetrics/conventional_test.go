@@ -0,0 +1,62 @@
+package gitmetrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConventionalCommit_Header(t *testing.T) {
+	parsed := ParseConventionalCommit("feat(api): add commit type counts")
+	assert.Equal(t, "feat", parsed.Type)
+	assert.Equal(t, "api", parsed.Scope)
+	assert.False(t, parsed.Breaking)
+	assert.Equal(t, "add commit type counts", parsed.Subject)
+	assert.Empty(t, parsed.Body)
+	assert.Empty(t, parsed.Footers)
+}
+
+func TestParseConventionalCommit_BreakingMarker(t *testing.T) {
+	parsed := ParseConventionalCommit("Refactor!: drop the v1 endpoints")
+	assert.Equal(t, "refactor", parsed.Type)
+	assert.Empty(t, parsed.Scope)
+	assert.True(t, parsed.Breaking)
+	assert.Equal(t, "drop the v1 endpoints", parsed.Subject)
+}
+
+func TestParseConventionalCommit_BodyAndFooters(t *testing.T) {
+	message := "fix(db): retry upserts\r\n\r\nThe first paragraph.\n\nThe second paragraph.\n\nRefs: #12\nBREAKING CHANGE: upserts now\n  require an index\nReviewed-by: Jane"
+	parsed := ParseConventionalCommit(message)
+
+	assert.Equal(t, "fix", parsed.Type)
+	assert.Equal(t, "db", parsed.Scope)
+	assert.True(t, parsed.Breaking)
+	assert.Equal(t, "The first paragraph.\n\nThe second paragraph.", parsed.Body)
+	assert.Equal(t, []Footer{
+		{Token: "Refs", Value: "#12"},
+		{Token: "BREAKING CHANGE", Value: "upserts now\n  require an index"},
+		{Token: "Reviewed-by", Value: "Jane"},
+	}, parsed.Footers)
+	assert.Equal(t, "upserts now\n  require an index", parsed.BreakingDescription())
+}
+
+func TestParseConventionalCommit_IssueFooter(t *testing.T) {
+	parsed := ParseConventionalCommit("fix: handle empty repos\n\nCloses #42")
+	assert.Empty(t, parsed.Body)
+	assert.Equal(t, []Footer{{Token: "Closes", Value: "42"}}, parsed.Footers)
+}
+
+func TestParseConventionalCommit_BodyIsNotFooter(t *testing.T) {
+	parsed := ParseConventionalCommit("docs: explain setup\n\nThis is a sentence: with a colon.")
+	assert.Equal(t, "This is a sentence: with a colon.", parsed.Body)
+	assert.Empty(t, parsed.Footers)
+	assert.Empty(t, parsed.BreakingDescription())
+}
+
+func TestParseConventionalCommit_Unconventional(t *testing.T) {
+	parsed := ParseConventionalCommit("Merge pull request #7 from user/branch\n\nAdd things")
+	assert.Empty(t, parsed.Type)
+	assert.False(t, parsed.Breaking)
+	assert.Equal(t, "Merge pull request #7 from user/branch", parsed.Subject)
+	assert.Equal(t, "Add things", parsed.Body)
+}
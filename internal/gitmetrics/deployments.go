@@ -0,0 +1,209 @@
+package gitmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/machinebox/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deploymentStates maps the final GitHub deployment states to our statuses.
+// INACTIVE deployments were successful and have since been superseded.
+// Deployments still queued or in progress are not recorded yet.
+var deploymentStates = map[string]string{
+	"SUCCESS":  DeploymentSuccess,
+	"INACTIVE": DeploymentSuccess,
+	"FAILURE":  DeploymentFailure,
+	"ERROR":    DeploymentFailure,
+}
+
+// FetchDeployments returns the finished GitHub deployments of a repository.
+func FetchDeployments(client GraphQLClient, user, repo, token string) ([]Deployment, error) {
+	var deployments []Deployment
+	var cursor *string
+
+	for {
+		req := graphql.NewRequest(`
+			query($user: String!, $repo: String!, $cursor: String) {
+				repository(owner: $user, name: $repo) {
+					deployments(first: 100, after: $cursor, orderBy: {field: CREATED_AT, direction: ASC}) {
+						nodes {
+							id
+							environment
+							commitOid
+							createdAt
+							latestStatus {
+								state
+								createdAt
+							}
+						}
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
+					}
+				}
+			}
+		`)
+
+		req.Var("user", user)
+		req.Var("repo", repo)
+		req.Var("cursor", cursor)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		var respData struct {
+			Repository struct {
+				Deployments struct {
+					Nodes []struct {
+						ID           string    `json:"id"`
+						Environment  string    `json:"environment"`
+						CommitOid    string    `json:"commitOid"`
+						CreatedAt    time.Time `json:"createdAt"`
+						LatestStatus *struct {
+							State     string    `json:"state"`
+							CreatedAt time.Time `json:"createdAt"`
+						} `json:"latestStatus"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"deployments"`
+			} `json:"repository"`
+		}
+
+		if err := runGraphQL(client, "deployments", req, &respData); err != nil {
+			return nil, err
+		}
+
+		for _, node := range respData.Repository.Deployments.Nodes {
+			if node.LatestStatus == nil {
+				continue
+			}
+			status, ok := deploymentStates[node.LatestStatus.State]
+			if !ok {
+				continue
+			}
+			deployments = append(deployments, Deployment{
+				DeploymentID: node.ID,
+				Owner:        user,
+				RepoName:     repo,
+				Environment:  node.Environment,
+				CommitID:     node.CommitOid,
+				Status:       status,
+				Source:       DeploymentSourceGitHub,
+				CreatedAt:    node.CreatedAt,
+				FinishedAt:   node.LatestStatus.CreatedAt,
+			})
+		}
+
+		if !respData.Repository.Deployments.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &respData.Repository.Deployments.PageInfo.EndCursor
+	}
+
+	return deployments, nil
+}
+
+// ValidateDeployment checks a deployment pushed by a CD system and fills in
+// the defaults for optional fields.
+func ValidateDeployment(deployment *Deployment) error {
+	var errs []error
+	if deployment.RepoName == "" {
+		errs = append(errs, errors.New("repo is required"))
+	}
+	if deployment.CommitID == "" {
+		errs = append(errs, errors.New("commit_id is required"))
+	}
+	if deployment.Status != DeploymentSuccess && deployment.Status != DeploymentFailure {
+		errs = append(errs, fmt.Errorf("status must be %q or %q", DeploymentSuccess, DeploymentFailure))
+	}
+	if deployment.FinishedAt.IsZero() {
+		errs = append(errs, errors.New("finished_at is required"))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if deployment.Environment == "" {
+		deployment.Environment = "production"
+	}
+	if deployment.CreatedAt.IsZero() {
+		deployment.CreatedAt = deployment.FinishedAt
+	}
+	if deployment.DeploymentID == "" {
+		deployment.DeploymentID = fmt.Sprintf("%s/%s/%s/%d", deployment.RepoName, deployment.Environment,
+			deployment.CommitID, deployment.FinishedAt.Unix())
+	}
+	deployment.Source = DeploymentSourceAPI
+
+	return nil
+}
+
+// CommitOwners returns the owners whose stored copy of a repository holds
+// the given commit, in the order they are found. A commit shared by a fork
+// and its upstream has several owners.
+func CommitOwners(ctx context.Context, repo, commitID string) ([]string, error) {
+	cursor, err := db.GetCollection().Find(ctx, bson.M{"reponame": repo, "commit_id": commitID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commit %s: %w", commitID, err)
+	}
+	var commits []Commit
+	if err := cursor.All(ctx, &commits); err != nil {
+		return nil, fmt.Errorf("failed to decode commit %s: %w", commitID, err)
+	}
+
+	var owners []string
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		if !seen[commit.Owner] {
+			seen[commit.Owner] = true
+			owners = append(owners, commit.Owner)
+		}
+	}
+	return owners, nil
+}
+
+// SaveDeploymentsToDB stores deployments, replacing earlier versions of the
+// same deployment so status changes are picked up. A deployment stored
+// before owners were recorded is claimed by the first owner to save it again.
+func SaveDeploymentsToDB(ctx context.Context, deployments []Deployment) error {
+	collection := db.GetNamedCollection(db.DeploymentsCollection)
+
+	var repositories []repository
+	ids := make(map[repository][]string)
+	for _, deployment := range deployments {
+		key := repository{deployment.Owner, deployment.RepoName}
+		if key.owner == "" {
+			continue
+		}
+		if _, ok := ids[key]; !ok {
+			repositories = append(repositories, key)
+		}
+		ids[key] = append(ids[key], deployment.DeploymentID)
+	}
+	for _, repo := range repositories {
+		filter := bson.M{"owner": "", "reponame": repo.name, "deployment_id": bson.M{"$in": ids[repo]}}
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"owner": repo.owner}}); err != nil {
+			return fmt.Errorf("failed to claim deployments of %s/%s: %w", repo.owner, repo.name, err)
+		}
+	}
+
+	for _, deployment := range deployments {
+		filter := bson.M{"owner": deployment.Owner, "reponame": deployment.RepoName, "deployment_id": deployment.DeploymentID}
+		update := bson.M{"$set": deployment}
+		opts := options.Update().SetUpsert(true)
+		_, err := collection.UpdateOne(ctx, filter, update, opts)
+		if err != nil {
+			return fmt.Errorf("failed to update deployment: %w", err)
+		}
+	}
+
+	return nil
+}
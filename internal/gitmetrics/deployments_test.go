@@ -0,0 +1,137 @@
+package gitmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFetchDeployments_Success(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"deployments":{"nodes":[
+		{"id":"D1","environment":"production","commitOid":"aaa","createdAt":"2024-01-01T10:00:00Z","latestStatus":{"state":"INACTIVE","createdAt":"2024-01-01T10:05:00Z"}},
+		{"id":"D2","environment":"production","commitOid":"bbb","createdAt":"2024-01-02T10:00:00Z","latestStatus":{"state":"ERROR","createdAt":"2024-01-02T10:05:00Z"}},
+		{"id":"D3","environment":"production","commitOid":"ccc","createdAt":"2024-01-03T10:00:00Z","latestStatus":{"state":"IN_PROGRESS","createdAt":"2024-01-03T10:01:00Z"}},
+		{"id":"D4","environment":"staging","commitOid":"ddd","createdAt":"2024-01-04T10:00:00Z"}
+	],"pageInfo":{"hasNextPage":false}}}}`)
+
+	deployments, err := FetchDeployments(mockClient, "user", "repo", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, []Deployment{
+		{
+			DeploymentID: "D1",
+			Owner:        "user",
+			RepoName:     "repo",
+			Environment:  "production",
+			CommitID:     "aaa",
+			Status:       DeploymentSuccess,
+			Source:       DeploymentSourceGitHub,
+			CreatedAt:    time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			FinishedAt:   time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC),
+		},
+		{
+			DeploymentID: "D2",
+			Owner:        "user",
+			RepoName:     "repo",
+			Environment:  "production",
+			CommitID:     "bbb",
+			Status:       DeploymentFailure,
+			Source:       DeploymentSourceGitHub,
+			CreatedAt:    time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+			FinishedAt:   time.Date(2024, 1, 2, 10, 5, 0, 0, time.UTC),
+		},
+	}, deployments)
+}
+
+func TestFetchDeployments_Error(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("failed to fetch deployments"))
+
+	deployments, err := FetchDeployments(mockClient, "user", "repo", "token")
+	assert.Error(t, err)
+	assert.Nil(t, deployments)
+}
+
+func TestValidateDeployment_Defaults(t *testing.T) {
+	finished := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	deployment := Deployment{RepoName: "repo1", CommitID: "abc", Status: DeploymentSuccess, FinishedAt: finished, Source: "anything"}
+
+	assert.NoError(t, ValidateDeployment(&deployment))
+	assert.Equal(t, "production", deployment.Environment)
+	assert.Equal(t, finished, deployment.CreatedAt)
+	assert.Equal(t, "repo1/production/abc/1704110400", deployment.DeploymentID)
+	assert.Equal(t, DeploymentSourceAPI, deployment.Source)
+}
+
+func TestValidateDeployment_ReportsAllProblems(t *testing.T) {
+	err := ValidateDeployment(&Deployment{Status: "rolled-back"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "repo is required")
+	assert.Contains(t, err.Error(), "commit_id is required")
+	assert.Contains(t, err.Error(), "status must be")
+	assert.Contains(t, err.Error(), "finished_at is required")
+}
+
+func TestSaveDeploymentsToDB(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	// Deployments stored before owners were recorded are claimed first.
+	mockCollection.On("UpdateMany", mock.Anything,
+		bson.M{"owner": "", "reponame": "repo1", "deployment_id": bson.M{"$in": []string{"D1", "D2"}}},
+		bson.M{"$set": bson.M{"owner": "acme"}}, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "deployment_id": "D1"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "deployment_id": "D2"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "", "reponame": "repo1", "deployment_id": "D3"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	defer func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.DeploymentsCollection, name)
+		return mockCollection
+	}
+
+	metrics := GitMetricsImpl{}
+	assert.NoError(t, metrics.SaveDeploymentsToDB(context.Background(), []Deployment{
+		{Owner: "acme", RepoName: "repo1", DeploymentID: "D1"},
+		{Owner: "acme", RepoName: "repo1", DeploymentID: "D2"},
+		{RepoName: "repo1", DeploymentID: "D3"},
+	}))
+	mockCollection.AssertExpectations(t)
+}
+
+func TestSaveDeploymentsToDB_Error(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(mongo.UpdateResult), errors.New("write failed"))
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	defer func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		return mockCollection
+	}
+
+	err := SaveDeploymentsToDB(context.Background(), []Deployment{{RepoName: "repo1", DeploymentID: "D1"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to update deployment")
+}
+
+func TestCommitOwners(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, bson.M{"reponame": "repo1", "commit_id": "abc"}, mock.Anything).
+		Return(legacyCursor(t, Commit{Owner: "acme"}, Commit{Owner: "fork"}, Commit{Owner: "acme"}), nil)
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return mockCollection
+	}
+
+	owners, err := CommitOwners(context.Background(), "repo1", "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme", "fork"}, owners)
+}
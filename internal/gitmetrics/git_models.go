@@ -4,19 +4,129 @@ import (
 	"time"
 )
 
+// Commit is a commit of a repository. A commit is identified by its owner,
+// repository and ID, since forks and mirrors share commit IDs. Complete is
+// false when its file changes couldn't be fetched, and SchemaVersion is the
+// CommitSchemaVersion it was stored with.
 type Commit struct {
-	CommitMessage string    `bson:"commit_message"`
-	LinesDeleted  int       `bson:"lines_deleted"`
-	CommitID      string    `bson:"commit_id"`
-	CommittedBy   string    `bson:"commited_by"`
-	LinesAdded    int       `bson:"lines_added"`
-	RepoName      string    `bson:"reponame"`
-	CommitDate    time.Time `bson:"commit_date"`
-	FilesAdded    int       `bson:"files_added"`
-	FilesDeleted  int       `bson:"files_deleted"`
-	FilesUpdated  int       `bson:"files_updated"`
+	CommitMessage string             `bson:"commit_message"`
+	LinesDeleted  int                `bson:"lines_deleted"`
+	CommitID      string             `bson:"commit_id"`
+	CommittedBy   string             `bson:"committed_by"`
+	AuthorLogin   string             `bson:"author_login,omitempty"`
+	LinesAdded    int                `bson:"lines_added"`
+	Owner         string             `bson:"owner"`
+	RepoName      string             `bson:"reponame"`
+	CommitDate    time.Time          `bson:"commit_date"`
+	FilesAdded    int                `bson:"files_added"`
+	FilesDeleted  int                `bson:"files_deleted"`
+	FilesUpdated  int                `bson:"files_updated"`
+	Conventional  ConventionalCommit `bson:"conventional"`
+	ReleaseTag    string             `bson:"release_tag,omitempty"`
+	ReleasedAt    *time.Time         `bson:"released_at,omitempty"`
+	Files         []FileChange       `bson:"files,omitempty"`
+	Outlier       bool               `bson:"outlier,omitempty"`
+	PullRequest   int                `bson:"pull_request,omitempty"`
+	Complete      bool               `bson:"complete"`
+	SchemaVersion int                `bson:"schema_version"`
+}
+
+// CommitSchemaVersion is the version of the data FetchCommits stores for a
+// commit. Increase it when Commit gains data that stored commits lack, so
+// the next sync of each commit rewrites it.
+const CommitSchemaVersion = 1
+
+// FileChange is the change a commit made to a single file, as reported by
+// the GitHub commits API. PreviousFilename is only set for renames.
+type FileChange struct {
+	Filename         string `bson:"filename" json:"filename"`
+	PreviousFilename string `bson:"previous_filename,omitempty" json:"previous_filename,omitempty"`
+	Status           string `bson:"status" json:"status"`
+	Additions        int    `bson:"additions" json:"additions"`
+	Deletions        int    `bson:"deletions" json:"deletions"`
+}
+
+// ConventionalCommit is the structured form of a commit message that follows
+// the Conventional Commits specification. Type is empty when the message does
+// not follow the specification; Subject then holds the first line as-is.
+type ConventionalCommit struct {
+	Type     string   `bson:"type" json:"type"`
+	Scope    string   `bson:"scope,omitempty" json:"scope,omitempty"`
+	Breaking bool     `bson:"breaking" json:"breaking"`
+	Subject  string   `bson:"subject" json:"subject"`
+	Body     string   `bson:"body,omitempty" json:"body,omitempty"`
+	Footers  []Footer `bson:"footers,omitempty" json:"footers,omitempty"`
+}
+
+// Footer is a single trailer such as "Refs: #123" or "BREAKING CHANGE: ...".
+type Footer struct {
+	Token string `bson:"token" json:"token"`
+	Value string `bson:"value" json:"value"`
+}
+
+// Release is a tag of a repository, enriched with the GitHub release
+// published for it when there is one. CommitDate is the date of the tagged
+// commit; ReleasedAt is the release's publish date, or the tag date for plain tags.
+// Commits are the IDs of the commits the tag adds to the tag before it; they
+// are only used to attach stored commits and aren't stored.
+type Release struct {
+	Owner         string    `bson:"owner" json:"owner"`
+	RepoName      string    `bson:"reponame" json:"repo"`
+	TagName       string    `bson:"tag_name" json:"tag_name"`
+	Name          string    `bson:"name,omitempty" json:"name,omitempty"`
+	CommitID      string    `bson:"commit_id" json:"commit_id"`
+	CommitDate    time.Time `bson:"commit_date" json:"commit_date"`
+	ReleasedAt    time.Time `bson:"released_at" json:"released_at"`
+	GitHubRelease bool      `bson:"github_release" json:"github_release"`
+	Prerelease    bool      `bson:"prerelease" json:"prerelease"`
+	Commits       []string  `bson:"-" json:"-"`
+}
+
+// Deployment statuses used for DORA metrics. A failed deployment is one that
+// failed outright or caused a failure in the target environment.
+const (
+	DeploymentSuccess = "success"
+	DeploymentFailure = "failure"
+)
+
+// Sources a deployment was recorded from.
+const (
+	DeploymentSourceGitHub = "github"
+	DeploymentSourceAPI    = "api"
+)
+
+// Deployment is a deployment of a commit to an environment, either read from
+// the GitHub deployments API or pushed by a CD system.
+type Deployment struct {
+	DeploymentID string    `bson:"deployment_id" json:"id"`
+	Owner        string    `bson:"owner" json:"owner"`
+	RepoName     string    `bson:"reponame" json:"repo"`
+	Environment  string    `bson:"environment" json:"environment"`
+	CommitID     string    `bson:"commit_id" json:"commit_id"`
+	Status       string    `bson:"status" json:"status"`
+	Source       string    `bson:"source" json:"source"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	FinishedAt   time.Time `bson:"finished_at" json:"finished_at"`
+}
+
+// DailyRollup is the activity of one author in one repository on one UTC
+// day, kept up to date as commits are stored so charts don't have to scan
+// every commit. The author's login is kept so rollups can be matched to team
+// members.
+type DailyRollup struct {
+	Owner        string    `bson:"owner" json:"owner"`
+	RepoName     string    `bson:"reponame" json:"repo"`
+	Author       string    `bson:"author" json:"author"`
+	AuthorLogin  string    `bson:"author_login" json:"author_login,omitempty"`
+	Day          time.Time `bson:"day" json:"day"`
+	Commits      int       `bson:"commits" json:"commits"`
+	LinesAdded   int       `bson:"lines_added" json:"lines_added"`
+	LinesDeleted int       `bson:"lines_deleted" json:"lines_deleted"`
+	FilesAdded   int       `bson:"files_added" json:"files_added"`
+	FilesDeleted int       `bson:"files_deleted" json:"files_deleted"`
+	FilesUpdated int       `bson:"files_updated" json:"files_updated"`
 }
 
 type Repository struct {
 	Name string `json:"name"`
-}
\ No newline at end of file
+}
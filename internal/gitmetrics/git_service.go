@@ -7,10 +7,12 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/lep13/git_metrics/config"
 	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/telemetry"
 	"github.com/machinebox/graphql"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -29,24 +31,71 @@ type CustomGraphQLRequest struct {
 	QueryType string
 }
 
+// runGraphQL runs a GitHub GraphQL request and records its outcome and
+// latency under the given request type.
+func runGraphQL(client GraphQLClient, requestType string, req *graphql.Request, respData interface{}) error {
+	start := time.Now()
+	err := client.Run(context.Background(), req, respData)
+	telemetry.ObserveGitHubRequest(requestType, telemetry.Outcome(err), time.Since(start))
+	return err
+}
+
 type GitMetrics interface {
 	FetchRepositoriesSimple(client *graphql.Client, user string, token string) ([]Repository, error)
 	FetchCommits(client *graphql.Client, httpClient *http.Client, user string, repo string, token string) ([]Commit, error)
-	SaveCommitsToDB(commits []Commit) error
+	SaveCommitsToDB(ctx context.Context, commits []Commit) (SaveResult, error)
+	FetchReleases(ctx context.Context, client *graphql.Client, user string, repo string, token string) ([]Release, error)
+	SaveReleasesToDB(ctx context.Context, releases []Release) error
+	FetchDeployments(client *graphql.Client, user string, repo string, token string) ([]Deployment, error)
+	SaveDeploymentsToDB(ctx context.Context, deployments []Deployment) error
 }
 
-type GitMetricsImpl struct{}
+// GitMetricsImpl implements GitMetrics against GitHub and MongoDB. Config
+// provides the GitHub API settings; without it the defaults are used.
+type GitMetricsImpl struct {
+	Config *config.Store
+}
+
+// filesAPI returns the URL template of the commit API.
+func (g *GitMetricsImpl) filesAPI() string {
+	if g.Config == nil {
+		return config.Defaults().FilesAPI
+	}
+	return g.Config.Get().FilesAPI
+}
 
 func (g *GitMetricsImpl) FetchRepositoriesSimple(client *graphql.Client, user string, token string) ([]Repository, error) {
 	return FetchRepositoriesSimple(client, user, token)
 }
 
 func (g *GitMetricsImpl) FetchCommits(client *graphql.Client, httpClient *http.Client, user string, repo string, token string) ([]Commit, error) {
-	return FetchCommits(client, httpClient, user, repo, token)
+	return FetchCommits(client, httpClient, g.filesAPI(), user, repo, token)
+}
+
+func (g *GitMetricsImpl) SaveCommitsToDB(ctx context.Context, commits []Commit) (SaveResult, error) {
+	return SaveCommitsToDB(ctx, commits)
+}
+
+// FetchReleases fetches the releases of a repository, skipping the commits
+// of the releases already stored.
+func (g *GitMetricsImpl) FetchReleases(ctx context.Context, client *graphql.Client, user string, repo string, token string) ([]Release, error) {
+	stored, err := StoredReleases(ctx, user, repo)
+	if err != nil {
+		return nil, err
+	}
+	return FetchReleases(client, user, repo, token, stored)
+}
+
+func (g *GitMetricsImpl) SaveReleasesToDB(ctx context.Context, releases []Release) error {
+	return SaveReleasesToDB(ctx, releases)
+}
+
+func (g *GitMetricsImpl) FetchDeployments(client *graphql.Client, user string, repo string, token string) ([]Deployment, error) {
+	return FetchDeployments(client, user, repo, token)
 }
 
-func (g *GitMetricsImpl) SaveCommitsToDB(commits []Commit) error {
-	return SaveCommitsToDB(commits)
+func (g *GitMetricsImpl) SaveDeploymentsToDB(ctx context.Context, deployments []Deployment) error {
+	return SaveDeploymentsToDB(ctx, deployments)
 }
 
 // const maxReposPerPage = 100
@@ -89,7 +138,7 @@ func FetchRepositoriesSimple(client GraphQLClient, user, token string) ([]Reposi
 			} `json:"user"`
 		}
 
-		if err := client.Run(context.Background(), req, &respData); err != nil {
+		if err := runGraphQL(client, "repositories", req, &respData); err != nil {
 			return nil, err
 		}
 
@@ -104,7 +153,10 @@ func FetchRepositoriesSimple(client GraphQLClient, user, token string) ([]Reposi
 	return allRepositories, nil
 }
 
-func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token string) ([]Commit, error) {
+// FetchCommits returns the commits of a repository's default branch, with
+// their file changes read from filesAPI, a URL template taking the owner,
+// repository and commit SHA.
+func FetchCommits(client GraphQLClient, httpClient HTTPClient, filesAPI, user, repo, token string) ([]Commit, error) {
 	defaultBranchReq := &CustomGraphQLRequest{
 		Request: graphql.NewRequest(`
 			query($user: String!, $repo: String!) {
@@ -129,7 +181,7 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 		} `json:"repository"`
 	}
 
-	if err := client.Run(context.Background(), defaultBranchReq.Request, &defaultBranchResp); err != nil {
+	if err := runGraphQL(client, "default_branch", defaultBranchReq.Request, &defaultBranchResp); err != nil {
 		return nil, err
 	}
 	defaultBranch := defaultBranchResp.Repository.DefaultBranchRef.Name
@@ -141,6 +193,9 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 		req := &CustomGraphQLRequest{
 			Request: graphql.NewRequest(`
 				query($user: String!, $repo: String!, $branch: String!, $cursor: String) {
+					rateLimit {
+						remaining
+					}
 					repository(owner: $user, name: $repo) {
 						ref(qualifiedName: $branch) {
 							target {
@@ -152,10 +207,18 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 											author {
 												name
 												date
+												user {
+													login
+												}
 											}
 											additions
 											deletions
 											changedFiles
+											associatedPullRequests(first: 1) {
+												nodes {
+													number
+												}
+											}
 										}
 										pageInfo {
 											hasNextPage
@@ -178,6 +241,9 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 		req.Header.Set("Authorization", "Bearer "+token)
 
 		var respData struct {
+			RateLimit *struct {
+				Remaining int `json:"remaining"`
+			} `json:"rateLimit"`
 			Repository struct {
 				Ref struct {
 					Target struct {
@@ -188,10 +254,18 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 								Author  struct {
 									Name string    `json:"name"`
 									Date time.Time `json:"date"`
+									User *struct {
+										Login string `json:"login"`
+									} `json:"user"`
 								} `json:"author"`
-								Additions    int `json:"additions"`
-								Deletions    int `json:"deletions"`
-								ChangedFiles int `json:"changedFiles"`
+								Additions              int `json:"additions"`
+								Deletions              int `json:"deletions"`
+								ChangedFiles           int `json:"changedFiles"`
+								AssociatedPullRequests struct {
+									Nodes []struct {
+										Number int `json:"number"`
+									} `json:"nodes"`
+								} `json:"associatedPullRequests"`
 							} `json:"nodes"`
 							PageInfo struct {
 								HasNextPage bool   `json:"hasNextPage"`
@@ -203,9 +277,13 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 			} `json:"repository"`
 		}
 
-		if err := client.Run(context.Background(), req.Request, &respData); err != nil {
+		if err := runGraphQL(client, "commits", req.Request, &respData); err != nil {
 			return nil, err
 		}
+		if respData.RateLimit != nil {
+			telemetry.SetRateLimitRemaining("graphql", respData.RateLimit.Remaining)
+		}
+		telemetry.CommitsFetched.Add(float64(len(respData.Repository.Ref.Target.History.Nodes)))
 
 		for _, node := range respData.Repository.Ref.Target.History.Nodes {
 			commit := Commit{
@@ -214,17 +292,26 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 				CommitID:      node.Oid,
 				CommittedBy:   node.Author.Name,
 				LinesAdded:    node.Additions,
+				Owner:         user,
+				SchemaVersion: CommitSchemaVersion,
 				RepoName:      repo,
 				CommitDate:    node.Author.Date,
+				Conventional:  ParseConventionalCommit(node.Message),
+			}
+			if node.Author.User != nil {
+				commit.AuthorLogin = node.Author.User.Login
+			}
+			if prs := node.AssociatedPullRequests.Nodes; len(prs) > 0 {
+				commit.PullRequest = prs[0].Number
 			}
 
-			filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(httpClient, user, repo, node.Oid, token)
+			files, err := FetchCommitFiles(httpClient, filesAPI, user, repo, node.Oid, token)
 			if err != nil {
 				log.Printf("failed to fetch file changes for commit %s: %v", node.Oid, err)
 			} else {
-				commit.FilesAdded = filesAdded
-				commit.FilesDeleted = filesDeleted
-				commit.FilesUpdated = filesUpdated
+				commit.Files = files
+				commit.FilesAdded, commit.FilesDeleted, commit.FilesUpdated = countFileStatuses(files)
+				commit.Complete = true
 			}
 
 			allCommits = append(allCommits, commit)
@@ -269,46 +356,255 @@ func FetchCommits(client GraphQLClient, httpClient HTTPClient, user, repo, token
 // 	return respData.Repository.DefaultBranchRef.Name, nil
 // }
 
-func FetchCommitFileChanges(client HTTPClient, user, repo, commitID, token string) (int, int, int, error) {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to load config: %w", err)
+// FetchTagCommitDate returns the author date of the commit a tag points to,
+// the date commits are stored with, so it can bound a query on commit_date.
+// Both lightweight and annotated tags are supported.
+func FetchTagCommitDate(client GraphQLClient, user, repo, tag, token string) (time.Time, error) {
+	req := graphql.NewRequest(`
+		query($user: String!, $repo: String!, $ref: String!) {
+			repository(owner: $user, name: $repo) {
+				ref(qualifiedName: $ref) {
+					target {
+						... on Commit {
+							author {
+								date
+							}
+						}
+						... on Tag {
+							target {
+								... on Commit {
+									author {
+										date
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	`)
+
+	req.Var("user", user)
+	req.Var("repo", repo)
+	req.Var("ref", "refs/tags/"+tag)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	type tagCommit struct {
+		Author *struct {
+			Date time.Time `json:"date"`
+		} `json:"author"`
+	}
+
+	var respData struct {
+		Repository struct {
+			Ref *struct {
+				Target struct {
+					tagCommit
+					Target tagCommit `json:"target"`
+				} `json:"target"`
+			} `json:"ref"`
+		} `json:"repository"`
 	}
 
-	url := fmt.Sprintf(cfg.FilesAPI, user, repo, commitID)
+	if err := runGraphQL(client, "tag_commit_date", req, &respData); err != nil {
+		return time.Time{}, err
+	}
+
+	ref := respData.Repository.Ref
+	switch {
+	case ref == nil:
+		return time.Time{}, fmt.Errorf("tag %s not found in %s/%s", tag, user, repo)
+	case ref.Target.Author != nil:
+		return ref.Target.Author.Date, nil
+	case ref.Target.Target.Author != nil:
+		return ref.Target.Target.Author.Date, nil
+	}
+	return time.Time{}, fmt.Errorf("tag %s in %s/%s does not point to a commit", tag, user, repo)
+}
+
+// FetchCommitFiles returns the per-file changes of a commit, read from
+// filesAPI.
+func FetchCommitFiles(client HTTPClient, filesAPI, user, repo, commitID, token string) ([]FileChange, error) {
+	url := fmt.Sprintf(filesAPI, user, repo, commitID)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, 0, 0, err
+		telemetry.ObserveGitHubRequest("commit_files", telemetry.OutcomeError, time.Since(start))
+		return nil, err
 	}
 	defer resp.Body.Close()
+	telemetry.ObserveGitHubRequest("commit_files", strconv.Itoa(resp.StatusCode), time.Since(start))
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		telemetry.SetRateLimitRemaining("rest", remaining)
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, 0, 0, fmt.Errorf("failed to fetch commit details: %s", resp.Status)
+		return nil, fmt.Errorf("failed to fetch commit details: %s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
 
 	var commitData struct {
-		Files []struct {
-			Status string `json:"status"`
-		} `json:"files"`
+		Files []FileChange `json:"files"`
 	}
 
 	if err := json.Unmarshal(body, &commitData); err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
 
+	return commitData.Files, nil
+}
+
+// repository identifies the repository of a commit.
+type repository struct{ owner, name string }
+
+// FullName returns owner/repo, or repo alone when the owner isn't known, so
+// a fork and its upstream are told apart.
+func FullName(owner, repo string) string {
+	if owner == "" {
+		return repo
+	}
+	return owner + "/" + repo
+}
+
+// groupByRepository groups commits by repository, in the order the
+// repositories first appear.
+func groupByRepository(commits []Commit) ([]repository, map[repository][]Commit) {
+	var repositories []repository
+	groups := make(map[repository][]Commit)
+	for _, commit := range commits {
+		key := repository{commit.Owner, commit.RepoName}
+		if _, ok := groups[key]; !ok {
+			repositories = append(repositories, key)
+		}
+		groups[key] = append(groups[key], commit)
+	}
+	return repositories, groups
+}
+
+func commitIDs(commits []Commit) []string {
+	ids := make([]string, len(commits))
+	for i, commit := range commits {
+		ids[i] = commit.CommitID
+	}
+	return ids
+}
+
+// claimLegacyCommits sets the owner of the given commits where they were
+// stored before owners were recorded; migration 2 leaves their owner empty.
+// The first owner to sync such a commit claims it, along with its share of
+// the rollups, and other owners of the repository name, e.g. forks, store
+// their own copy.
+func claimLegacyCommits(ctx context.Context, collection db.CollectionInterface, commits []Commit) error {
+	repositories, groups := groupByRepository(commits)
+	for _, repo := range repositories {
+		if repo.owner == "" {
+			continue
+		}
+		filter := bson.M{"owner": "", "reponame": repo.name, "commit_id": bson.M{"$in": commitIDs(groups[repo])}}
+		cursor, err := collection.Find(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to query legacy commits of %s/%s: %w", repo.owner, repo.name, err)
+		}
+		var legacy []Commit
+		if err := cursor.All(ctx, &legacy); err != nil {
+			return fmt.Errorf("failed to decode legacy commits of %s/%s: %w", repo.owner, repo.name, err)
+		}
+		if len(legacy) == 0 {
+			continue
+		}
+
+		filter["commit_id"] = bson.M{"$in": commitIDs(legacy)}
+		update := bson.M{"$set": bson.M{"owner": repo.owner}}
+		if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+			return fmt.Errorf("failed to claim commits of %s/%s: %w", repo.owner, repo.name, err)
+		}
+
+		claimed := make([]Commit, len(legacy))
+		for i, commit := range legacy {
+			commit.Owner = repo.owner
+			claimed[i] = commit
+		}
+		if err := AdjustRollups(ctx, legacy, claimed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairCommits rewrites the stored commits that were partially ingested
+// or ingested by an older CommitSchemaVersion with the given commits, which
+// are already stored, and moves their rollups to the repaired values. Only
+// commits fetched completely are used. It returns the repaired commits.
+func repairCommits(ctx context.Context, collection db.CollectionInterface, commits []Commit) ([]Commit, error) {
+	var complete []Commit
+	for _, commit := range commits {
+		if commit.Complete {
+			complete = append(complete, commit)
+		}
+	}
+
+	var stale, repaired []Commit
+	repositories, groups := groupByRepository(complete)
+	for _, repo := range repositories {
+		fetched := make(map[string]Commit)
+		for _, commit := range groups[repo] {
+			fetched[commit.CommitID] = commit
+		}
+
+		filter := bson.M{
+			"owner":     repo.owner,
+			"reponame":  repo.name,
+			"commit_id": bson.M{"$in": commitIDs(groups[repo])},
+			"$or": bson.A{
+				bson.M{"complete": bson.M{"$ne": true}},
+				bson.M{"schema_version": bson.M{"$lt": CommitSchemaVersion}},
+			},
+		}
+		cursor, err := collection.Find(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query incomplete commits: %w", err)
+		}
+		var stored []Commit
+		if err := cursor.All(ctx, &stored); err != nil {
+			return nil, fmt.Errorf("failed to decode incomplete commits: %w", err)
+		}
+
+		for _, old := range stored {
+			commit, ok := fetched[old.CommitID]
+			if !ok {
+				continue
+			}
+			filter := bson.M{"owner": commit.Owner, "reponame": commit.RepoName, "commit_id": commit.CommitID}
+			if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": commit}); err != nil {
+				return nil, fmt.Errorf("failed to repair commit: %w", err)
+			}
+			stale = append(stale, old)
+			repaired = append(repaired, commit)
+		}
+	}
+
+	if len(repaired) > 0 {
+		if err := AdjustRollups(ctx, stale, repaired); err != nil {
+			return nil, err
+		}
+	}
+	return repaired, nil
+}
+
+func countFileStatuses(files []FileChange) (int, int, int) {
 	filesAdded, filesDeleted, filesUpdated := 0, 0, 0
-	for _, file := range commitData.Files {
+	for _, file := range files {
 		switch file.Status {
 		case "added":
 			filesAdded++
@@ -318,22 +614,60 @@ func FetchCommitFileChanges(client HTTPClient, user, repo, commitID, token strin
 			filesUpdated++
 		}
 	}
+	return filesAdded, filesDeleted, filesUpdated
+}
 
-	return filesAdded, filesDeleted, filesUpdated, nil
+// SaveResult counts what SaveCommitsToDB did with the commits it was given.
+type SaveResult struct {
+	Inserted int `json:"inserted"`
+	Repaired int `json:"repaired"`
+	Skipped  int `json:"skipped"`
 }
 
-func SaveCommitsToDB(commits []Commit) error {
+// SaveCommitsToDB stores the commits that aren't stored yet, identified by
+// owner, repository and commit ID, and adds them to the rollups. Stored
+// commits that were partially ingested or ingested by an older
+// CommitSchemaVersion are rewritten with the commits given; the others are
+// left as they are.
+func SaveCommitsToDB(ctx context.Context, commits []Commit) (SaveResult, error) {
+	var result SaveResult
 	collection := db.GetCollection()
 
+	if err := claimLegacyCommits(ctx, collection, commits); err != nil {
+		return result, err
+	}
+
+	var inserted, existing []Commit
 	for _, commit := range commits {
-		filter := bson.M{"commit_id": commit.CommitID}
+		filter := bson.M{"owner": commit.Owner, "reponame": commit.RepoName, "commit_id": commit.CommitID}
 		update := bson.M{"$setOnInsert": commit}
 		opts := options.Update().SetUpsert(true)
-		_, err := collection.UpdateOne(context.Background(), filter, update, opts)
+		updated, err := collection.UpdateOne(ctx, filter, update, opts)
 		if err != nil {
-			return fmt.Errorf("failed to update commit: %w", err)
+			return result, fmt.Errorf("failed to update commit: %w", err)
+		}
+		if updated.UpsertedCount > 0 {
+			inserted = append(inserted, commit)
+			telemetry.CommitsInserted.Inc()
+		} else {
+			existing = append(existing, commit)
 		}
 	}
+	result.Inserted = len(inserted)
 
-	return nil
+	repaired, err := repairCommits(ctx, collection, existing)
+	if err != nil {
+		return result, err
+	}
+	result.Repaired = len(repaired)
+	result.Skipped = len(existing) - len(repaired)
+	telemetry.CommitsRepaired.Add(float64(result.Repaired))
+	telemetry.CommitsSkipped.Add(float64(result.Skipped))
+
+	// Only new commits are added to the rollups so repeated syncs don't
+	// count a commit twice.
+	if len(inserted) > 0 {
+		return result, IncrementRollups(ctx, inserted)
+	}
+	return result, nil
 }
@@ -2,6 +2,7 @@ package gitmetrics
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -9,13 +10,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lep13/git_metrics/config"
 	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/telemetry"
 	"github.com/machinebox/graphql"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const testFilesAPI = "https://api.github.com/repos/%s/%s/commits/%s"
+
 // MockGraphQLClient simulates the behavior of the GraphQL client.
 type MockGraphQLClient struct {
 	mock.Mock
@@ -87,12 +94,12 @@ func TestFetchCommits_Error(t *testing.T) {
 
 	mockHTTPClient := new(MockHTTPClient)
 
-	commits, err := FetchCommits(mockGraphQLClient, mockHTTPClient, "user", "repo", "token")
+	commits, err := FetchCommits(mockGraphQLClient, mockHTTPClient, testFilesAPI, "user", "repo", "token")
 	assert.Error(t, err)
 	assert.Nil(t, commits)
 	assert.Contains(t, err.Error(), "failed to fetch commits")
 }
-func TestFetchCommitFileChanges_Success(t *testing.T) {
+func TestFetchCommitFiles_Success(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(&http.Response{
 		StatusCode: http.StatusOK,
@@ -105,90 +112,76 @@ func TestFetchCommitFileChanges_Success(t *testing.T) {
 		}`)),
 	}, nil)
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.NoError(t, err)
-	assert.Equal(t, 1, filesAdded)
-	assert.Equal(t, 1, filesUpdated)
-	assert.Equal(t, 1, filesDeleted)
+	assert.Equal(t, []FileChange{{Status: "added"}, {Status: "modified"}, {Status: "removed"}}, files)
 }
 
-func TestFetchCommitFileChanges_Error(t *testing.T) {
+func TestFetchCommitFiles_Error(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(nil, errors.New("failed to fetch commit details"))
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "failed to fetch commit details")
 }
 
-func TestFetchCommitFileChanges_ErrorCreatingRequest(t *testing.T) {
+func TestFetchCommitFiles_ErrorCreatingRequest(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "\x00", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "\x00", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "invalid control character in URL")
 }
 
-func TestFetchCommitFileChanges_ErrorPerformingRequest(t *testing.T) {
+func TestFetchCommitFiles_ErrorPerformingRequest(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(nil, errors.New("failed to perform request"))
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "failed to perform request")
 }
 
-func TestFetchCommitFileChanges_NonOKStatusCode(t *testing.T) {
+func TestFetchCommitFiles_NonOKStatusCode(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(&http.Response{
 		StatusCode: http.StatusUnauthorized,
 		Body:       io.NopCloser(strings.NewReader("")),
 	}, nil)
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "failed to fetch commit details")
 }
 
-func TestFetchCommitFileChanges_ErrorReadingBody(t *testing.T) {
+func TestFetchCommitFiles_ErrorReadingBody(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(&errorReader{}),
 	}, nil)
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "failed to read body")
 }
 
-func TestFetchCommitFileChanges_ErrorUnmarshallingBody(t *testing.T) {
+func TestFetchCommitFiles_ErrorUnmarshallingBody(t *testing.T) {
 	mockHTTPClient := new(MockHTTPClient)
 	mockHTTPClient.On("Do", mock.Anything).Return(&http.Response{
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(strings.NewReader("{")),
 	}, nil)
 
-	filesAdded, filesDeleted, filesUpdated, err := FetchCommitFileChanges(mockHTTPClient, "user", "repo", "commitID", "token")
+	files, err := FetchCommitFiles(mockHTTPClient, testFilesAPI, "user", "repo", "commitID", "token")
 	assert.Error(t, err)
-	assert.Equal(t, 0, filesAdded)
-	assert.Equal(t, 0, filesUpdated)
-	assert.Equal(t, 0, filesDeleted)
+	assert.Nil(t, files)
 	assert.Contains(t, err.Error(), "unexpected end of JSON input")
 }
 
@@ -223,11 +216,97 @@ func TestSaveCommitsToDB_Success(t *testing.T) {
 		return mockCollection
 	}
 
-	err := SaveCommitsToDB(commits)
+	_, err := SaveCommitsToDB(context.Background(), commits)
 	assert.NoError(t, err)
 	mockCollection.AssertExpectations(t)
 }
 
+// legacyCursor returns a cursor over commits, as Find would return them.
+func legacyCursor(t *testing.T, commits ...Commit) *mongo.Cursor {
+	docs := make([]interface{}, len(commits))
+	for i, commit := range commits {
+		docs[i] = commit
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+	return cursor
+}
+
+func TestSaveCommitsToDB_IdentifiesCommitsByOwner(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	commits := []Commit{
+		{CommitID: "abc123", Owner: "lep13", RepoName: "git_metrics", CommittedBy: "alice", CommitDate: day, LinesAdded: 10},
+		{CommitID: "def456", Owner: "lep13", RepoName: "git_metrics", CommittedBy: "alice", CommitDate: day, LinesAdded: 5},
+		{CommitID: "abc123", Owner: "fork-owner", RepoName: "git_metrics", CommittedBy: "alice", CommitDate: day, LinesAdded: 10},
+	}
+	// abc123 was stored before owners were recorded; def456 is new.
+	legacy := commits[0]
+	legacy.Owner = ""
+
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything,
+		bson.M{"owner": "", "reponame": "git_metrics", "commit_id": bson.M{"$in": []string{"abc123", "def456"}}},
+		mock.Anything).Return(legacyCursor(t, legacy), nil).Once()
+	mockCollection.On("UpdateMany", mock.Anything,
+		bson.M{"owner": "", "reponame": "git_metrics", "commit_id": bson.M{"$in": []string{"abc123"}}},
+		bson.M{"$set": bson.M{"owner": "lep13"}}, mock.Anything).Return(&mongo.UpdateResult{ModifiedCount: 1}, nil).Once()
+	// Once claimed, the fork finds no legacy commit left and stores its own.
+	mockCollection.On("Find", mock.Anything,
+		bson.M{"owner": "", "reponame": "git_metrics", "commit_id": bson.M{"$in": []string{"abc123"}}},
+		mock.Anything).Return(legacyCursor(t), nil).Once()
+	mockCollection.On("UpdateOne", mock.Anything,
+		bson.M{"owner": "lep13", "reponame": "git_metrics", "commit_id": "abc123"},
+		mock.Anything, mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 1}, nil).Once()
+	mockCollection.On("UpdateOne", mock.Anything,
+		bson.M{"owner": "lep13", "reponame": "git_metrics", "commit_id": "def456"},
+		mock.Anything, mock.Anything).Return(&mongo.UpdateResult{UpsertedCount: 1}, nil).Once()
+	mockCollection.On("UpdateOne", mock.Anything,
+		bson.M{"owner": "fork-owner", "reponame": "git_metrics", "commit_id": "abc123"},
+		mock.Anything, mock.Anything).Return(&mongo.UpdateResult{UpsertedCount: 1}, nil).Once()
+
+	increments := make(map[string][]int)
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		owner := args.Get(1).(bson.M)["owner"].(string)
+		increments[owner] = append(increments[owner], args.Get(2).(bson.M)["$inc"].(bson.M)["lines_added"].(int))
+	})
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return mockCollection
+	}
+	mockRollupCollection(t, rollupCollection)
+
+	result, err := SaveCommitsToDB(context.Background(), commits)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Inserted)
+	mockCollection.AssertExpectations(t)
+	// The claimed commit's rollup moves from the legacy owner to lep13 before
+	// the new commits are added.
+	assert.Equal(t, map[string][]int{
+		"":           {-10},
+		"lep13":      {10, 5},
+		"fork-owner": {10},
+	}, increments)
+}
+
+func TestSaveCommitsToDB_ClaimError(t *testing.T) {
+	mockCollection := new(db.MockCollection)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(legacyCursor(t, Commit{CommitID: "abc123", RepoName: "git_metrics"}), nil)
+	mockCollection.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(mongo.UpdateResult), errors.New("not primary"))
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return mockCollection
+	}
+
+	_, err := SaveCommitsToDB(context.Background(), []Commit{{CommitID: "abc123", Owner: "lep13", RepoName: "git_metrics"}})
+	assert.ErrorContains(t, err, "failed to claim commits of lep13/git_metrics: not primary")
+	mockCollection.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestSaveCommitsToDB_Error(t *testing.T) {
 	commits := []Commit{
 		{
@@ -253,7 +332,7 @@ func TestSaveCommitsToDB_Error(t *testing.T) {
 		return mockCollection
 	}
 
-	err := SaveCommitsToDB(commits)
+	_, err := SaveCommitsToDB(context.Background(), commits)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to update commit")
 	mockCollection.AssertExpectations(t)
@@ -285,8 +364,87 @@ func TestGitMetricsImpl_SaveCommitsToDB(t *testing.T) {
 	}
 
 	metrics := GitMetricsImpl{}
-	err := metrics.SaveCommitsToDB(commits)
+	_, err := metrics.SaveCommitsToDB(context.Background(), commits)
 	assert.NoError(t, err)
 	mockCollection.AssertExpectations(t)
 }
 
+func TestFetchTagCommitDate_AnnotatedTag(t *testing.T) {
+	tagDate := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		err := json.Unmarshal([]byte(`{"repository":{"ref":{"target":{"target":{"author":{"date":"2024-05-01T12:00:00Z"}}}}}}`), args.Get(2))
+		assert.NoError(t, err)
+	})
+
+	date, err := FetchTagCommitDate(mockClient, "user", "repo", "v1.0.0", "token")
+	assert.NoError(t, err)
+	assert.True(t, tagDate.Equal(date))
+}
+
+func TestFetchTagCommitDate_LightweightTag(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		err := json.Unmarshal([]byte(`{"repository":{"ref":{"target":{"author":{"date":"2024-05-02T08:30:00Z"},"committedDate":"2024-05-03T09:00:00Z"}}}}`), args.Get(2))
+		assert.NoError(t, err)
+	})
+
+	date, err := FetchTagCommitDate(mockClient, "user", "repo", "v1.0.1", "token")
+	assert.NoError(t, err)
+	// The author date is used, as for stored commits, not the committed date.
+	assert.Equal(t, time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC), date.UTC())
+}
+
+func TestFetchTagCommitDate_NotFound(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	_, err := FetchTagCommitDate(mockClient, "user", "repo", "missing", "token")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tag missing not found")
+}
+
+func TestFetchTagCommitDate_Error(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("graphql failure"))
+
+	_, err := FetchTagCommitDate(mockClient, "user", "repo", "v1.0.0", "token")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "graphql failure")
+}
+
+func TestCountFileStatuses(t *testing.T) {
+	files := []FileChange{
+		{Filename: "a.go", Status: "added"},
+		{Filename: "b.go", Status: "added"},
+		{Filename: "c.go", Status: "removed"},
+		{Filename: "d.go", Status: "modified"},
+		{Filename: "e.go", PreviousFilename: "f.go", Status: "renamed"},
+	}
+
+	filesAdded, filesDeleted, filesUpdated := countFileStatuses(files)
+	assert.Equal(t, 2, filesAdded)
+	assert.Equal(t, 1, filesDeleted)
+	assert.Equal(t, 1, filesUpdated)
+}
+
+func TestRunGraphQL_RecordsRequest(t *testing.T) {
+	requests := telemetry.GitHubRequests.WithLabelValues("repositories", telemetry.OutcomeError)
+	before := testutil.ToFloat64(requests)
+
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("rate limited"))
+
+	_, err := FetchRepositoriesSimple(mockClient, "user", "token")
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(requests))
+}
+
+func TestGitMetricsImpl_FilesAPI(t *testing.T) {
+	metrics := GitMetricsImpl{}
+	assert.Equal(t, config.Defaults().FilesAPI, metrics.filesAPI())
+
+	metrics.Config = config.NewStaticStore(&config.Config{FilesAPI: "https://github.example.com/api/v3/repos/%s/%s/commits/%s"})
+	assert.Equal(t, "https://github.example.com/api/v3/repos/%s/%s/commits/%s", metrics.filesAPI())
+}
@@ -0,0 +1,440 @@
+package gitmetrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/machinebox/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attachBatchSize caps the commit IDs sent in one update, keeping the
+// filter well below MongoDB's 16MB document limit.
+const attachBatchSize = 10000
+
+// FetchReleases returns every tag of a repository, merged with the GitHub
+// releases published for them, with the commits each tag adds to the one
+// before it. Draft releases are ignored, as are tags that don't point to a
+// commit. stored maps the tags already stored to their commit ID; their
+// commits were attached when they were first stored and aren't fetched
+// again unless the tag moved.
+func FetchReleases(client GraphQLClient, user, repo, token string, stored map[string]string) ([]Release, error) {
+	releases, err := fetchTags(client, user, repo, token)
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := fetchGitHubReleases(client, user, repo, token)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range releases {
+		if release, ok := published[releases[i].TagName]; ok {
+			releases[i].Name = release.Name
+			releases[i].ReleasedAt = release.ReleasedAt
+			releases[i].GitHubRelease = true
+			releases[i].Prerelease = release.Prerelease
+		}
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].CommitDate.Before(releases[j].CommitDate)
+	})
+
+	for i := range releases {
+		if commitID, ok := stored[releases[i].TagName]; ok && commitID == releases[i].CommitID {
+			continue
+		}
+		var base string
+		if i > 0 {
+			base = releases[i-1].TagName
+		}
+		if releases[i].Commits, err = fetchReleaseCommits(client, user, repo, base, releases[i], token); err != nil {
+			return nil, err
+		}
+	}
+
+	return releases, nil
+}
+
+func fetchTags(client GraphQLClient, user, repo, token string) ([]Release, error) {
+	var releases []Release
+	var cursor *string
+
+	for {
+		req := graphql.NewRequest(`
+			query($user: String!, $repo: String!, $cursor: String) {
+				repository(owner: $user, name: $repo) {
+					refs(refPrefix: "refs/tags/", first: 100, after: $cursor) {
+						nodes {
+							name
+							target {
+								... on Commit {
+									oid
+									committedDate
+								}
+								... on Tag {
+									tagger {
+										date
+									}
+									target {
+										... on Commit {
+											oid
+											committedDate
+										}
+									}
+								}
+							}
+						}
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
+					}
+				}
+			}
+		`)
+
+		req.Var("user", user)
+		req.Var("repo", repo)
+		req.Var("cursor", cursor)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		type tagCommit struct {
+			Oid           string    `json:"oid"`
+			CommittedDate time.Time `json:"committedDate"`
+		}
+
+		var respData struct {
+			Repository struct {
+				Refs struct {
+					Nodes []struct {
+						Name   string `json:"name"`
+						Target struct {
+							tagCommit
+							Tagger *struct {
+								Date time.Time `json:"date"`
+							} `json:"tagger"`
+							Target tagCommit `json:"target"`
+						} `json:"target"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"refs"`
+			} `json:"repository"`
+		}
+
+		if err := runGraphQL(client, "tags", req, &respData); err != nil {
+			return nil, err
+		}
+
+		for _, node := range respData.Repository.Refs.Nodes {
+			release := Release{Owner: user, RepoName: repo, TagName: node.Name}
+			switch {
+			case node.Target.Oid != "":
+				release.CommitID = node.Target.Oid
+				release.CommitDate = node.Target.CommittedDate
+				release.ReleasedAt = node.Target.CommittedDate
+			case node.Target.Target.Oid != "":
+				release.CommitID = node.Target.Target.Oid
+				release.CommitDate = node.Target.Target.CommittedDate
+				release.ReleasedAt = node.Target.Target.CommittedDate
+				if node.Target.Tagger != nil && !node.Target.Tagger.Date.IsZero() {
+					release.ReleasedAt = node.Target.Tagger.Date
+				}
+			default:
+				continue
+			}
+			releases = append(releases, release)
+		}
+
+		if !respData.Repository.Refs.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &respData.Repository.Refs.PageInfo.EndCursor
+	}
+
+	return releases, nil
+}
+
+func fetchGitHubReleases(client GraphQLClient, user, repo, token string) (map[string]Release, error) {
+	releases := make(map[string]Release)
+	var cursor *string
+
+	for {
+		req := graphql.NewRequest(`
+			query($user: String!, $repo: String!, $cursor: String) {
+				repository(owner: $user, name: $repo) {
+					releases(first: 100, after: $cursor) {
+						nodes {
+							tagName
+							name
+							publishedAt
+							isDraft
+							isPrerelease
+						}
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
+					}
+				}
+			}
+		`)
+
+		req.Var("user", user)
+		req.Var("repo", repo)
+		req.Var("cursor", cursor)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		var respData struct {
+			Repository struct {
+				Releases struct {
+					Nodes []struct {
+						TagName      string     `json:"tagName"`
+						Name         string     `json:"name"`
+						PublishedAt  *time.Time `json:"publishedAt"`
+						IsDraft      bool       `json:"isDraft"`
+						IsPrerelease bool       `json:"isPrerelease"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"releases"`
+			} `json:"repository"`
+		}
+
+		if err := runGraphQL(client, "releases", req, &respData); err != nil {
+			return nil, err
+		}
+
+		for _, node := range respData.Repository.Releases.Nodes {
+			if node.IsDraft || node.PublishedAt == nil {
+				continue
+			}
+			releases[node.TagName] = Release{
+				TagName:    node.TagName,
+				Name:       node.Name,
+				ReleasedAt: *node.PublishedAt,
+				Prerelease: node.IsPrerelease,
+			}
+		}
+
+		if !respData.Repository.Releases.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &respData.Repository.Releases.PageInfo.EndCursor
+	}
+
+	return releases, nil
+}
+
+// fetchReleaseCommits returns the commits release contains and the base tag
+// doesn't, as GitHub compares them. Without a base, every commit in the
+// history of the release is returned.
+func fetchReleaseCommits(client GraphQLClient, user, repo, base string, release Release, token string) ([]string, error) {
+	var commits []string
+	var cursor *string
+
+	for {
+		var req *graphql.Request
+		if base == "" {
+			req = graphql.NewRequest(`
+				query($user: String!, $repo: String!, $oid: GitObjectID!, $cursor: String) {
+					repository(owner: $user, name: $repo) {
+						object(oid: $oid) {
+							... on Commit {
+								history(first: 100, after: $cursor) {
+									nodes {
+										oid
+									}
+									pageInfo {
+										hasNextPage
+										endCursor
+									}
+								}
+							}
+						}
+					}
+				}
+			`)
+			req.Var("oid", release.CommitID)
+		} else {
+			req = graphql.NewRequest(`
+				query($user: String!, $repo: String!, $base: String!, $head: String!, $cursor: String) {
+					repository(owner: $user, name: $repo) {
+						ref(qualifiedName: $base) {
+							compare(headRef: $head) {
+								commits(first: 100, after: $cursor) {
+									nodes {
+										oid
+									}
+									pageInfo {
+										hasNextPage
+										endCursor
+									}
+								}
+							}
+						}
+					}
+				}
+			`)
+			req.Var("base", "refs/tags/"+base)
+			req.Var("head", "refs/tags/"+release.TagName)
+		}
+
+		req.Var("user", user)
+		req.Var("repo", repo)
+		req.Var("cursor", cursor)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		type commitConnection struct {
+			Nodes []struct {
+				Oid string `json:"oid"`
+			} `json:"nodes"`
+			PageInfo struct {
+				HasNextPage bool   `json:"hasNextPage"`
+				EndCursor   string `json:"endCursor"`
+			} `json:"pageInfo"`
+		}
+
+		var respData struct {
+			Repository struct {
+				Object *struct {
+					History commitConnection `json:"history"`
+				} `json:"object"`
+				Ref *struct {
+					Compare *struct {
+						Commits commitConnection `json:"commits"`
+					} `json:"compare"`
+				} `json:"ref"`
+			} `json:"repository"`
+		}
+
+		if err := runGraphQL(client, "release_commits", req, &respData); err != nil {
+			return nil, fmt.Errorf("failed to fetch commits of release %s: %w", release.TagName, err)
+		}
+
+		var page commitConnection
+		switch {
+		case respData.Repository.Object != nil:
+			page = respData.Repository.Object.History
+		case respData.Repository.Ref != nil && respData.Repository.Ref.Compare != nil:
+			page = respData.Repository.Ref.Compare.Commits
+		default:
+			return nil, fmt.Errorf("failed to fetch commits of release %s: tag not found in %s/%s", release.TagName, user, repo)
+		}
+
+		for _, node := range page.Nodes {
+			commits = append(commits, node.Oid)
+		}
+
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &page.PageInfo.EndCursor
+	}
+
+	return commits, nil
+}
+
+// SaveReleasesToDB stores the releases of a repository and attaches every
+// stored commit that isn't part of a release yet to the first release
+// containing it. Releases stored before owners were recorded are claimed by
+// the first owner to sync them, as commits are.
+func SaveReleasesToDB(ctx context.Context, releases []Release) error {
+	collection := db.GetNamedCollection(db.ReleasesCollection)
+
+	var repositories []repository
+	tags := make(map[repository][]string)
+	for _, release := range releases {
+		key := repository{release.Owner, release.RepoName}
+		if key.owner == "" {
+			continue
+		}
+		if _, ok := tags[key]; !ok {
+			repositories = append(repositories, key)
+		}
+		tags[key] = append(tags[key], release.TagName)
+	}
+	for _, repo := range repositories {
+		filter := bson.M{"owner": "", "reponame": repo.name, "tag_name": bson.M{"$in": tags[repo]}}
+		if _, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"owner": repo.owner}}); err != nil {
+			return fmt.Errorf("failed to claim releases of %s/%s: %w", repo.owner, repo.name, err)
+		}
+	}
+
+	for _, release := range releases {
+		filter := bson.M{"owner": release.Owner, "reponame": release.RepoName, "tag_name": release.TagName}
+		update := bson.M{"$set": release}
+		opts := options.Update().SetUpsert(true)
+		_, err := collection.UpdateOne(ctx, filter, update, opts)
+		if err != nil {
+			return fmt.Errorf("failed to update release: %w", err)
+		}
+	}
+
+	return AttachCommitsToReleases(ctx, releases)
+}
+
+// StoredReleases returns the tags of a repository's stored releases, mapped
+// to the commit ID each points to.
+func StoredReleases(ctx context.Context, owner, repo string) (map[string]string, error) {
+	cursor, err := db.GetNamedCollection(db.ReleasesCollection).Find(ctx, bson.M{"owner": owner, "reponame": repo})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases of %s: %w", FullName(owner, repo), err)
+	}
+	var releases []Release
+	if err := cursor.All(ctx, &releases); err != nil {
+		return nil, fmt.Errorf("failed to decode releases of %s: %w", FullName(owner, repo), err)
+	}
+
+	stored := make(map[string]string, len(releases))
+	for _, release := range releases {
+		stored[release.TagName] = release.CommitID
+	}
+	return stored, nil
+}
+
+// AttachCommitsToReleases sets release_tag and released_at on the stored
+// commits of each release, as read from GitHub. Releases are attached oldest
+// first and commits that already belong to a release are left alone, so a
+// commit ends up in the first release containing it. Large releases are
+// attached in batches of attachBatchSize commits.
+func AttachCommitsToReleases(ctx context.Context, releases []Release) error {
+	sorted := make([]Release, len(releases))
+	copy(sorted, releases)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CommitDate.Before(sorted[j].CommitDate)
+	})
+
+	collection := db.GetCollection()
+	for _, release := range sorted {
+		update := bson.M{"$set": bson.M{
+			"release_tag": release.TagName,
+			"released_at": release.ReleasedAt,
+		}}
+		for start := 0; start < len(release.Commits); start += attachBatchSize {
+			end := min(start+attachBatchSize, len(release.Commits))
+			filter := bson.M{
+				"owner":       release.Owner,
+				"reponame":    release.RepoName,
+				"commit_id":   bson.M{"$in": release.Commits[start:end]},
+				"release_tag": bson.M{"$exists": false},
+			}
+			if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+				return fmt.Errorf("failed to attach commits to release %s: %w", release.TagName, err)
+			}
+		}
+	}
+
+	return nil
+}
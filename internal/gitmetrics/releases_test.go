@@ -0,0 +1,245 @@
+package gitmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// respondWith makes the next Run call on the mock decode the given JSON.
+func respondWith(t *testing.T, client *MockGraphQLClient, response string) {
+	client.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+		assert.NoError(t, json.Unmarshal([]byte(response), args.Get(2)))
+	})
+}
+
+func TestFetchReleases_Success(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"refs":{"nodes":[
+		{"name":"v1.1.0","target":{"tagger":{"date":"2024-02-02T00:00:00Z"},"target":{"oid":"bbb","committedDate":"2024-02-01T00:00:00Z"}}},
+		{"name":"v1.0.0","target":{"oid":"aaa","committedDate":"2024-01-01T00:00:00Z"}},
+		{"name":"tree-tag","target":{}}
+	],"pageInfo":{"hasNextPage":false}}}}`)
+	respondWith(t, mockClient, `{"repository":{"releases":{"nodes":[
+		{"tagName":"v1.0.0","name":"First","publishedAt":"2024-01-03T00:00:00Z","isPrerelease":true},
+		{"tagName":"v1.1.0","name":"Draft","isDraft":true}
+	],"pageInfo":{"hasNextPage":false}}}}`)
+	// The first tag contains its whole history; later tags add what GitHub
+	// compares to the tag before them.
+	respondWith(t, mockClient, `{"repository":{"object":{"history":{"nodes":[{"oid":"aaa"}],"pageInfo":{"hasNextPage":true,"endCursor":"c1"}}}}}`)
+	respondWith(t, mockClient, `{"repository":{"object":{"history":{"nodes":[{"oid":"000"}],"pageInfo":{"hasNextPage":false}}}}}`)
+	respondWith(t, mockClient, `{"repository":{"ref":{"compare":{"commits":{"nodes":[{"oid":"a1b"},{"oid":"bbb"}],"pageInfo":{"hasNextPage":false}}}}}}`)
+
+	releases, err := FetchReleases(mockClient, "user", "repo", "token", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Release{
+		{
+			Owner:         "user",
+			RepoName:      "repo",
+			TagName:       "v1.0.0",
+			Name:          "First",
+			CommitID:      "aaa",
+			CommitDate:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ReleasedAt:    time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			GitHubRelease: true,
+			Prerelease:    true,
+			Commits:       []string{"aaa", "000"},
+		},
+		{
+			Owner:      "user",
+			RepoName:   "repo",
+			TagName:    "v1.1.0",
+			CommitID:   "bbb",
+			CommitDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			ReleasedAt: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+			Commits:    []string{"a1b", "bbb"},
+		},
+	}, releases)
+	mockClient.AssertExpectations(t)
+}
+
+func TestFetchReleases_SkipsStoredReleases(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"refs":{"nodes":[
+		{"name":"v1.0.0","target":{"oid":"aaa","committedDate":"2024-01-01T00:00:00Z"}},
+		{"name":"v1.1.0","target":{"oid":"bbb","committedDate":"2024-02-01T00:00:00Z"}}
+	],"pageInfo":{"hasNextPage":false}}}}`)
+	respondWith(t, mockClient, `{"repository":{"releases":{"nodes":[],"pageInfo":{"hasNextPage":false}}}}`)
+	// Only v1.1.0 is new, so the history of v1.0.0 isn't walked again.
+	respondWith(t, mockClient, `{"repository":{"ref":{"compare":{"commits":{"nodes":[{"oid":"bbb"}],"pageInfo":{"hasNextPage":false}}}}}}`)
+
+	releases, err := FetchReleases(mockClient, "user", "repo", "token", map[string]string{"v1.0.0": "aaa"})
+	assert.NoError(t, err)
+	assert.Len(t, releases, 2)
+	assert.Nil(t, releases[0].Commits)
+	assert.Equal(t, []string{"bbb"}, releases[1].Commits)
+	mockClient.AssertExpectations(t)
+}
+
+func TestFetchReleases_Error(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("failed to fetch tags"))
+
+	releases, err := FetchReleases(mockClient, "user", "repo", "token", nil)
+	assert.Error(t, err)
+	assert.Nil(t, releases)
+	assert.Contains(t, err.Error(), "failed to fetch tags")
+}
+
+func TestFetchReleases_ReleasesError(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"refs":{"nodes":[],"pageInfo":{"hasNextPage":false}}}}`)
+	mockClient.On("Run", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("failed to fetch releases"))
+
+	releases, err := FetchReleases(mockClient, "user", "repo", "token", nil)
+	assert.Error(t, err)
+	assert.Nil(t, releases)
+	assert.Contains(t, err.Error(), "failed to fetch releases")
+}
+
+func TestFetchReleases_TagNotFound(t *testing.T) {
+	mockClient := new(MockGraphQLClient)
+	respondWith(t, mockClient, `{"repository":{"refs":{"nodes":[
+		{"name":"v1.0.0","target":{"oid":"aaa","committedDate":"2024-01-01T00:00:00Z"}}
+	],"pageInfo":{"hasNextPage":false}}}}`)
+	respondWith(t, mockClient, `{"repository":{"releases":{"nodes":[],"pageInfo":{"hasNextPage":false}}}}`)
+	respondWith(t, mockClient, `{"repository":{"object":null}}`)
+
+	_, err := FetchReleases(mockClient, "user", "repo", "token", nil)
+	assert.ErrorContains(t, err, "failed to fetch commits of release v1.0.0: tag not found in user/repo")
+}
+
+func TestSaveReleasesToDB_Success(t *testing.T) {
+	releases := []Release{
+		{Owner: "acme", RepoName: "repo1", TagName: "v1.1.0", CommitDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), ReleasedAt: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC), Commits: []string{"c2", "c3"}},
+		{Owner: "acme", RepoName: "repo1", TagName: "v1.0.0", CommitDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ReleasedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Commits: []string{"c1"}},
+		{Owner: "acme", RepoName: "repo1", TagName: "v1.0.1", CommitDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), ReleasedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	releaseCollection := new(db.MockCollection)
+	// Releases stored before owners were recorded are claimed first.
+	releaseCollection.On("UpdateMany", mock.Anything,
+		bson.M{"owner": "", "reponame": "repo1", "tag_name": bson.M{"$in": []string{"v1.1.0", "v1.0.0", "v1.0.1"}}},
+		bson.M{"$set": bson.M{"owner": "acme"}}, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	releaseCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "tag_name": "v1.1.0"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	releaseCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "tag_name": "v1.0.0"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	releaseCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1", "tag_name": "v1.0.1"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	var attached []string
+	members := make(map[string]interface{})
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		filter := args.Get(1).(bson.M)
+		assert.Equal(t, bson.M{"$exists": false}, filter["release_tag"])
+		assert.Equal(t, "acme", filter["owner"])
+		update := args.Get(2).(bson.M)["$set"].(bson.M)
+		attached = append(attached, update["release_tag"].(string))
+		members[update["release_tag"].(string)] = filter["commit_id"]
+	})
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() {
+		db.GetNamedCollectionFunc = originalGetNamedCollectionFunc
+		db.GetCollectionFunc = originalGetCollectionFunc
+	}()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.ReleasesCollection, name)
+		return releaseCollection
+	}
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+
+	metrics := GitMetricsImpl{}
+	err := metrics.SaveReleasesToDB(context.Background(), releases)
+	assert.NoError(t, err)
+	// Releases are attached oldest first so each commit lands in the first
+	// release containing it; a release adding no commits is skipped.
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, attached)
+	assert.Equal(t, bson.M{"$in": []string{"c1"}}, members["v1.0.0"])
+	assert.Equal(t, bson.M{"$in": []string{"c2", "c3"}}, members["v1.1.0"])
+	releaseCollection.AssertExpectations(t)
+}
+
+func TestSaveReleasesToDB_Error(t *testing.T) {
+	releaseCollection := new(db.MockCollection)
+	releaseCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(mongo.UpdateResult), errors.New("write failed"))
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	defer func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		return releaseCollection
+	}
+
+	err := SaveReleasesToDB(context.Background(), []Release{{RepoName: "repo1", TagName: "v1.0.0"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to update release")
+}
+
+func TestStoredReleases(t *testing.T) {
+	cursor, err := mongo.NewCursorFromDocuments([]interface{}{
+		Release{Owner: "acme", RepoName: "repo1", TagName: "v1.0.0", CommitID: "aaa"},
+	}, nil, nil)
+	assert.NoError(t, err)
+	releaseCollection := new(db.MockCollection)
+	releaseCollection.On("Find", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1"}, mock.Anything).Return(cursor, nil)
+
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	defer func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc }()
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.ReleasesCollection, name)
+		return releaseCollection
+	}
+
+	stored, err := StoredReleases(context.Background(), "acme", "repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"v1.0.0": "aaa"}, stored)
+}
+
+func TestAttachCommitsToReleases_Batches(t *testing.T) {
+	commits := make([]string, attachBatchSize+1)
+	for i := range commits {
+		commits[i] = fmt.Sprintf("c%d", i)
+	}
+
+	var batches []int
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		batches = append(batches, len(args.Get(1).(bson.M)["commit_id"].(bson.M)["$in"].([]string)))
+	})
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+
+	err := AttachCommitsToReleases(context.Background(), []Release{{Owner: "acme", RepoName: "repo1", TagName: "v1.0.0", Commits: commits}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{attachBatchSize, 1}, batches)
+}
+
+func TestAttachCommitsToReleases_Error(t *testing.T) {
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(mongo.UpdateResult), errors.New("write failed"))
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+
+	err := AttachCommitsToReleases(context.Background(), []Release{{RepoName: "repo1", TagName: "v1.0.0", Commits: []string{"c1"}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to attach commits to release v1.0.0")
+}
@@ -0,0 +1,172 @@
+package gitmetrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RollupDay returns the UTC day a commit is counted on.
+func RollupDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// BuildRollups aggregates commits into one rollup per repository, author and
+// day, ordered by day, repository and author. Repositories are told apart by
+// owner, so a fork and its upstream have their own rollups.
+func BuildRollups(commits []Commit) []DailyRollup {
+	type rollupKey struct {
+		owner, repo, author, login string
+		day                        time.Time
+	}
+	rollups := make(map[rollupKey]*DailyRollup)
+	for _, commit := range commits {
+		key := rollupKey{commit.Owner, commit.RepoName, commit.CommittedBy, commit.AuthorLogin, RollupDay(commit.CommitDate)}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &DailyRollup{Owner: key.owner, RepoName: key.repo, Author: key.author, AuthorLogin: key.login, Day: key.day}
+			rollups[key] = rollup
+		}
+		rollup.Commits++
+		rollup.LinesAdded += commit.LinesAdded
+		rollup.LinesDeleted += commit.LinesDeleted
+		rollup.FilesAdded += commit.FilesAdded
+		rollup.FilesDeleted += commit.FilesDeleted
+		rollup.FilesUpdated += commit.FilesUpdated
+	}
+
+	result := make([]DailyRollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		result = append(result, *rollup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+		if a.RepoName != b.RepoName {
+			return a.RepoName < b.RepoName
+		}
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		if a.Author != b.Author {
+			return a.Author < b.Author
+		}
+		return a.AuthorLogin < b.AuthorLogin
+	})
+	return result
+}
+
+func rollupFilter(rollup DailyRollup) bson.M {
+	return bson.M{"owner": rollup.Owner, "reponame": rollup.RepoName, "author": rollup.Author, "author_login": rollup.AuthorLogin, "day": rollup.Day}
+}
+
+// IncrementRollups adds newly stored commits to their daily rollups.
+func IncrementRollups(ctx context.Context, commits []Commit) error {
+	return incrementRollups(ctx, BuildRollups(commits))
+}
+
+// AdjustRollups moves the contribution of commits to their daily rollups
+// from their stored values to their repaired values. stored and repaired
+// hold the same commits.
+func AdjustRollups(ctx context.Context, stored, repaired []Commit) error {
+	deltas := BuildRollups(repaired)
+	index := make(map[string]int, len(deltas))
+	key := func(r DailyRollup) string {
+		return r.Owner + "\x00" + r.RepoName + "\x00" + r.Author + "\x00" + r.AuthorLogin + "\x00" + r.Day.Format(time.RFC3339)
+	}
+	for i, rollup := range deltas {
+		index[key(rollup)] = i
+	}
+	for _, rollup := range BuildRollups(stored) {
+		i, ok := index[key(rollup)]
+		if !ok {
+			deltas = append(deltas, DailyRollup{Owner: rollup.Owner, RepoName: rollup.RepoName, Author: rollup.Author, AuthorLogin: rollup.AuthorLogin, Day: rollup.Day})
+			i = len(deltas) - 1
+			index[key(rollup)] = i
+		}
+		delta := &deltas[i]
+		delta.Commits -= rollup.Commits
+		delta.LinesAdded -= rollup.LinesAdded
+		delta.LinesDeleted -= rollup.LinesDeleted
+		delta.FilesAdded -= rollup.FilesAdded
+		delta.FilesDeleted -= rollup.FilesDeleted
+		delta.FilesUpdated -= rollup.FilesUpdated
+	}
+
+	changed := deltas[:0]
+	for _, delta := range deltas {
+		if delta != (DailyRollup{Owner: delta.Owner, RepoName: delta.RepoName, Author: delta.Author, AuthorLogin: delta.AuthorLogin, Day: delta.Day}) {
+			changed = append(changed, delta)
+		}
+	}
+	return incrementRollups(ctx, changed)
+}
+
+func incrementRollups(ctx context.Context, rollups []DailyRollup) error {
+	collection := db.GetNamedCollection(db.RollupsCollection)
+
+	for _, rollup := range rollups {
+		update := bson.M{"$inc": bson.M{
+			"commits":       rollup.Commits,
+			"lines_added":   rollup.LinesAdded,
+			"lines_deleted": rollup.LinesDeleted,
+			"files_added":   rollup.FilesAdded,
+			"files_deleted": rollup.FilesDeleted,
+			"files_updated": rollup.FilesUpdated,
+		}}
+		opts := options.Update().SetUpsert(true)
+		_, err := collection.UpdateOne(ctx, rollupFilter(rollup), update, opts)
+		if err != nil {
+			return fmt.Errorf("failed to update rollup: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RebuildRollups recomputes the rollups of a repository from the stored
+// commits and returns how many rollups were written. An empty owner or repo
+// matches every owner or repository. Rollups are briefly incomplete while
+// being rebuilt.
+func RebuildRollups(ctx context.Context, owner, repo string) (int, error) {
+	filter := bson.M{}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+	if repo != "" {
+		filter["reponame"] = repo
+	}
+
+	cursor, err := db.GetCollection().Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query commits: %w", err)
+	}
+	var commits []Commit
+	if err := cursor.All(ctx, &commits); err != nil {
+		return 0, fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	collection := db.GetNamedCollection(db.RollupsCollection)
+	if _, err := collection.DeleteMany(ctx, filter); err != nil {
+		return 0, fmt.Errorf("failed to clear rollups: %w", err)
+	}
+
+	rollups := BuildRollups(commits)
+	for _, rollup := range rollups {
+		opts := options.Update().SetUpsert(true)
+		_, err := collection.UpdateOne(ctx, rollupFilter(rollup), bson.M{"$set": rollup}, opts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update rollup: %w", err)
+		}
+	}
+
+	return len(rollups), nil
+}
@@ -0,0 +1,241 @@
+package gitmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func rollupCommits() []Commit {
+	return []Commit{
+		{CommitID: "c1", RepoName: "repo1", CommittedBy: "alice", CommitDate: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), LinesAdded: 10, LinesDeleted: 2, FilesAdded: 1},
+		// 23:30 in UTC-5 is already the next day in UTC.
+		{CommitID: "c2", RepoName: "repo1", CommittedBy: "alice", CommitDate: time.Date(2024, 1, 1, 23, 30, 0, 0, time.FixedZone("EST", -5*3600)), LinesAdded: 5, FilesUpdated: 2},
+		{CommitID: "c3", RepoName: "repo1", CommittedBy: "alice", CommitDate: time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), LinesAdded: 1, LinesDeleted: 1, FilesDeleted: 1},
+		{CommitID: "c4", RepoName: "repo1", CommittedBy: "bob", CommitDate: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), LinesAdded: 7},
+	}
+}
+
+// mockRollupCollection makes db.GetNamedCollection return the given mock for
+// the rollups collection.
+func mockRollupCollection(t *testing.T, collection *db.MockCollection) {
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	t.Cleanup(func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc })
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.RollupsCollection, name)
+		return collection
+	}
+}
+
+func TestBuildRollups(t *testing.T) {
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []DailyRollup{
+		{RepoName: "repo1", Author: "alice", Day: day1, Commits: 2, LinesAdded: 11, LinesDeleted: 3, FilesAdded: 1, FilesDeleted: 1},
+		{RepoName: "repo1", Author: "bob", Day: day1, Commits: 1, LinesAdded: 7},
+		{RepoName: "repo1", Author: "alice", Day: day2, Commits: 1, LinesAdded: 5, FilesUpdated: 2},
+	}, BuildRollups(rollupCommits()))
+}
+
+func TestBuildRollups_SeparatesOwners(t *testing.T) {
+	commit := rollupCommits()[0]
+	fork := commit
+	fork.Owner = "fork"
+
+	rollups := BuildRollups([]Commit{commit, fork})
+
+	// The same commit in a fork and its upstream counts once in each.
+	assert.Len(t, rollups, 2)
+	assert.Equal(t, "", rollups[0].Owner)
+	assert.Equal(t, "fork", rollups[1].Owner)
+	assert.Equal(t, 1, rollups[1].Commits)
+}
+
+func TestSaveCommitsToDB_IncrementsRollupsForNewCommits(t *testing.T) {
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "", "reponame": "repo1", "commit_id": "c1"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{UpsertedCount: 1}, nil)
+	commitCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "", "reponame": "repo1", "commit_id": "c4"}, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	var increments []bson.M
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		assert.Equal(t, bson.M{"owner": "", "reponame": "repo1", "author": "alice", "author_login": "", "day": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, args.Get(1))
+		increments = append(increments, args.Get(2).(bson.M)["$inc"].(bson.M))
+	})
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+	mockRollupCollection(t, rollupCollection)
+
+	commits := rollupCommits()
+	_, err := SaveCommitsToDB(context.Background(), []Commit{commits[0], commits[3]})
+	assert.NoError(t, err)
+	// c4 was already stored, so only c1 is counted.
+	assert.Equal(t, []bson.M{{
+		"commits": 1, "lines_added": 10, "lines_deleted": 2,
+		"files_added": 1, "files_deleted": 0, "files_updated": 0,
+	}}, increments)
+}
+
+func TestIncrementRollups_Error(t *testing.T) {
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(mongo.UpdateResult), errors.New("write failed"))
+	mockRollupCollection(t, rollupCollection)
+
+	err := IncrementRollups(context.Background(), rollupCommits())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to update rollup")
+}
+
+func TestRebuildRollups(t *testing.T) {
+	docs := make([]interface{}, 0)
+	for _, commit := range rollupCommits() {
+		docs = append(docs, commit)
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("Find", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1"}, mock.Anything).Return(cursor, nil)
+
+	var written []DailyRollup
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("DeleteMany", mock.Anything, bson.M{"owner": "acme", "reponame": "repo1"}, mock.Anything).Return(&mongo.DeleteResult{DeletedCount: 5}, nil)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		written = append(written, args.Get(2).(bson.M)["$set"].(DailyRollup))
+	})
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+	mockRollupCollection(t, rollupCollection)
+
+	count, err := RebuildRollups(context.Background(), "acme", "repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Len(t, written, 3)
+	assert.Equal(t, 2, written[0].Commits)
+	rollupCollection.AssertExpectations(t)
+}
+
+func TestRebuildRollups_QueryError(t *testing.T) {
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("Find", mock.Anything, bson.M{}, mock.Anything).Return(nil, errors.New("database unavailable"))
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+
+	_, err := RebuildRollups(context.Background(), "", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to query commits")
+}
+
+func TestSaveCommitsToDB_RepairsIncompleteCommits(t *testing.T) {
+	commits := rollupCommits()
+	fetched := []Commit{commits[0], commits[3]}
+	for i := range fetched {
+		fetched[i].Complete = true
+		fetched[i].SchemaVersion = CommitSchemaVersion
+	}
+	// c1 was stored without its file changes; c4 is up to date.
+	stored := commits[0]
+	stored.FilesAdded = 0
+	cursor, err := mongo.NewCursorFromDocuments([]interface{}{stored}, nil, nil)
+	assert.NoError(t, err)
+
+	commitCollection := new(db.MockCollection)
+	insert := mock.MatchedBy(func(update bson.M) bool { return update["$setOnInsert"] != nil })
+	commitCollection.On("UpdateOne", mock.Anything, mock.Anything, insert, mock.Anything).
+		Return(&mongo.UpdateResult{MatchedCount: 1}, nil).Twice()
+	commitCollection.On("Find", mock.Anything, bson.M{
+		"owner":     "",
+		"reponame":  "repo1",
+		"commit_id": bson.M{"$in": []string{"c1", "c4"}},
+		"$or": bson.A{
+			bson.M{"complete": bson.M{"$ne": true}},
+			bson.M{"schema_version": bson.M{"$lt": CommitSchemaVersion}},
+		},
+	}, mock.Anything).Return(cursor, nil)
+	commitCollection.On("UpdateOne", mock.Anything, bson.M{"owner": "", "reponame": "repo1", "commit_id": "c1"}, bson.M{"$set": fetched[0]}, mock.Anything).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).Once()
+
+	var increments []bson.M
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		increments = append(increments, args.Get(2).(bson.M)["$inc"].(bson.M))
+	})
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+	mockRollupCollection(t, rollupCollection)
+
+	result, err := SaveCommitsToDB(context.Background(), fetched)
+	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{Repaired: 1, Skipped: 1}, result)
+	commitCollection.AssertExpectations(t)
+	// Only the file added by c1 is missing from its rollup.
+	assert.Equal(t, []bson.M{{
+		"commits": 0, "lines_added": 0, "lines_deleted": 0,
+		"files_added": 1, "files_deleted": 0, "files_updated": 0,
+	}}, increments)
+}
+
+func TestSaveCommitsToDB_KeepsStoredCommitsWhenFetchIsIncomplete(t *testing.T) {
+	commitCollection := new(db.MockCollection)
+	commitCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	defer func() { db.GetCollectionFunc = originalGetCollectionFunc }()
+	db.GetCollectionFunc = func() db.CollectionInterface {
+		return commitCollection
+	}
+
+	result, err := SaveCommitsToDB(context.Background(), rollupCommits())
+	assert.NoError(t, err)
+	assert.Equal(t, SaveResult{Skipped: 4}, result)
+	commitCollection.AssertNotCalled(t, "Find", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAdjustRollups(t *testing.T) {
+	var updates []bson.M
+	rollupCollection := new(db.MockCollection)
+	rollupCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil).Run(func(args mock.Arguments) {
+		updates = append(updates, bson.M{"filter": args.Get(1), "inc": args.Get(2).(bson.M)["$inc"]})
+	})
+	mockRollupCollection(t, rollupCollection)
+
+	stored := rollupCommits()[:2]
+	repaired := rollupCommits()[:2]
+	repaired[0].FilesUpdated = 3
+	repaired[0].FilesAdded = 0
+
+	assert.NoError(t, AdjustRollups(context.Background(), stored, repaired))
+
+	// c2 didn't change, so its rollup isn't touched.
+	assert.Equal(t, []bson.M{{
+		"filter": bson.M{"owner": "", "reponame": "repo1", "author": "alice", "author_login": "", "day": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"inc": bson.M{
+			"commits": 0, "lines_added": 0, "lines_deleted": 0,
+			"files_added": -1, "files_deleted": 0, "files_updated": 3,
+		},
+	}}, updates)
+}
@@ -0,0 +1,218 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a versioned change to the stored data. Each migration is
+// applied once per database, in order of Version, and recorded in the
+// migrations collection. Up must be safe to run again, since an instance can
+// stop between applying a migration and recording it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context) error
+}
+
+// Index is an index a collection must have. Collection is the default name
+// of the collection, e.g. db.CommitsCollection.
+type Index struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+}
+
+// Migrations are the data migrations, in the order they are applied. New
+// migrations are appended with the next version.
+var Migrations = []Migration{
+	{Version: 1, Name: "rename commited_by to committed_by", Up: renameCommittedBy},
+	{Version: 2, Name: "identify commits by owner", Up: identifyCommitsByOwner},
+	{Version: 3, Name: "rebuild rollups by owner", Up: rebuildRollupsByOwner},
+	{Version: 4, Name: "identify releases and deployments by owner", Up: identifyReleasesByOwner},
+}
+
+// RebuildRollupsFunc recomputes the daily rollups; a variable so tests can
+// swap it.
+var RebuildRollupsFunc = gitmetrics.RebuildRollups
+
+// Indexes are created after the migrations are applied.
+var Indexes = []Index{
+	{Collection: db.CommitsCollection, Name: "owner_reponame_commit_id", Keys: bson.D{{Key: "owner", Value: 1}, {Key: "reponame", Value: 1}, {Key: "commit_id", Value: 1}}, Unique: true},
+	{Collection: db.CommitsCollection, Name: "reponame_commit_date", Keys: bson.D{{Key: "reponame", Value: 1}, {Key: "commit_date", Value: 1}}},
+	{Collection: db.CommitsCollection, Name: "committed_by_commit_date", Keys: bson.D{{Key: "committed_by", Value: 1}, {Key: "commit_date", Value: 1}}},
+}
+
+type ownersKey struct{}
+
+// WithOwners returns a context naming the GitHub owners whose repositories
+// are stored in the database, for the migrations that need to know them.
+func WithOwners(ctx context.Context, owners []string) context.Context {
+	return context.WithValue(ctx, ownersKey{}, owners)
+}
+
+func ownersFrom(ctx context.Context) []string {
+	owners, _ := ctx.Value(ownersKey{}).([]string)
+	return owners
+}
+
+// record is the document stored for an applied migration.
+type record struct {
+	Version   int       `bson:"version"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Run applies the migrations not yet applied to the database named by ctx
+// and creates the indexes it is missing. It stops at the first migration
+// that fails, leaving the later ones for the next run. The owners of the
+// stored repositories are read from ctx, see WithOwners.
+func Run(ctx context.Context) error {
+	applied, err := appliedVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]Migration, 0, len(Migrations))
+	for _, migration := range Migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+
+	for _, migration := range pending {
+		if err := migration.Up(ctx); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		if err := recordMigration(ctx, migration); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d (%s) to %s", migration.Version, migration.Name, db.DatabaseName(ctx))
+	}
+
+	return createIndexes(ctx)
+}
+
+func appliedVersions(ctx context.Context) (map[int]bool, error) {
+	cursor, err := db.GetNamedCollection(db.MigrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %w", err)
+	}
+
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode migrations: %w", err)
+	}
+	applied := make(map[int]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+func recordMigration(ctx context.Context, migration Migration) error {
+	filter := bson.M{"version": migration.Version}
+	update := bson.M{"$setOnInsert": record{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := db.GetNamedCollection(db.MigrationsCollection).UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
+
+func createIndexes(ctx context.Context) error {
+	byCollection := make(map[string][]mongo.IndexModel)
+	var collections []string
+	for _, index := range Indexes {
+		if _, ok := byCollection[index.Collection]; !ok {
+			collections = append(collections, index.Collection)
+		}
+		opts := options.Index().SetName(index.Name)
+		if index.Unique {
+			opts.SetUnique(true)
+		}
+		byCollection[index.Collection] = append(byCollection[index.Collection], mongo.IndexModel{Keys: index.Keys, Options: opts})
+	}
+
+	for _, collection := range collections {
+		if err := db.CreateIndexesFunc(ctx, collection, byCollection[collection]); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// renameCommittedBy renames the misspelled commited_by field of commits.
+func renameCommittedBy(ctx context.Context) error {
+	filter := bson.M{"commited_by": bson.M{"$exists": true}}
+	update := bson.M{"$rename": bson.M{"commited_by": "committed_by"}}
+	_, err := db.GetCollection().UpdateMany(ctx, filter, update)
+	return err
+}
+
+// identifyCommitsByOwner drops the unique index on commit_id and reponame,
+// which would keep a fork from storing commits its upstream has, and sets
+// the owner of the commits stored before owners were recorded. When the
+// database has a single owner they are its commits. Otherwise their owner
+// isn't known and is left empty; the first sync of each claims it, see
+// gitmetrics.SaveCommitsToDB.
+func identifyCommitsByOwner(ctx context.Context) error {
+	if err := db.DropIndexFunc(ctx, db.CommitsCollection, "commit_id_reponame"); err != nil {
+		return fmt.Errorf("failed to drop index commit_id_reponame: %w", err)
+	}
+	return setOwner(ctx, db.GetCollection(), "commits")
+}
+
+// identifyReleasesByOwner sets the owner of the releases and deployments
+// stored before owners were recorded, as identifyCommitsByOwner does for
+// commits. The first sync of each claims those left without an owner.
+func identifyReleasesByOwner(ctx context.Context) error {
+	if err := setOwner(ctx, db.GetNamedCollection(db.ReleasesCollection), "releases"); err != nil {
+		return err
+	}
+	return setOwner(ctx, db.GetNamedCollection(db.DeploymentsCollection), "deployments")
+}
+
+// setOwner sets the owner of the documents of collection that have none to
+// the database's single owner. With no owner or several, the owner isn't
+// known and is left empty, which is logged.
+func setOwner(ctx context.Context, collection db.CollectionInterface, what string) error {
+	owners := ownersFrom(ctx)
+	var owner string
+	if len(owners) == 1 {
+		owner = owners[0]
+	}
+	filter := bson.M{"owner": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"owner": owner}}
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to set the owner of %s: %w", what, err)
+	}
+	if owner == "" && result.ModifiedCount > 0 {
+		log.Printf("%d %s in %s have no owner: %d owners are configured, so each is claimed by the first owner to sync it",
+			result.ModifiedCount, what, db.DatabaseName(ctx), len(owners))
+	}
+	return nil
+}
+
+// rebuildRollupsByOwner recomputes the daily rollups, which summed the
+// commits of every owner of a repository name before they recorded the owner.
+func rebuildRollupsByOwner(ctx context.Context) error {
+	count, err := RebuildRollupsFunc(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	log.Printf("Rebuilt %d rollups in %s", count, db.DatabaseName(ctx))
+	return nil
+}
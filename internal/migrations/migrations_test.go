@@ -0,0 +1,224 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mockCollections makes db.GetCollection and db.GetNamedCollection return
+// mock commits and migrations collections, with the given versions applied,
+// and records the indexes created. Dropping an index, rebuilding the rollups
+// and updating releases and deployments succeed.
+func mockCollections(t *testing.T, versions ...int) (commits, applied *db.MockCollection, indexes map[string][]mongo.IndexModel) {
+	commits, applied = new(db.MockCollection), new(db.MockCollection)
+	indexes = make(map[string][]mongo.IndexModel)
+
+	originalGetCollectionFunc := db.GetCollectionFunc
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	originalCreateIndexesFunc := db.CreateIndexesFunc
+	originalDropIndexFunc := db.DropIndexFunc
+	originalRebuildRollupsFunc := RebuildRollupsFunc
+	t.Cleanup(func() {
+		db.GetCollectionFunc = originalGetCollectionFunc
+		db.GetNamedCollectionFunc = originalGetNamedCollectionFunc
+		db.CreateIndexesFunc = originalCreateIndexesFunc
+		db.DropIndexFunc = originalDropIndexFunc
+		RebuildRollupsFunc = originalRebuildRollupsFunc
+	})
+	db.DropIndexFunc = func(ctx context.Context, name string, index string) error { return nil }
+	RebuildRollupsFunc = func(ctx context.Context, owner, repo string) (int, error) { return 0, nil }
+	db.GetCollectionFunc = func() db.CollectionInterface { return commits }
+	others := new(db.MockCollection)
+	others.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		switch name {
+		case db.ReleasesCollection, db.DeploymentsCollection:
+			return others
+		}
+		assert.Equal(t, db.MigrationsCollection, name)
+		return applied
+	}
+	db.CreateIndexesFunc = func(ctx context.Context, name string, models []mongo.IndexModel) error {
+		indexes[name] = append(indexes[name], models...)
+		return nil
+	}
+
+	docs := make([]interface{}, len(versions))
+	for i, version := range versions {
+		docs[i] = record{Version: version}
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+	applied.On("Find", mock.Anything, bson.M{}, mock.Anything).Return(cursor, nil)
+	return commits, applied, indexes
+}
+
+func TestRun_AppliesPendingMigrations(t *testing.T) {
+	commits, applied, indexes := mockCollections(t)
+	commits.On("UpdateMany", mock.Anything,
+		bson.M{"commited_by": bson.M{"$exists": true}},
+		bson.M{"$rename": bson.M{"commited_by": "committed_by"}}, mock.Anything).
+		Return(&mongo.UpdateResult{ModifiedCount: 12}, nil)
+	commits.On("UpdateMany", mock.Anything,
+		bson.M{"owner": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"owner": ""}}, mock.Anything).
+		Return(&mongo.UpdateResult{ModifiedCount: 12}, nil)
+	var dropped []string
+	db.DropIndexFunc = func(ctx context.Context, name string, index string) error {
+		dropped = append(dropped, name+"."+index)
+		return nil
+	}
+	var recorded []int
+	applied.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{UpsertedCount: 1}, nil).
+		Run(func(args mock.Arguments) { recorded = append(recorded, args.Get(1).(bson.M)["version"].(int)) })
+
+	assert.NoError(t, Run(context.Background()))
+
+	commits.AssertExpectations(t)
+	assert.Equal(t, []int{1, 2, 3, 4}, recorded)
+	assert.Equal(t, []string{"git_metrics.commit_id_reponame"}, dropped)
+	var names []string
+	for _, model := range indexes[db.CommitsCollection] {
+		names = append(names, *model.Options.Name)
+	}
+	assert.Equal(t, []string{"owner_reponame_commit_id", "reponame_commit_date", "committed_by_commit_date"}, names)
+	assert.True(t, *indexes[db.CommitsCollection][0].Options.Unique)
+	assert.Nil(t, indexes[db.CommitsCollection][1].Options.Unique)
+}
+
+func TestRun_SkipsAppliedMigrations(t *testing.T) {
+	commits, applied, indexes := mockCollections(t, 1, 2, 3, 4)
+
+	assert.NoError(t, Run(context.Background()))
+
+	commits.AssertNotCalled(t, "UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	applied.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	assert.Len(t, indexes[db.CommitsCollection], len(Indexes))
+}
+
+func TestRun_StopsAtFailedMigration(t *testing.T) {
+	commits, applied, indexes := mockCollections(t)
+	commits.On("UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{}, errors.New("not primary"))
+
+	err := Run(context.Background())
+
+	assert.ErrorContains(t, err, "migration 1 (rename commited_by to committed_by) failed: not primary")
+	applied.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	assert.Empty(t, indexes)
+}
+
+func TestRun_IndexError(t *testing.T) {
+	mockCollections(t, 1, 2, 3, 4)
+	db.CreateIndexesFunc = func(ctx context.Context, name string, models []mongo.IndexModel) error {
+		return errors.New("E11000 duplicate key error")
+	}
+
+	err := Run(context.Background())
+
+	assert.ErrorContains(t, err, "failed to create indexes on git_metrics: E11000 duplicate key error")
+}
+
+func TestRun_ResumesAfterAppliedMigrations(t *testing.T) {
+	commits, applied, _ := mockCollections(t, 1)
+	commits.On("UpdateMany", mock.Anything, bson.M{"owner": bson.M{"$exists": false}}, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{}, nil)
+	applied.On("UpdateOne", mock.Anything, bson.M{"version": 2}, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{UpsertedCount: 1}, nil)
+	applied.On("UpdateOne", mock.Anything, bson.M{"version": 3}, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{UpsertedCount: 1}, nil)
+	applied.On("UpdateOne", mock.Anything, bson.M{"version": 4}, mock.Anything, mock.Anything).
+		Return(&mongo.UpdateResult{UpsertedCount: 1}, nil)
+
+	assert.NoError(t, Run(context.Background()))
+
+	commits.AssertExpectations(t)
+	applied.AssertExpectations(t)
+}
+
+func TestIdentifyCommitsByOwner_SingleOwner(t *testing.T) {
+	commits, _, _ := mockCollections(t)
+	commits.On("UpdateMany", mock.Anything,
+		bson.M{"owner": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"owner": "acme"}}, mock.Anything).
+		Return(&mongo.UpdateResult{ModifiedCount: 3}, nil)
+
+	assert.NoError(t, identifyCommitsByOwner(WithOwners(context.Background(), []string{"acme"})))
+
+	commits.AssertExpectations(t)
+}
+
+func TestIdentifyCommitsByOwner_AmbiguousOwner(t *testing.T) {
+	commits, _, _ := mockCollections(t)
+	commits.On("UpdateMany", mock.Anything,
+		bson.M{"owner": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"owner": ""}}, mock.Anything).
+		Return(&mongo.UpdateResult{ModifiedCount: 3}, nil)
+
+	// With several owners the commits are left for the first sync to claim.
+	assert.NoError(t, identifyCommitsByOwner(WithOwners(context.Background(), []string{"acme", "acme-forks"})))
+
+	commits.AssertExpectations(t)
+}
+
+func TestRebuildRollupsByOwner(t *testing.T) {
+	mockCollections(t)
+	var rebuilt []string
+	RebuildRollupsFunc = func(ctx context.Context, owner, repo string) (int, error) {
+		rebuilt = append(rebuilt, owner+"/"+repo)
+		return 0, errors.New("not primary")
+	}
+
+	err := rebuildRollupsByOwner(context.Background())
+
+	assert.ErrorContains(t, err, "not primary")
+	// Every owner and repository is rebuilt.
+	assert.Equal(t, []string{"/"}, rebuilt)
+}
+
+func TestIdentifyReleasesByOwner(t *testing.T) {
+	mockCollections(t)
+	updated := make(map[string]*db.MockCollection)
+	for _, name := range []string{db.ReleasesCollection, db.DeploymentsCollection} {
+		collection := new(db.MockCollection)
+		collection.On("UpdateMany", mock.Anything,
+			bson.M{"owner": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"owner": "acme"}}, mock.Anything).
+			Return(&mongo.UpdateResult{ModifiedCount: 2}, nil)
+		updated[name] = collection
+	}
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface { return updated[name] }
+
+	assert.NoError(t, identifyReleasesByOwner(WithOwners(context.Background(), []string{"acme"})))
+
+	updated[db.ReleasesCollection].AssertExpectations(t)
+	updated[db.DeploymentsCollection].AssertExpectations(t)
+}
+
+func TestIdentifyCommitsByOwner_DropError(t *testing.T) {
+	commits, _, _ := mockCollections(t)
+	db.DropIndexFunc = func(ctx context.Context, name string, index string) error {
+		return errors.New("not authorized")
+	}
+
+	err := identifyCommitsByOwner(context.Background())
+
+	assert.ErrorContains(t, err, "failed to drop index commit_id_reponame: not authorized")
+	commits.AssertNotCalled(t, "UpdateMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMigrations_VersionsAreUnique(t *testing.T) {
+	seen := make(map[int]bool)
+	for _, migration := range Migrations {
+		assert.False(t, seen[migration.Version], "version %d is used twice", migration.Version)
+		seen[migration.Version] = true
+	}
+}
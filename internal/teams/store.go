@@ -0,0 +1,121 @@
+package teams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTeamNotFound is returned when no team has the requested name.
+var ErrTeamNotFound = errors.New("team not found")
+
+// LoadTeams returns every stored team, ordered by name.
+func LoadTeams(ctx context.Context) ([]Team, error) {
+	return findTeams(ctx, bson.M{})
+}
+
+// GetTeam returns the stored team with the given name.
+func GetTeam(ctx context.Context, name string) (*Team, error) {
+	teams, err := findTeams(ctx, bson.M{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, name)
+	}
+	return &teams[0], nil
+}
+
+func findTeams(ctx context.Context, filter bson.M) ([]Team, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := db.GetNamedCollection(db.TeamsCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query teams: %w", err)
+	}
+
+	teams := []Team{}
+	if err := cursor.All(ctx, &teams); err != nil {
+		return nil, fmt.Errorf("failed to decode teams: %w", err)
+	}
+	return teams, nil
+}
+
+// SaveTeam creates a team or replaces the stored team with the same name.
+func SaveTeam(ctx context.Context, team Team) error {
+	filter := bson.M{"name": team.Name}
+	update := bson.M{"$set": team}
+	opts := options.Update().SetUpsert(true)
+	_, err := db.GetNamedCollection(db.TeamsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+	return nil
+}
+
+// DeleteTeam removes the team with the given name.
+func DeleteTeam(ctx context.Context, name string) error {
+	result, err := db.GetNamedCollection(db.TeamsCollection).DeleteMany(ctx, bson.M{"name": name})
+	if err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrTeamNotFound, name)
+	}
+	return nil
+}
+
+// ParseTeamsYAML reads team definitions of the form
+//
+//	teams:
+//	  - name: platform
+//	    members: ["@alice", "Bob Smith"]
+//	    repos: [git_metrics]
+func ParseTeamsYAML(data []byte) ([]Team, error) {
+	var file teamsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse teams: %w", err)
+	}
+
+	seen := make(map[string]bool, len(file.Teams))
+	for i := range file.Teams {
+		if err := Validate(&file.Teams[i]); err != nil {
+			return nil, fmt.Errorf("invalid team %d: %w", i+1, err)
+		}
+		if seen[file.Teams[i].Name] {
+			return nil, fmt.Errorf("team %s is defined twice", file.Teams[i].Name)
+		}
+		seen[file.Teams[i].Name] = true
+	}
+	return file.Teams, nil
+}
+
+// ImportTeams stores the teams defined in YAML, replacing stored teams with
+// the same names, and returns how many were stored. Teams that are only in
+// the database are kept.
+func ImportTeams(ctx context.Context, data []byte) (int, error) {
+	teams, err := ParseTeamsYAML(data)
+	if err != nil {
+		return 0, err
+	}
+	for _, team := range teams {
+		if err := SaveTeam(ctx, team); err != nil {
+			return 0, err
+		}
+	}
+	return len(teams), nil
+}
+
+// ImportTeamsFile imports the team definitions of a YAML file.
+func ImportTeamsFile(ctx context.Context, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read teams file: %w", err)
+	}
+	return ImportTeams(ctx, data)
+}
@@ -0,0 +1,131 @@
+package teams
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const teamsYAML = `
+teams:
+  - name: platform
+    members: ["@alice", "Bob Smith"]
+    repos: [git_metrics]
+  - name: web
+    members:
+      - "@carol"
+`
+
+// mockTeamCollection makes db.GetNamedCollection return a mock teams
+// collection.
+func mockTeamCollection(t *testing.T) *db.MockCollection {
+	mockCollection := new(db.MockCollection)
+	originalGetNamedCollectionFunc := db.GetNamedCollectionFunc
+	t.Cleanup(func() { db.GetNamedCollectionFunc = originalGetNamedCollectionFunc })
+	db.GetNamedCollectionFunc = func(name string) db.CollectionInterface {
+		assert.Equal(t, db.TeamsCollection, name)
+		return mockCollection
+	}
+	return mockCollection
+}
+
+func teamCursor(t *testing.T, teams ...Team) *mongo.Cursor {
+	docs := make([]interface{}, len(teams))
+	for i, team := range teams {
+		docs[i] = team
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.NoError(t, err)
+	return cursor
+}
+
+func TestLoadTeams(t *testing.T) {
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("Find", mock.Anything, bson.M{}, mock.Anything).Return(teamCursor(t, platformTeam()), nil)
+
+	teams, err := LoadTeams(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Team{platformTeam()}, teams)
+}
+
+func TestGetTeam(t *testing.T) {
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("Find", mock.Anything, bson.M{"name": "platform"}, mock.Anything).Return(teamCursor(t, platformTeam()), nil)
+	mockCollection.On("Find", mock.Anything, bson.M{"name": "missing"}, mock.Anything).Return(teamCursor(t), nil)
+
+	team, err := GetTeam(context.Background(), "platform")
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", team.Name)
+
+	_, err = GetTeam(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+}
+
+func TestGetTeam_QueryError(t *testing.T) {
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("Find", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("database unavailable"))
+
+	_, err := GetTeam(context.Background(), "platform")
+	assert.ErrorContains(t, err, "failed to query teams")
+}
+
+func TestSaveTeam(t *testing.T) {
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("UpdateOne", mock.Anything, bson.M{"name": "platform"}, bson.M{"$set": platformTeam()}, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	assert.NoError(t, SaveTeam(context.Background(), platformTeam()))
+	mockCollection.AssertExpectations(t)
+}
+
+func TestDeleteTeam(t *testing.T) {
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"name": "platform"}, mock.Anything).Return(&mongo.DeleteResult{DeletedCount: 1}, nil)
+	mockCollection.On("DeleteMany", mock.Anything, bson.M{"name": "missing"}, mock.Anything).Return(&mongo.DeleteResult{}, nil)
+
+	assert.NoError(t, DeleteTeam(context.Background(), "platform"))
+	assert.ErrorIs(t, DeleteTeam(context.Background(), "missing"), ErrTeamNotFound)
+}
+
+func TestParseTeamsYAML(t *testing.T) {
+	teams, err := ParseTeamsYAML([]byte(teamsYAML))
+	assert.NoError(t, err)
+	assert.Equal(t, []Team{
+		platformTeam(),
+		{Name: "web", Members: []string{"@carol"}, Repos: []string{}},
+	}, teams)
+}
+
+func TestParseTeamsYAML_Errors(t *testing.T) {
+	_, err := ParseTeamsYAML([]byte("teams: [oops"))
+	assert.ErrorContains(t, err, "failed to parse teams")
+
+	_, err = ParseTeamsYAML([]byte("teams:\n  - members: ['@alice']\n"))
+	assert.ErrorContains(t, err, "invalid team 1: name is required")
+
+	_, err = ParseTeamsYAML([]byte("teams:\n  - name: web\n  - name: web\n"))
+	assert.ErrorContains(t, err, "team web is defined twice")
+}
+
+func TestImportTeamsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teams.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(teamsYAML), 0o600))
+
+	mockCollection := mockTeamCollection(t)
+	mockCollection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+	count, err := ImportTeamsFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	mockCollection.AssertNumberOfCalls(t, "UpdateOne", 2)
+
+	_, err = ImportTeamsFile(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read teams file")
+}
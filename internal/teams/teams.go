@@ -0,0 +1,94 @@
+package teams
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// loginPrefix marks a member given by GitHub login rather than author name.
+const loginPrefix = "@"
+
+// Logins returns the GitHub logins of the team's members, without the "@".
+func (t Team) Logins() []string {
+	logins := []string{}
+	for _, member := range t.Members {
+		if strings.HasPrefix(member, loginPrefix) {
+			logins = append(logins, strings.TrimPrefix(member, loginPrefix))
+		}
+	}
+	return logins
+}
+
+// Names returns the members given by commit author name.
+func (t Team) Names() []string {
+	names := []string{}
+	for _, member := range t.Members {
+		if !strings.HasPrefix(member, loginPrefix) {
+			names = append(names, member)
+		}
+	}
+	return names
+}
+
+// HasMember reports whether a commit author belongs to the team. The login
+// is used when known, otherwise the author name.
+func (t Team) HasMember(name, login string) bool {
+	for _, member := range t.Members {
+		if login != "" && member == loginPrefix+login {
+			return true
+		}
+		if member == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TeamsOf returns the names of the teams a commit author belongs to.
+func TeamsOf(teams []Team, name, login string) []string {
+	var names []string
+	for _, team := range teams {
+		if team.HasMember(name, login) {
+			names = append(names, team.Name)
+		}
+	}
+	return names
+}
+
+// Validate checks a team definition and normalizes it, trimming whitespace
+// and dropping empty and duplicate entries.
+func Validate(team *Team) error {
+	var errs []error
+
+	team.Name = strings.TrimSpace(team.Name)
+	if team.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	} else if strings.Contains(team.Name, "/") {
+		errs = append(errs, fmt.Errorf("name %q must not contain /", team.Name))
+	}
+
+	team.Members = normalize(team.Members)
+	for _, member := range team.Members {
+		if member == loginPrefix {
+			errs = append(errs, errors.New("member @ has no login"))
+		}
+	}
+	team.Repos = normalize(team.Repos)
+
+	return errors.Join(errs...)
+}
+
+func normalize(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
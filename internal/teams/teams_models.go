@@ -0,0 +1,15 @@
+package teams
+
+// Team is a group of contributors and the repositories it owns. Members are
+// GitHub logins prefixed with "@", or commit author names for contributors
+// whose commits aren't linked to a GitHub account.
+type Team struct {
+	Name    string   `bson:"name" json:"name" yaml:"name"`
+	Members []string `bson:"members" json:"members" yaml:"members"`
+	Repos   []string `bson:"repos" json:"repos" yaml:"repos"`
+}
+
+// teamsFile is the layout of a YAML team definitions file.
+type teamsFile struct {
+	Teams []Team `yaml:"teams"`
+}
@@ -0,0 +1,51 @@
+package teams
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func platformTeam() Team {
+	return Team{Name: "platform", Members: []string{"@alice", "Bob Smith"}, Repos: []string{"git_metrics"}}
+}
+
+func TestTeamLoginsAndNames(t *testing.T) {
+	team := platformTeam()
+	assert.Equal(t, []string{"alice"}, team.Logins())
+	assert.Equal(t, []string{"Bob Smith"}, team.Names())
+
+	assert.Empty(t, Team{}.Logins())
+	assert.Empty(t, Team{}.Names())
+}
+
+func TestTeamHasMember(t *testing.T) {
+	team := platformTeam()
+
+	assert.True(t, team.HasMember("Alice A.", "alice"))
+	assert.True(t, team.HasMember("Bob Smith", ""))
+	assert.True(t, team.HasMember("Bob Smith", "bobs"))
+	assert.False(t, team.HasMember("alice", ""))
+	assert.False(t, team.HasMember("Carol", "carol"))
+}
+
+func TestTeamsOf(t *testing.T) {
+	all := []Team{platformTeam(), {Name: "web", Members: []string{"@alice"}}, {Name: "data"}}
+
+	assert.Equal(t, []string{"platform", "web"}, TeamsOf(all, "Alice", "alice"))
+	assert.Nil(t, TeamsOf(all, "Carol", ""))
+}
+
+func TestValidate(t *testing.T) {
+	team := Team{Name: " platform ", Members: []string{"@alice", " @alice", "", "Bob"}, Repos: []string{"repo1", "repo1"}}
+	assert.NoError(t, Validate(&team))
+	assert.Equal(t, Team{Name: "platform", Members: []string{"@alice", "Bob"}, Repos: []string{"repo1"}}, team)
+}
+
+func TestValidate_Errors(t *testing.T) {
+	err := Validate(&Team{Members: []string{"@"}})
+	assert.ErrorContains(t, err, "name is required")
+	assert.ErrorContains(t, err, "member @ has no login")
+
+	assert.ErrorContains(t, Validate(&Team{Name: "a/b"}), "must not contain /")
+}
@@ -0,0 +1,158 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of instrumented operations.
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+// Registry holds the metrics of the service, along with the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	GitHubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "git_metrics_github_requests_total",
+		Help: "GitHub API requests by request type and status.",
+	}, []string{"type", "status"})
+
+	GitHubRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "git_metrics_github_request_duration_seconds",
+		Help:    "Latency of GitHub API requests by request type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type"})
+
+	GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "git_metrics_github_rate_limit_remaining",
+		Help: "Requests (REST) or points (GraphQL) left in the current GitHub rate limit window.",
+	}, []string{"api"})
+
+	CommitsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "git_metrics_commits_fetched_total",
+		Help: "Commits fetched from GitHub.",
+	})
+
+	CommitsInserted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "git_metrics_commits_inserted_total",
+		Help: "Fetched commits stored for the first time.",
+	})
+
+	CommitsSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "git_metrics_commits_skipped_total",
+		Help: "Fetched commits that were already stored.",
+	})
+
+	CommitsRepaired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "git_metrics_commits_repaired_total",
+		Help: "Stored commits rewritten because they were partially ingested or by an older schema version.",
+	})
+
+	MongoOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "git_metrics_mongo_operation_duration_seconds",
+		Help:    "Latency of MongoDB operations by collection, operation and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"collection", "operation", "outcome"})
+
+	SyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "git_metrics_sync_duration_seconds",
+		Help:    "Duration of GitHub sync jobs by job and outcome.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"job", "outcome"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "git_metrics_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GitHubRequests,
+		GitHubRequestDuration,
+		GitHubRateLimitRemaining,
+		CommitsFetched,
+		CommitsInserted,
+		CommitsSkipped,
+		CommitsRepaired,
+		MongoOperationDuration,
+		SyncDuration,
+		HTTPRequestDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Outcome returns the outcome label of an operation that returned err.
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeOK
+}
+
+// ObserveGitHubRequest records a GitHub API request. Status is the HTTP status
+// code of REST requests, or an outcome for GraphQL requests.
+func ObserveGitHubRequest(requestType, status string, elapsed time.Duration) {
+	GitHubRequests.WithLabelValues(requestType, status).Inc()
+	GitHubRequestDuration.WithLabelValues(requestType).Observe(elapsed.Seconds())
+}
+
+// SetRateLimitRemaining records the remaining GitHub rate limit of the rest or
+// graphql API.
+func SetRateLimitRemaining(api string, remaining int) {
+	GitHubRateLimitRemaining.WithLabelValues(api).Set(float64(remaining))
+}
+
+// ObserveMongoOperation records the latency of a MongoDB operation.
+func ObserveMongoOperation(collection, operation string, err error, elapsed time.Duration) {
+	MongoOperationDuration.WithLabelValues(collection, operation, Outcome(err)).Observe(elapsed.Seconds())
+}
+
+// ObserveSync records how long a sync job took.
+func ObserveSync(job string, err error, elapsed time.Duration) {
+	SyncDuration.WithLabelValues(job, Outcome(err)).Observe(elapsed.Seconds())
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// InstrumentHandler records the latency of the requests served by mux,
+// labelled with the pattern of the route that matched so that path
+// parameters don't create a series per value.
+func InstrumentHandler(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(recorder, r)
+		HTTPRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
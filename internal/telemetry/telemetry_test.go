@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeOK, Outcome(nil))
+	assert.Equal(t, OutcomeError, Outcome(errors.New("boom")))
+}
+
+func TestObserveGitHubRequest(t *testing.T) {
+	before := testutil.ToFloat64(GitHubRequests.WithLabelValues("commits", "200"))
+	ObserveGitHubRequest("commits", "200", 150*time.Millisecond)
+	assert.Equal(t, before+1, testutil.ToFloat64(GitHubRequests.WithLabelValues("commits", "200")))
+
+	SetRateLimitRemaining("rest", 4321)
+	assert.Equal(t, 4321.0, testutil.ToFloat64(GitHubRateLimitRemaining.WithLabelValues("rest")))
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/teams/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.Handle("/metrics", Handler())
+	handler := InstrumentHandler(mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/teams/platform", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// Requests are labelled with the route pattern, not the path.
+	assert.Contains(t, rec.Body.String(), `git_metrics_http_request_duration_seconds_count{method="GET",route="/teams/",status="404"} 1`)
+	assert.Contains(t, rec.Body.String(), "go_goroutines")
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"os"
 
-	"github.com/ShreerajShettyK/git_metrics/internal/gitmetrics"
-	"github.com/ShreerajShettyK/git_metrics/server"
+	"github.com/lep13/git_metrics/config"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/server"
 )
 
 func main() {
+	config.CommandLineArgs = os.Args[1:]
+	store, err := config.NewStore(config.LoadConfig)
+	if err != nil {
+		log.Fatalf("could not load config: %v", err)
+	}
+
 	mux := http.NewServeMux()
-	gitMetrics := &gitmetrics.GitMetricsImpl{}
-	server.StartServer(mux, gitMetrics)
+	gitMetrics := &gitmetrics.GitMetricsImpl{Config: store}
+	server.StartServer(mux, gitMetrics, store)
 }
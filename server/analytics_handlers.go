@@ -0,0 +1,714 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/analytics"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Function variables to allow swapping with mocks in tests
+var CommitTypeCountsFunc = analytics.CommitTypeCounts
+var LoadCommitsFunc = analytics.LoadCommits
+var ReleaseReportsFunc = analytics.ReleaseReports
+var DORAReportsFunc = analytics.DORAReports
+var ChurnFunc = analytics.Churn
+var FetchTagCommitDateFunc = gitmetrics.FetchTagCommitDate
+var HotspotsFunc = analytics.Hotspots
+var OwnershipFunc = analytics.Ownership
+var FetchCodeOwnersFunc = gitmetrics.FetchCodeOwners
+var CommitActivityFunc = analytics.CommitActivity
+var RebuildRollupsFunc = gitmetrics.RebuildRollups
+var RankLeaderboardFunc = analytics.RankLeaderboard
+var GetTeamFunc = teams.GetTeam
+var LoadTeamsFunc = teams.LoadTeams
+var HeatmapsFunc = analytics.Heatmaps
+var MetricTimeSeriesFunc = analytics.MetricTimeSeries
+var DetectAnomaliesFunc = analytics.DetectAnomalies
+var LoadAnomaliesFunc = analytics.LoadAnomalies
+var LanguageBreakdownsFunc = analytics.LanguageBreakdowns
+var TestRatiosFunc = analytics.TestRatios
+
+// defaultOwnershipDepth is how many directory levels ownership is reported for
+// when the depth parameter is omitted.
+const defaultOwnershipDepth = 2
+
+// defaultCodeOwnersMinShare is the share of changed lines a contributor needs
+// to be suggested as an owner when min_share is omitted.
+const defaultCodeOwnersMinShare = 0.25
+
+func registerAnalyticsRoutes(mux *http.ServeMux, graphqlClient gitmetrics.GraphQLClient, token func(context.Context) string) {
+	mux.HandleFunc("/metrics/commit-types", handleCommitTypes)
+	mux.HandleFunc("/metrics/activity", handleActivity)
+	mux.HandleFunc("/rollups/rebuild", handleRebuildRollups)
+	mux.HandleFunc("/anomalies", handleAnomalies)
+	mux.HandleFunc("/anomalies/detect", handleDetectAnomalies)
+	mux.HandleFunc("/metrics/releases", handleReleaseMetrics)
+	mux.HandleFunc("/metrics/dora", handleDORAMetrics)
+	mux.HandleFunc("/metrics/churn", handleChurn)
+	mux.HandleFunc("/metrics/leaderboard", handleLeaderboard)
+	mux.HandleFunc("/metrics/heatmap", handleHeatmap)
+	mux.HandleFunc("/metrics/timeseries", handleTimeSeries)
+	mux.HandleFunc("/metrics/languages", handleLanguages)
+	mux.HandleFunc("/metrics/test-ratio", handleTestRatio)
+	mux.HandleFunc("/metrics/hotspots", handleHotspots)
+	mux.HandleFunc("/metrics/ownership", handleOwnership)
+	mux.HandleFunc("/codeowners", func(w http.ResponseWriter, r *http.Request) {
+		handleCodeOwners(w, r, graphqlClient, token(r.Context()))
+	})
+	mux.HandleFunc("/changelog", func(w http.ResponseWriter, r *http.Request) {
+		handleChangelog(w, r, graphqlClient, token(r.Context()))
+	})
+}
+
+func handleCommitTypes(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket, err := analytics.ParseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := CommitTypeCountsFunc(r.Context(), query, bucket)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not count commit types: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket, err := analytics.ParseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	activity, err := CommitActivityFunc(r.Context(), query, bucket)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not load activity: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, activity)
+}
+
+// handleRebuildRollups recomputes the daily rollups from the stored commits,
+// of one owner or repository when the owner or repo parameter is given.
+func handleRebuildRollups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	count, err := RebuildRollupsFunc(r.Context(), params.Get("owner"), params.Get("repo"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not rebuild rollups: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"rollups": count})
+}
+
+// handleAnomalies lists the stored anomalies, optionally of one kind.
+func handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	switch kind {
+	case "", analytics.AnomalyCommit, analytics.AnomalySpike, analytics.AnomalySilence:
+	default:
+		http.Error(w, "kind must be commit, spike or silence", http.StatusBadRequest)
+		return
+	}
+
+	anomalies, err := LoadAnomaliesFunc(r.Context(), query, kind)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not load anomalies: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, anomalies)
+}
+
+// handleDetectAnomalies runs the anomaly detector over one repository, or
+// all of them without the repo parameter, optionally of one owner, and stores
+// what it finds.
+func handleDetectAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	threshold := analytics.DefaultAnomalyThreshold
+	if value := params.Get("threshold"); value != "" {
+		var err error
+		if threshold, err = strconv.ParseFloat(value, 64); err != nil || threshold <= 0 {
+			http.Error(w, "threshold must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	anomalies, err := DetectAnomaliesFunc(r.Context(), params.Get("owner"), params.Get("repo"), threshold)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not detect anomalies: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, anomalies)
+}
+
+func handleReleaseMetrics(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reports, err := ReleaseReportsFunc(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute release metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func handleDORAMetrics(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reports, err := DORAReportsFunc(r.Context(), query, r.URL.Query().Get("environment"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute DORA metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func handleChurn(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	opts := analytics.ChurnOptions{GroupBy: params.Get("group")}
+	if opts.GroupBy == "" {
+		opts.GroupBy = analytics.GroupByFile
+	}
+	switch opts.GroupBy {
+	case analytics.GroupByFile, analytics.GroupByAuthor:
+	case analytics.GroupByTeam:
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "group must be file, author or team", http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("bucket"); value != "" {
+		if opts.Bucket, err = analytics.ParseBucket(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("rework_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			http.Error(w, "rework_days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.ReworkWindow = time.Duration(days) * 24 * time.Hour
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := ChurnFunc(r.Context(), query, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute churn: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	opts, err := analytics.ParseLeaderboardOptions(params.Get("metric"), params.Get("group"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.GroupBy == analytics.GroupByTeam {
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	board, err := RankLeaderboardFunc(r.Context(), query, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not rank contributors: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(board.Entries) > limit {
+		board.Entries = board.Entries[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, board)
+}
+
+func handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	opts := analytics.HeatmapOptions{GroupBy: params.Get("group"), Location: time.UTC}
+	if name := params.Get("tz"); name != "" {
+		if opts.Location, err = time.LoadLocation(name); err != nil {
+			http.Error(w, fmt.Sprintf("invalid tz: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	opts.WorkStart, opts.WorkEnd = analytics.DefaultWorkStart, analytics.DefaultWorkEnd
+	for name, hour := range map[string]*int{"work_start": &opts.WorkStart, "work_end": &opts.WorkEnd} {
+		if value := params.Get(name); value != "" {
+			if *hour, err = strconv.Atoi(value); err != nil || *hour < 0 || *hour > 24 {
+				http.Error(w, fmt.Sprintf("%s must be an hour between 0 and 24", name), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if opts.WorkStart >= opts.WorkEnd {
+		http.Error(w, "work_start must be before work_end", http.StatusBadRequest)
+		return
+	}
+	switch opts.GroupBy {
+	case "", analytics.GroupByAuthor, analytics.GroupByRepo:
+	case analytics.GroupByTeam:
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "group must be author, repo or team", http.StatusBadRequest)
+		return
+	}
+
+	heatmaps, err := HeatmapsFunc(r.Context(), query, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute heatmaps: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, heatmaps)
+}
+
+func handleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	opts, err := analytics.ParseTimeSeriesOptions(params.Get("metric"), params.Get("group"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Bucket, err = analytics.ParseBucket(params.Get("bucket")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Window = analytics.DefaultMovingAverageWindow
+	if value := params.Get("window"); value != "" {
+		if opts.Window, err = strconv.Atoi(value); err != nil || opts.Window < 1 {
+			http.Error(w, "window must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.GroupBy == analytics.GroupByTeam {
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	series, err := MetricTimeSeriesFunc(r.Context(), query, opts)
+	if errors.Is(err, analytics.ErrTooManyPeriods) {
+		http.Error(w, fmt.Sprintf("%v; narrow from and to or use a wider bucket", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not build time series: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+func handleLanguages(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := analytics.LanguageOptions{GroupBy: r.URL.Query().Get("group")}
+	switch opts.GroupBy {
+	case "", analytics.GroupByCommit, analytics.GroupByAuthor, analytics.GroupByRepo:
+	case analytics.GroupByTeam:
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "group must be commit, repo, author or team", http.StatusBadRequest)
+		return
+	}
+
+	breakdowns, err := LanguageBreakdownsFunc(r.Context(), query, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute language breakdown: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, breakdowns)
+}
+
+func handleTestRatio(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	opts := analytics.TestRatioOptions{GroupBy: params.Get("group")}
+	if value := params.Get("untested"); value != "" {
+		if opts.UntestedOnly, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid untested: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	switch opts.GroupBy {
+	case "", analytics.GroupByCommit, analytics.GroupByPullRequest, analytics.GroupByAuthor, analytics.GroupByRepo:
+	case analytics.GroupByTeam:
+		if opts.Teams, err = LoadTeamsFunc(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "group must be commit, pr, author, repo or team", http.StatusBadRequest)
+		return
+	}
+
+	ratios, err := TestRatiosFunc(r.Context(), query, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute test ratios: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(ratios) > limit {
+		ratios = ratios[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, ratios)
+}
+
+func handleHotspots(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hotspots, err := HotspotsFunc(r.Context(), query, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute hotspots: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hotspots)
+}
+
+func handleOwnership(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	depth, err := parseDepth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ownership, err := OwnershipFunc(r.Context(), query, depth)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute ownership: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ownership)
+}
+
+// handleCodeOwners suggests a CODEOWNERS file for a repository from its
+// ownership data and compares it with the file currently on GitHub.
+func handleCodeOwners(w http.ResponseWriter, r *http.Request, graphqlClient gitmetrics.GraphQLClient, token string) {
+	params := r.URL.Query()
+	user := params.Get("user")
+	if user == "" {
+		http.Error(w, "Missing user parameter", http.StatusBadRequest)
+		return
+	}
+	query, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Repo == "" {
+		http.Error(w, "Missing repo parameter", http.StatusBadRequest)
+		return
+	}
+	// Ownership comes from the same repository as the CODEOWNERS file, not
+	// from forks of the same name.
+	query.Owner = user
+	depth, err := parseDepth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minShare := defaultCodeOwnersMinShare
+	if value := params.Get("min_share"); value != "" {
+		minShare, err = strconv.ParseFloat(value, 64)
+		if err != nil || minShare <= 0 || minShare > 1 {
+			http.Error(w, "min_share must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ownership, err := OwnershipFunc(r.Context(), query, depth)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not compute ownership: %v", err), http.StatusInternalServerError)
+		return
+	}
+	path, content, err := FetchCodeOwnersFunc(graphqlClient, user, query.Repo, token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not fetch CODEOWNERS: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	suggested := analytics.SuggestCodeOwners(ownership, minShare)
+	writeJSON(w, http.StatusOK, analytics.CodeOwnersSuggestion{
+		Repo:         query.Repo,
+		ExistingPath: path,
+		Suggested:    analytics.RenderCodeOwners(suggested),
+		Changes:      analytics.DiffCodeOwners(analytics.ParseCodeOwners(content), suggested),
+	})
+}
+
+// handleChangelog renders a Markdown changelog for the stored commits of a
+// repository between two bounds. Each bound is either a date or a tag name;
+// tags are resolved through GitHub and require the owner parameter.
+func handleChangelog(w http.ResponseWriter, r *http.Request, graphqlClient gitmetrics.GraphQLClient, token string) {
+	params := r.URL.Query()
+	repo := params.Get("repo")
+	if repo == "" {
+		http.Error(w, "Missing repo parameter", http.StatusBadRequest)
+		return
+	}
+
+	query := analytics.Query{Owner: params.Get("owner"), Repo: repo}
+	resolve := func(value string, end bool) (time.Time, error) {
+		if value == "" {
+			return time.Time{}, nil
+		}
+		if t, err := parseTime(value, end); err == nil {
+			return t, nil
+		}
+		if query.Owner == "" {
+			return time.Time{}, fmt.Errorf("owner parameter is required to resolve tag %s", value)
+		}
+		tagDate, err := FetchTagCommitDateFunc(graphqlClient, query.Owner, repo, value, token)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// GitHub dates have second precision: commits after the tag start one
+		// second later, and the tagged commit itself is included in "to".
+		return tagDate.Add(time.Second), nil
+	}
+
+	var err error
+	if query.From, err = resolve(params.Get("from"), false); err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	if query.To, err = resolve(params.Get("to"), true); err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	commits, err := LoadCommitsFunc(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not load commits: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	title := params.Get("to")
+	if title == "" {
+		title = "Unreleased"
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, analytics.GenerateChangelog(title, commits))
+}
+
+// parseQuery reads the owner, repo, author, team, from, to and
+// exclude_outliers parameters shared by the analytics endpoints.
+func parseQuery(r *http.Request) (analytics.Query, error) {
+	params := r.URL.Query()
+	query := analytics.Query{
+		Owner:  params.Get("owner"),
+		Repo:   params.Get("repo"),
+		Author: params.Get("author"),
+	}
+
+	var err error
+	if name := params.Get("team"); name != "" {
+		if query.Team, err = GetTeamFunc(r.Context(), name); err != nil {
+			return query, fmt.Errorf("invalid team: %w", err)
+		}
+	}
+	if value := params.Get("from"); value != "" {
+		if query.From, err = parseTime(value, false); err != nil {
+			return query, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if query.To, err = parseTime(value, true); err != nil {
+			return query, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if value := params.Get("exclude_outliers"); value != "" {
+		if query.ExcludeOutliers, err = strconv.ParseBool(value); err != nil {
+			return query, fmt.Errorf("invalid exclude_outliers: %w", err)
+		}
+	}
+
+	return query, nil
+}
+
+// parseLimit reads the optional limit parameter; 0 means no limit.
+func parseLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("limit must be a non-negative integer")
+	}
+	return limit, nil
+}
+
+// parseDepth reads the optional depth parameter of the ownership endpoints.
+func parseDepth(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("depth")
+	if value == "" {
+		return defaultOwnershipDepth, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("depth must be a non-negative integer")
+	}
+	return depth, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates. A plain date used as
+// the end of a range covers the whole day.
+func parseTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD) or RFC 3339 timestamp", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("could not encode response: %v", err)
+	}
+}
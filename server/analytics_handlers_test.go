@@ -0,0 +1,716 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lep13/git_metrics/internal/analytics"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAnalyticsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	registerAnalyticsRoutes(mux, nil, func(context.Context) string { return "token" })
+	return mux
+}
+
+func TestHandleCommitTypes_Success(t *testing.T) {
+	originalCommitTypeCountsFunc := CommitTypeCountsFunc
+	defer func() { CommitTypeCountsFunc = originalCommitTypeCountsFunc }()
+
+	var received analytics.Query
+	CommitTypeCountsFunc = func(ctx context.Context, q analytics.Query, bucket analytics.Bucket) ([]analytics.TypeCount, error) {
+		received = q
+		assert.Equal(t, analytics.BucketMonth, bucket)
+		return []analytics.TypeCount{{Repo: "repo1", Type: "feat", Count: 3}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/metrics/commit-types?repo=repo1&from=2024-01-01&to=2024-01-31&bucket=month", nil)
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "repo1", received.Repo)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), received.From)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), received.To)
+
+	var counts []analytics.TypeCount
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counts))
+	assert.Len(t, counts, 1)
+	assert.Equal(t, 3, counts[0].Count)
+}
+
+func TestHandleCommitTypes_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/metrics/commit-types?from=yesterday",
+		"/metrics/commit-types?bucket=fortnight",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestHandleCommitTypes_Error(t *testing.T) {
+	originalCommitTypeCountsFunc := CommitTypeCountsFunc
+	defer func() { CommitTypeCountsFunc = originalCommitTypeCountsFunc }()
+	CommitTypeCountsFunc = func(ctx context.Context, q analytics.Query, bucket analytics.Bucket) ([]analytics.TypeCount, error) {
+		return nil, errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/commit-types", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "database unavailable")
+}
+
+func TestHandleChangelog_Tags(t *testing.T) {
+	originalLoadCommitsFunc := LoadCommitsFunc
+	originalFetchTagCommitDateFunc := FetchTagCommitDateFunc
+	defer func() {
+		LoadCommitsFunc = originalLoadCommitsFunc
+		FetchTagCommitDateFunc = originalFetchTagCommitDateFunc
+	}()
+
+	tagDates := map[string]time.Time{
+		"v1.0.0": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"v1.1.0": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	FetchTagCommitDateFunc = func(client gitmetrics.GraphQLClient, user, repo, tag, token string) (time.Time, error) {
+		assert.Equal(t, "owner", user)
+		assert.Equal(t, "token", token)
+		return tagDates[tag], nil
+	}
+
+	var received analytics.Query
+	LoadCommitsFunc = func(ctx context.Context, q analytics.Query) ([]gitmetrics.Commit, error) {
+		received = q
+		return []gitmetrics.Commit{{
+			CommitID:     "abcdef0123",
+			Conventional: gitmetrics.ConventionalCommit{Type: "feat", Subject: "add things"},
+		}}, nil
+	}
+
+	req := httptest.NewRequest("GET", "/changelog?owner=owner&repo=repo1&from=v1.0.0&to=v1.1.0", nil)
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "## v1.1.0\n\n### Features\n\n* add things (abcdef0)\n", rec.Body.String())
+	assert.Equal(t, "owner", received.Owner)
+	assert.Equal(t, "repo1", received.Repo)
+	assert.Equal(t, tagDates["v1.0.0"].Add(time.Second), received.From)
+	assert.Equal(t, tagDates["v1.1.0"].Add(time.Second), received.To)
+}
+
+func TestHandleChangelog_Dates(t *testing.T) {
+	originalLoadCommitsFunc := LoadCommitsFunc
+	defer func() { LoadCommitsFunc = originalLoadCommitsFunc }()
+
+	var received analytics.Query
+	LoadCommitsFunc = func(ctx context.Context, q analytics.Query) ([]gitmetrics.Commit, error) {
+		received = q
+		return nil, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/changelog?repo=repo1&from=2024-03-01", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "## Unreleased\n\nNo changes.\n", rec.Body.String())
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), received.From)
+	assert.True(t, received.To.IsZero())
+}
+
+func TestHandleChangelog_BadRequest(t *testing.T) {
+	originalFetchTagCommitDateFunc := FetchTagCommitDateFunc
+	defer func() { FetchTagCommitDateFunc = originalFetchTagCommitDateFunc }()
+	FetchTagCommitDateFunc = func(client gitmetrics.GraphQLClient, user, repo, tag, token string) (time.Time, error) {
+		return time.Time{}, errors.New("tag not found")
+	}
+
+	for url, message := range map[string]string{
+		"/changelog":                              "Missing repo parameter",
+		"/changelog?repo=repo1&from=v1.0.0":       "owner parameter is required",
+		"/changelog?repo=repo1&owner=u&to=v9.9.9": "tag not found",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+		assert.Contains(t, rec.Body.String(), message, url)
+	}
+}
+
+func TestHandleReleaseMetrics(t *testing.T) {
+	originalReleaseReportsFunc := ReleaseReportsFunc
+	defer func() { ReleaseReportsFunc = originalReleaseReportsFunc }()
+
+	var received analytics.Query
+	ReleaseReportsFunc = func(ctx context.Context, q analytics.Query) ([]analytics.RepoReleaseReport, error) {
+		received = q
+		return []analytics.RepoReleaseReport{{Repo: "repo1", ReleaseCount: 2}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/releases?repo=repo1", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "repo1", received.Repo)
+
+	var reports []analytics.RepoReleaseReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reports))
+	assert.Equal(t, 2, reports[0].ReleaseCount)
+}
+
+func TestHandleReleaseMetrics_Error(t *testing.T) {
+	originalReleaseReportsFunc := ReleaseReportsFunc
+	defer func() { ReleaseReportsFunc = originalReleaseReportsFunc }()
+	ReleaseReportsFunc = func(ctx context.Context, q analytics.Query) ([]analytics.RepoReleaseReport, error) {
+		return nil, errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/releases", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandleDORAMetrics(t *testing.T) {
+	originalDORAReportsFunc := DORAReportsFunc
+	defer func() { DORAReportsFunc = originalDORAReportsFunc }()
+
+	DORAReportsFunc = func(ctx context.Context, q analytics.Query, environment string) ([]analytics.DORAMetrics, error) {
+		assert.Equal(t, "repo1", q.Repo)
+		assert.Equal(t, "production", environment)
+		return []analytics.DORAMetrics{{Repo: "repo1", Deployments: 4}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/dora?repo=repo1&environment=production", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var metrics []analytics.DORAMetrics
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &metrics))
+	assert.Equal(t, 4, metrics[0].Deployments)
+}
+
+func TestHandleDORAMetrics_Error(t *testing.T) {
+	originalDORAReportsFunc := DORAReportsFunc
+	defer func() { DORAReportsFunc = originalDORAReportsFunc }()
+	DORAReportsFunc = func(ctx context.Context, q analytics.Query, environment string) ([]analytics.DORAMetrics, error) {
+		return nil, errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/dora", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandleChurn(t *testing.T) {
+	originalChurnFunc := ChurnFunc
+	defer func() { ChurnFunc = originalChurnFunc }()
+
+	ChurnFunc = func(ctx context.Context, q analytics.Query, opts analytics.ChurnOptions) ([]analytics.ChurnEntry, error) {
+		assert.Equal(t, analytics.GroupByAuthor, opts.GroupBy)
+		assert.Equal(t, analytics.BucketWeek, opts.Bucket)
+		assert.Equal(t, 14*24*time.Hour, opts.ReworkWindow)
+		return []analytics.ChurnEntry{{Key: "alice"}, {Key: "bob"}, {Key: "carol"}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/churn?group=author&bucket=week&rework_days=14&limit=2", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var entries []analytics.ChurnEntry
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+}
+
+func TestHandleChurn_Defaults(t *testing.T) {
+	originalChurnFunc := ChurnFunc
+	defer func() { ChurnFunc = originalChurnFunc }()
+
+	ChurnFunc = func(ctx context.Context, q analytics.Query, opts analytics.ChurnOptions) ([]analytics.ChurnEntry, error) {
+		assert.Equal(t, analytics.GroupByFile, opts.GroupBy)
+		assert.Empty(t, opts.Bucket)
+		assert.Zero(t, opts.ReworkWindow)
+		return nil, errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/churn", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandleChurn_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/metrics/churn?group=directory",
+		"/metrics/churn?bucket=fortnight",
+		"/metrics/churn?rework_days=0",
+		"/metrics/churn?limit=-1",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestHandleHotspots(t *testing.T) {
+	originalHotspotsFunc := HotspotsFunc
+	defer func() { HotspotsFunc = originalHotspotsFunc }()
+
+	HotspotsFunc = func(ctx context.Context, q analytics.Query, limit int) ([]analytics.Hotspot, error) {
+		assert.Equal(t, "repo1", q.Repo)
+		assert.Equal(t, 5, limit)
+		return []analytics.Hotspot{{Repo: "repo1", File: "main.go", Score: 42}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/hotspots?repo=repo1&limit=5", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var hotspots []analytics.Hotspot
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hotspots))
+	assert.Equal(t, 42, hotspots[0].Score)
+
+	rec = httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/hotspots?limit=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleOwnership(t *testing.T) {
+	originalOwnershipFunc := OwnershipFunc
+	defer func() { OwnershipFunc = originalOwnershipFunc }()
+
+	var depths []int
+	OwnershipFunc = func(ctx context.Context, q analytics.Query, maxDepth int) ([]analytics.DirectoryOwnership, error) {
+		depths = append(depths, maxDepth)
+		return []analytics.DirectoryOwnership{{Repo: "repo1", Directory: "/", BusFactor: 1}}, nil
+	}
+
+	for _, url := range []string{"/metrics/ownership?repo=repo1", "/metrics/ownership?repo=repo1&depth=0"} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, url)
+	}
+	assert.Equal(t, []int{defaultOwnershipDepth, 0}, depths)
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/ownership?depth=deep", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleCodeOwners(t *testing.T) {
+	originalOwnershipFunc := OwnershipFunc
+	originalFetchCodeOwnersFunc := FetchCodeOwnersFunc
+	defer func() {
+		OwnershipFunc = originalOwnershipFunc
+		FetchCodeOwnersFunc = originalFetchCodeOwnersFunc
+	}()
+
+	OwnershipFunc = func(ctx context.Context, q analytics.Query, maxDepth int) ([]analytics.DirectoryOwnership, error) {
+		assert.Equal(t, "octo", q.Owner)
+		assert.Equal(t, "repo1", q.Repo)
+		return []analytics.DirectoryOwnership{{
+			Repo:      "octo/repo1",
+			Directory: "/",
+			Owners:    []analytics.OwnerShare{{Name: "Alice", Login: "alice", Lines: 8, Share: 0.8}, {Name: "Bob", Login: "bob", Lines: 2, Share: 0.2}},
+		}}, nil
+	}
+	FetchCodeOwnersFunc = func(client gitmetrics.GraphQLClient, user, repo, token string) (string, string, error) {
+		assert.Equal(t, "octo", user)
+		assert.Equal(t, "repo1", repo)
+		return ".github/CODEOWNERS", "* @bob\n", nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/codeowners?user=octo&repo=repo1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var suggestion analytics.CodeOwnersSuggestion
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &suggestion))
+	assert.Equal(t, ".github/CODEOWNERS", suggestion.ExistingPath)
+	assert.Contains(t, suggestion.Suggested, "* @alice\n")
+	assert.Equal(t, []analytics.CodeOwnersChange{
+		{Action: analytics.CodeOwnersActionChange, Pattern: "*", Current: []string{"@bob"}, Suggested: []string{"@alice"}},
+	}, suggestion.Changes)
+}
+
+func TestHandleCodeOwners_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/codeowners?repo=repo1",
+		"/codeowners?user=octo",
+		"/codeowners?user=octo&repo=repo1&min_share=2",
+		"/codeowners?user=octo&repo=repo1&depth=-1",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestHandleCodeOwners_FetchError(t *testing.T) {
+	originalOwnershipFunc := OwnershipFunc
+	originalFetchCodeOwnersFunc := FetchCodeOwnersFunc
+	defer func() {
+		OwnershipFunc = originalOwnershipFunc
+		FetchCodeOwnersFunc = originalFetchCodeOwnersFunc
+	}()
+
+	OwnershipFunc = func(ctx context.Context, q analytics.Query, maxDepth int) ([]analytics.DirectoryOwnership, error) {
+		return nil, nil
+	}
+	FetchCodeOwnersFunc = func(client gitmetrics.GraphQLClient, user, repo, token string) (string, string, error) {
+		return "", "", errors.New("rate limited")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/codeowners?user=octo&repo=repo1", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Contains(t, rec.Body.String(), "rate limited")
+}
+
+func TestHandleActivity(t *testing.T) {
+	originalCommitActivityFunc := CommitActivityFunc
+	defer func() { CommitActivityFunc = originalCommitActivityFunc }()
+
+	CommitActivityFunc = func(ctx context.Context, q analytics.Query, bucket analytics.Bucket) ([]analytics.Activity, error) {
+		assert.Equal(t, "repo1", q.Repo)
+		assert.Equal(t, analytics.BucketMonth, bucket)
+		return []analytics.Activity{{Repo: "repo1", Commits: 12}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/activity?repo=repo1&bucket=month", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var activity []analytics.Activity
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &activity))
+	assert.Equal(t, 12, activity[0].Commits)
+}
+
+func TestHandleActivity_Error(t *testing.T) {
+	originalCommitActivityFunc := CommitActivityFunc
+	defer func() { CommitActivityFunc = originalCommitActivityFunc }()
+	CommitActivityFunc = func(ctx context.Context, q analytics.Query, bucket analytics.Bucket) ([]analytics.Activity, error) {
+		return nil, errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/activity", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandleRebuildRollups(t *testing.T) {
+	originalRebuildRollupsFunc := RebuildRollupsFunc
+	defer func() { RebuildRollupsFunc = originalRebuildRollupsFunc }()
+
+	RebuildRollupsFunc = func(ctx context.Context, owner, repo string) (int, error) {
+		assert.Equal(t, "acme", owner)
+		assert.Equal(t, "repo1", repo)
+		return 42, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/rollups/rebuild?owner=acme&repo=repo1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"rollups":42}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/rollups/rebuild", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandleLeaderboard(t *testing.T) {
+	originalRankLeaderboardFunc := RankLeaderboardFunc
+	defer func() { RankLeaderboardFunc = originalRankLeaderboardFunc }()
+
+	RankLeaderboardFunc = func(ctx context.Context, q analytics.Query, opts analytics.LeaderboardOptions) (analytics.Leaderboard, error) {
+		assert.Equal(t, analytics.LeaderboardOptions{Metric: analytics.MetricLines, GroupBy: analytics.GroupByAuthor}, opts)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), q.From)
+		return analytics.Leaderboard{Metric: opts.Metric, Entries: []analytics.LeaderboardEntry{
+			{Rank: 1, Key: "alice"}, {Rank: 2, Key: "bob"}, {Rank: 3, Key: "carol"},
+		}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/leaderboard?metric=lines&from=2024-01-01&to=2024-01-14&limit=2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var board analytics.Leaderboard
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &board))
+	assert.Len(t, board.Entries, 2)
+}
+
+func TestHandleLeaderboard_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/metrics/leaderboard?metric=karma",
+		"/metrics/leaderboard?group=file",
+		"/metrics/leaderboard?limit=x",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestParseQuery_Team(t *testing.T) {
+	originalGetTeamFunc := GetTeamFunc
+	defer func() { GetTeamFunc = originalGetTeamFunc }()
+	GetTeamFunc = func(ctx context.Context, name string) (*teams.Team, error) {
+		if name == "platform" {
+			return &teams.Team{Name: name, Members: []string{"@alice"}}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", teams.ErrTeamNotFound, name)
+	}
+
+	query, err := parseQuery(httptest.NewRequest("GET", "/metrics/churn?team=platform", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", query.Team.Name)
+
+	_, err = parseQuery(httptest.NewRequest("GET", "/metrics/churn?team=web", nil))
+	assert.ErrorContains(t, err, "invalid team")
+}
+
+func TestHandleLeaderboard_GroupByTeam(t *testing.T) {
+	originalRankLeaderboardFunc := RankLeaderboardFunc
+	originalLoadTeamsFunc := LoadTeamsFunc
+	defer func() {
+		RankLeaderboardFunc = originalRankLeaderboardFunc
+		LoadTeamsFunc = originalLoadTeamsFunc
+	}()
+
+	LoadTeamsFunc = func(ctx context.Context) ([]teams.Team, error) {
+		return []teams.Team{{Name: "platform"}}, nil
+	}
+	RankLeaderboardFunc = func(ctx context.Context, q analytics.Query, opts analytics.LeaderboardOptions) (analytics.Leaderboard, error) {
+		assert.Equal(t, analytics.GroupByTeam, opts.GroupBy)
+		assert.Equal(t, []teams.Team{{Name: "platform"}}, opts.Teams)
+		return analytics.Leaderboard{}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/leaderboard?group=team", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleChurn_GroupByTeam(t *testing.T) {
+	originalChurnFunc := ChurnFunc
+	originalLoadTeamsFunc := LoadTeamsFunc
+	defer func() {
+		ChurnFunc = originalChurnFunc
+		LoadTeamsFunc = originalLoadTeamsFunc
+	}()
+
+	LoadTeamsFunc = func(ctx context.Context) ([]teams.Team, error) {
+		return nil, errors.New("database unavailable")
+	}
+	ChurnFunc = func(ctx context.Context, q analytics.Query, opts analytics.ChurnOptions) ([]analytics.ChurnEntry, error) {
+		t.Fatal("churn should not be computed without teams")
+		return nil, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/churn?group=team", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "could not load teams")
+}
+
+func TestHandleHeatmap(t *testing.T) {
+	originalHeatmapsFunc := HeatmapsFunc
+	defer func() { HeatmapsFunc = originalHeatmapsFunc }()
+
+	HeatmapsFunc = func(ctx context.Context, q analytics.Query, opts analytics.HeatmapOptions) ([]analytics.Heatmap, error) {
+		assert.Equal(t, "Europe/Berlin", opts.Location.String())
+		assert.Equal(t, analytics.GroupByRepo, opts.GroupBy)
+		assert.Equal(t, 8, opts.WorkStart)
+		assert.Equal(t, analytics.DefaultWorkEnd, opts.WorkEnd)
+		return []analytics.Heatmap{{Key: "repo1", Commits: 3}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/heatmap?group=repo&tz=Europe/Berlin&work_start=8", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var heatmaps []analytics.Heatmap
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &heatmaps))
+	assert.Equal(t, 3, heatmaps[0].Commits)
+}
+
+func TestHandleHeatmap_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/metrics/heatmap?tz=Mars/Olympus",
+		"/metrics/heatmap?work_start=25",
+		"/metrics/heatmap?work_start=18&work_end=9",
+		"/metrics/heatmap?group=file",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestHandleTimeSeries(t *testing.T) {
+	originalMetricTimeSeriesFunc := MetricTimeSeriesFunc
+	defer func() { MetricTimeSeriesFunc = originalMetricTimeSeriesFunc }()
+
+	MetricTimeSeriesFunc = func(ctx context.Context, q analytics.Query, opts analytics.TimeSeriesOptions) ([]analytics.TimeSeries, error) {
+		assert.Equal(t, analytics.TimeSeriesOptions{Metric: "lines_added", GroupBy: analytics.GroupByRepo, Bucket: analytics.BucketMonth, Window: 3}, opts)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), q.From)
+		return []analytics.TimeSeries{{Key: "repo1", Metric: opts.Metric, Points: []analytics.TimeSeriesPoint{{Value: 12, MovingAverage: 12}}}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/timeseries?metric=lines_added&group=repo&bucket=month&window=3&from=2024-01-01", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var series []analytics.TimeSeries
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &series))
+	assert.Equal(t, 12, series[0].Points[0].Value)
+}
+
+func TestHandleTimeSeries_BadRequest(t *testing.T) {
+	for _, url := range []string{
+		"/metrics/timeseries?metric=karma",
+		"/metrics/timeseries?group=file",
+		"/metrics/timeseries?bucket=year",
+		"/metrics/timeseries?window=0",
+	} {
+		rec := httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestHandleTimeSeries_TooManyPeriods(t *testing.T) {
+	originalMetricTimeSeriesFunc := MetricTimeSeriesFunc
+	defer func() { MetricTimeSeriesFunc = originalMetricTimeSeriesFunc }()
+
+	MetricTimeSeriesFunc = func(ctx context.Context, q analytics.Query, opts analytics.TimeSeriesOptions) ([]analytics.TimeSeries, error) {
+		return nil, fmt.Errorf("%w: more than 3660 day buckets", analytics.ErrTooManyPeriods)
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/timeseries?bucket=day&from=1900-01-01", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "time series range is too long")
+}
+
+func TestHandleDetectAnomalies(t *testing.T) {
+	originalDetectAnomaliesFunc := DetectAnomaliesFunc
+	defer func() { DetectAnomaliesFunc = originalDetectAnomaliesFunc }()
+
+	DetectAnomaliesFunc = func(ctx context.Context, owner, repo string, threshold float64) ([]analytics.Anomaly, error) {
+		assert.Equal(t, "acme", owner)
+		assert.Equal(t, "repo1", repo)
+		assert.Equal(t, 5.0, threshold)
+		return []analytics.Anomaly{{Kind: analytics.AnomalyCommit, CommitID: "c1"}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/anomalies/detect?owner=acme&repo=repo1&threshold=5", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var anomalies []analytics.Anomaly
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &anomalies))
+	assert.Equal(t, "c1", anomalies[0].CommitID)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/anomalies/detect", nil),
+		httptest.NewRequest("POST", "/anomalies/detect?threshold=-1", nil),
+	} {
+		rec = httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, req)
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestHandleAnomalies(t *testing.T) {
+	originalLoadAnomaliesFunc := LoadAnomaliesFunc
+	defer func() { LoadAnomaliesFunc = originalLoadAnomaliesFunc }()
+
+	LoadAnomaliesFunc = func(ctx context.Context, q analytics.Query, kind string) ([]analytics.Anomaly, error) {
+		assert.Equal(t, "repo1", q.Repo)
+		assert.Equal(t, analytics.AnomalySilence, kind)
+		return []analytics.Anomaly{}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/anomalies?repo=repo1&kind=silence", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/anomalies?kind=gap", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestParseQuery_Owner(t *testing.T) {
+	query, err := parseQuery(httptest.NewRequest("GET", "/metrics/churn?owner=acme&repo=repo1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", query.Owner)
+	assert.Equal(t, "repo1", query.Repo)
+}
+
+func TestParseQuery_ExcludeOutliers(t *testing.T) {
+	query, err := parseQuery(httptest.NewRequest("GET", "/metrics/churn?exclude_outliers=true", nil))
+	assert.NoError(t, err)
+	assert.True(t, query.ExcludeOutliers)
+
+	_, err = parseQuery(httptest.NewRequest("GET", "/metrics/churn?exclude_outliers=maybe", nil))
+	assert.ErrorContains(t, err, "invalid exclude_outliers")
+}
+
+func TestHandleLanguages(t *testing.T) {
+	originalLanguageBreakdownsFunc := LanguageBreakdownsFunc
+	defer func() { LanguageBreakdownsFunc = originalLanguageBreakdownsFunc }()
+
+	LanguageBreakdownsFunc = func(ctx context.Context, q analytics.Query, opts analytics.LanguageOptions) ([]analytics.LanguageBreakdown, error) {
+		assert.Equal(t, analytics.GroupByCommit, opts.GroupBy)
+		assert.Equal(t, "repo1", q.Repo)
+		return []analytics.LanguageBreakdown{{Key: "c1", Languages: []analytics.ClassLines{{Name: "Go", LinesAdded: 3}}}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/languages?repo=repo1&group=commit", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var breakdowns []analytics.LanguageBreakdown
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &breakdowns))
+	assert.Equal(t, "Go", breakdowns[0].Languages[0].Name)
+
+	rec = httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/languages?group=file", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleTestRatio(t *testing.T) {
+	originalTestRatiosFunc := TestRatiosFunc
+	defer func() { TestRatiosFunc = originalTestRatiosFunc }()
+
+	TestRatiosFunc = func(ctx context.Context, q analytics.Query, opts analytics.TestRatioOptions) ([]analytics.TestRatio, error) {
+		assert.Equal(t, analytics.TestRatioOptions{GroupBy: analytics.GroupByPullRequest, UntestedOnly: true}, opts)
+		return []analytics.TestRatio{{Key: "repo1#7"}, {Key: "repo1#8"}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/test-ratio?group=pr&untested=true&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var ratios []analytics.TestRatio
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ratios))
+	assert.Equal(t, []analytics.TestRatio{{Key: "repo1#7"}}, ratios)
+
+	for _, url := range []string{"/metrics/test-ratio?group=file", "/metrics/test-ratio?untested=maybe"} {
+		rec = httptest.NewRecorder()
+		newAnalyticsMux().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
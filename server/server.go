@@ -1,67 +1,288 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/lep13/git_metrics/config"
+	"github.com/lep13/git_metrics/internal/analytics"
 	"github.com/lep13/git_metrics/internal/db"
 	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/lep13/git_metrics/internal/migrations"
+	"github.com/lep13/git_metrics/internal/telemetry"
 	"github.com/machinebox/graphql"
 )
 
 // Function variables to allow swapping with mocks in tests
-var LoadConfigFunc = config.LoadConfig
 var InitializeMongoDBFunc = db.InitializeMongoDB
+var ReconnectMongoDBFunc = db.ReconnectMongoDB
+var RunMigrationsFunc = migrations.Run
+var CommitOwnersFunc = gitmetrics.CommitOwners
 
-func StartServer(mux *http.ServeMux, gitMetrics gitmetrics.GitMetrics) {
-	// Load Config
-	cfg, err := LoadConfigFunc()
-	if err != nil {
-		log.Fatalf("could not load config: %v", err)
-	}
+// StartServer registers the routes on mux and serves them. Every request is
+// served for a tenant (see withTenant), with the tenant's GitHub token and
+// database. Tenants and tokens are read from store on every request and
+// MongoDB is reconnected when its URI changes, so rotated secrets apply
+// without a restart; the other settings are read on startup.
+func StartServer(mux *http.ServeMux, gitMetrics gitmetrics.GitMetrics, store *config.Store) {
+	cfg := store.Get()
+	store.OnChange(reconnectOnURIChange)
+	store.StartRefresh(context.Background(), time.Duration(cfg.RefreshSeconds)*time.Second)
+
+	db.SetNames(databaseNames(cfg))
 
 	// Initialize MongoDB connection
-	err = InitializeMongoDBFunc(cfg.MongoDBURI)
+	err := InitializeMongoDBFunc(cfg.MongoDBURI)
 	if err != nil {
 		log.Fatalf("could not initialize MongoDB: %v", err)
 	}
 
+	// Bring every tenant's database up to date before serving it
+	for _, tenant := range cfg.TenantList() {
+		ctx := migrations.WithOwners(db.WithDatabase(context.Background(), tenant.Database), tenant.Owners)
+		if err := RunMigrationsFunc(ctx); err != nil {
+			log.Fatalf("could not migrate the database of tenant %s: %v", tenant.Name, err)
+		}
+	}
+
+	// Load team definitions kept in version control, if any
+	for _, tenant := range cfg.TenantList() {
+		if tenant.TeamsFile == "" {
+			continue
+		}
+		count, err := ImportTeamsFileFunc(db.WithDatabase(context.Background(), tenant.Database), tenant.TeamsFile)
+		if err != nil {
+			log.Fatalf("could not import teams of tenant %s: %v", tenant.Name, err)
+		}
+		log.Printf("Imported %d teams of tenant %s from %s", count, tenant.Name, tenant.TeamsFile)
+	}
+
+	if err := analytics.SetTestPatterns(cfg.TestPatterns); err != nil {
+		log.Fatalf("could not load test patterns: %v", err)
+	}
+
 	graphqlClient := graphql.NewClient("https://api.github.com/graphql")
 	httpClient := &http.Client{}
 
 	mux.HandleFunc("/commits", func(w http.ResponseWriter, r *http.Request) {
-		user := r.URL.Query().Get("user")
-		if user == "" {
-			http.Error(w, "Missing user parameter", http.StatusBadRequest)
+		owners, ok := syncOwners(w, r)
+		if !ok {
 			return
 		}
+		token := tenantFrom(r.Context()).GitHubToken
 
-		repositories, err := gitMetrics.FetchRepositoriesSimple(graphqlClient, user, cfg.GitHubToken)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("could not fetch repositories: %v", err), http.StatusInternalServerError)
+		var total gitmetrics.SaveResult
+		for _, user := range owners {
+			repositories, err := gitMetrics.FetchRepositoriesSimple(graphqlClient, user, token)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("could not fetch repositories: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			for _, repo := range repositories {
+				start := time.Now()
+				commits, err := gitMetrics.FetchCommits(graphqlClient, httpClient, user, repo.Name, token)
+				if err != nil {
+					telemetry.ObserveSync("commits", err, time.Since(start))
+					log.Printf("could not fetch commits for repo %s: %v", repo.Name, err)
+					continue // Skip this repository and continue with the next one
+				}
+
+				result, err := gitMetrics.SaveCommitsToDB(r.Context(), commits)
+				telemetry.ObserveSync("commits", err, time.Since(start))
+				if err != nil {
+					log.Printf("could not save commits for repo %s: %v", repo.Name, err)
+					continue // Skip saving this repository's commits and continue with the next one
+				}
+				if result.Repaired > 0 {
+					log.Printf("repaired %d incomplete commits of %s/%s", result.Repaired, user, repo.Name)
+				}
+				total.Inserted += result.Inserted
+				total.Repaired += result.Repaired
+				total.Skipped += result.Skipped
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Commits fetched and stored in MongoDB successfully. Inserted %d, repaired %d, unchanged %d.",
+			total.Inserted, total.Repaired, total.Skipped)
+	})
+
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {
+		owners, ok := syncOwners(w, r)
+		if !ok {
 			return
 		}
+		token := tenantFrom(r.Context()).GitHubToken
 
-		for _, repo := range repositories {
-			commits, err := gitMetrics.FetchCommits(graphqlClient, httpClient, user, repo.Name, cfg.GitHubToken)
+		for _, user := range owners {
+			repositories, err := gitMetrics.FetchRepositoriesSimple(graphqlClient, user, token)
 			if err != nil {
-				log.Printf("could not fetch commits for repo %s: %v", repo.Name, err)
-				continue // Skip this repository and continue with the next one
+				http.Error(w, fmt.Sprintf("could not fetch repositories: %v", err), http.StatusInternalServerError)
+				return
 			}
 
-			err = gitMetrics.SaveCommitsToDB(commits)
+			for _, repo := range repositories {
+				start := time.Now()
+				releases, err := gitMetrics.FetchReleases(r.Context(), graphqlClient, user, repo.Name, token)
+				if err != nil {
+					telemetry.ObserveSync("releases", err, time.Since(start))
+					log.Printf("could not fetch releases for repo %s: %v", repo.Name, err)
+					continue // Skip this repository and continue with the next one
+				}
+
+				err = gitMetrics.SaveReleasesToDB(r.Context(), releases)
+				telemetry.ObserveSync("releases", err, time.Since(start))
+				if err != nil {
+					log.Printf("could not save releases for repo %s: %v", repo.Name, err)
+					continue
+				}
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Releases fetched and stored in MongoDB successfully.")
+	})
+
+	mux.HandleFunc("/deployments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			handlePushDeployments(w, r, gitMetrics)
+			return
+		}
+
+		owners, ok := syncOwners(w, r)
+		if !ok {
+			return
+		}
+		token := tenantFrom(r.Context()).GitHubToken
+
+		for _, user := range owners {
+			repositories, err := gitMetrics.FetchRepositoriesSimple(graphqlClient, user, token)
 			if err != nil {
-				log.Printf("could not save commits for repo %s: %v", repo.Name, err)
-				continue // Skip saving this repository's commits and continue with the next one
+				http.Error(w, fmt.Sprintf("could not fetch repositories: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			for _, repo := range repositories {
+				start := time.Now()
+				deployments, err := gitMetrics.FetchDeployments(graphqlClient, user, repo.Name, token)
+				if err != nil {
+					telemetry.ObserveSync("deployments", err, time.Since(start))
+					log.Printf("could not fetch deployments for repo %s: %v", repo.Name, err)
+					continue // Skip this repository and continue with the next one
+				}
+
+				err = gitMetrics.SaveDeploymentsToDB(r.Context(), deployments)
+				telemetry.ObserveSync("deployments", err, time.Since(start))
+				if err != nil {
+					log.Printf("could not save deployments for repo %s: %v", repo.Name, err)
+					continue
+				}
 			}
 		}
 
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Commits fetched and stored in MongoDB successfully.")
+		fmt.Fprintf(w, "Deployments fetched and stored in MongoDB successfully.")
 	})
 
+	registerAnalyticsRoutes(mux, graphqlClient, func(ctx context.Context) string { return tenantFrom(ctx).GitHubToken })
+	registerTeamRoutes(mux)
+	mux.Handle("/metrics", telemetry.Handler())
+	mux.Handle("/metrics/git", tenantExporter(exporterOptions(cfg)))
+
 	fmt.Println("Server is running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	log.Fatal(http.ListenAndServe(":8080", withTenant(store, telemetry.InstrumentHandler(mux))))
+}
+
+// databaseNames returns the database and collection names set by cfg.
+func databaseNames(cfg *config.Config) db.Names {
+	return db.Names{
+		Database: cfg.MongoDBDatabase,
+		Prefix:   cfg.MongoDBPrefix,
+		Collections: map[string]string{
+			db.CommitsCollection:     cfg.CommitsCollection,
+			db.ReleasesCollection:    cfg.ReleasesCollection,
+			db.DeploymentsCollection: cfg.DeploymentsCollection,
+			db.RollupsCollection:     cfg.RollupsCollection,
+			db.TeamsCollection:       cfg.TeamsCollection,
+			db.AnomaliesCollection:   cfg.AnomaliesCollection,
+			db.MigrationsCollection:  cfg.MigrationsCollection,
+		},
+	}
+}
+
+// reconnectOnURIChange reconnects to MongoDB when a reloaded configuration
+// changes its URI, e.g. after a password rotation.
+func reconnectOnURIChange(previous, next *config.Config) error {
+	if previous.MongoDBURI == next.MongoDBURI {
+		return nil
+	}
+	if err := ReconnectMongoDBFunc(next.MongoDBURI); err != nil {
+		return fmt.Errorf("could not reconnect to MongoDB: %w", err)
+	}
+	return nil
+}
+
+// handlePushDeployments records deployment events pushed by a CD system. The
+// body is a single deployment object or an array of them.
+func handlePushDeployments(w http.ResponseWriter, r *http.Request, gitMetrics gitmetrics.GitMetrics) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var deployments []gitmetrics.Deployment
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &deployments)
+	} else {
+		var deployment gitmetrics.Deployment
+		err = json.Unmarshal(body, &deployment)
+		deployments = append(deployments, deployment)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid deployment payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tenant := tenantFrom(r.Context())
+	for i := range deployments {
+		if err := gitmetrics.ValidateDeployment(&deployments[i]); err != nil {
+			http.Error(w, fmt.Sprintf("invalid deployment %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		// A deployment without an owner belongs to the tenant's only owner, or
+		// else to the only owner whose stored commits include its commit.
+		switch owner := deployments[i].Owner; {
+		case owner == "" && len(tenant.Owners) == 1:
+			deployments[i].Owner = tenant.Owners[0]
+		case owner == "":
+			owners, err := CommitOwnersFunc(r.Context(), deployments[i].RepoName, deployments[i].CommitID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("could not resolve owner of deployment %d: %v", i, err), http.StatusInternalServerError)
+				return
+			}
+			if len(owners) != 1 {
+				http.Error(w, fmt.Sprintf("invalid deployment %d: owner is required, %d stored copies of commit %s found", i, len(owners), deployments[i].CommitID), http.StatusBadRequest)
+				return
+			}
+			deployments[i].Owner = owners[0]
+		case owner != "" && !tenant.AllowsOwner(owner):
+			http.Error(w, fmt.Sprintf("tenant %q may not record deployments of %s", tenant.Name, owner), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := gitMetrics.SaveDeploymentsToDB(r.Context(), deployments); err != nil {
+		http.Error(w, fmt.Sprintf("could not save deployments: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, deployments)
 }
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,18 +18,21 @@ import (
 
 func TestStartServer(t *testing.T) {
 	// real LoadConfig and InitializeMongoDB for this test
-	LoadConfigFunc = config.LoadConfig
+	store, err := config.NewStore(config.LoadConfig)
+	if !assert.NoError(t, err) {
+		return
+	}
 	InitializeMongoDBFunc = db.InitializeMongoDB
 
 	// Create a real instance of GitMetrics
-	gitMetrics := &gitmetrics.GitMetricsImpl{}
+	gitMetrics := &gitmetrics.GitMetricsImpl{Config: store}
 
 	// Create a new ServeMux for testing
 	mux := http.NewServeMux()
 
 	// Start the server in a goroutine
 	go func() {
-		StartServer(mux, gitMetrics)
+		StartServer(mux, gitMetrics, store)
 	}()
 
 	// Allow some time for the server to start
@@ -51,5 +57,176 @@ func TestStartServer(t *testing.T) {
 	// Read and check the response body
 	body, err := io.ReadAll(resp.Body)
 	assert.NoError(t, err)
-	assert.Equal(t, "Commits fetched and stored in MongoDB successfully.", string(body))
+	assert.Regexp(t, `^Commits fetched and stored in MongoDB successfully\. Inserted \d+, repaired \d+, unchanged \d+\.$`, string(body))
+}
+
+// stubGitMetrics records what the handlers save instead of writing to MongoDB.
+type stubGitMetrics struct {
+	gitmetrics.GitMetricsImpl
+	savedDeployments []gitmetrics.Deployment
+	saveErr          error
+}
+
+func (s *stubGitMetrics) SaveDeploymentsToDB(ctx context.Context, deployments []gitmetrics.Deployment) error {
+	s.savedDeployments = append(s.savedDeployments, deployments...)
+	return s.saveErr
+}
+
+// stubCommitOwners makes CommitOwnersFunc report owners for every commit.
+func stubCommitOwners(t *testing.T, owners ...string) {
+	original := CommitOwnersFunc
+	t.Cleanup(func() { CommitOwnersFunc = original })
+	CommitOwnersFunc = func(ctx context.Context, repo, commitID string) ([]string, error) {
+		return owners, nil
+	}
+}
+
+func TestHandlePushDeployments_Single(t *testing.T) {
+	stubCommitOwners(t, "acme")
+	stub := &stubGitMetrics{}
+	body := `{"repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"}`
+
+	rec := httptest.NewRecorder()
+	handlePushDeployments(rec, httptest.NewRequest("POST", "/deployments", strings.NewReader(body)), stub)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, stub.savedDeployments, 1)
+	saved := stub.savedDeployments[0]
+	assert.Equal(t, "acme", saved.Owner)
+	assert.Equal(t, "repo1", saved.RepoName)
+	assert.Equal(t, "production", saved.Environment)
+	assert.Equal(t, gitmetrics.DeploymentSourceAPI, saved.Source)
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), saved.FinishedAt)
+}
+
+func TestHandlePushDeployments_Array(t *testing.T) {
+	stubCommitOwners(t, "acme")
+	stub := &stubGitMetrics{}
+	body := ` [{"repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"},
+		{"repo":"repo1","commit_id":"def","status":"failure","environment":"staging","finished_at":"2024-01-02T12:00:00Z"}]`
+
+	rec := httptest.NewRecorder()
+	handlePushDeployments(rec, httptest.NewRequest("POST", "/deployments", strings.NewReader(body)), stub)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, stub.savedDeployments, 2)
+	assert.Equal(t, "staging", stub.savedDeployments[1].Environment)
+}
+
+func TestHandlePushDeployments_Invalid(t *testing.T) {
+	for body, message := range map[string]string{
+		`{`:                           "invalid deployment payload",
+		`{"repo":"repo1"}`:            "commit_id is required",
+		`[{"repo":"r","status":"x"}]`: "invalid deployment 0",
+	} {
+		stub := &stubGitMetrics{}
+		rec := httptest.NewRecorder()
+		handlePushDeployments(rec, httptest.NewRequest("POST", "/deployments", strings.NewReader(body)), stub)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), message, body)
+		assert.Empty(t, stub.savedDeployments)
+	}
+}
+
+func TestHandlePushDeployments_Owner(t *testing.T) {
+	tenant := config.Tenant{Name: "retail", Owners: []string{"acme"}}
+	push := func(body string) (*httptest.ResponseRecorder, *stubGitMetrics) {
+		stub := &stubGitMetrics{}
+		req := httptest.NewRequest("POST", "/deployments", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant))
+		rec := httptest.NewRecorder()
+		handlePushDeployments(rec, req, stub)
+		return rec, stub
+	}
+
+	// Without an owner the deployment belongs to the tenant's only owner.
+	rec, stub := push(`{"repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "acme", stub.savedDeployments[0].Owner)
+
+	rec, stub = push(`{"owner":"other","repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, stub.savedDeployments)
+}
+
+func TestHandlePushDeployments_OwnerFromCommit(t *testing.T) {
+	tenant := config.Tenant{Name: "retail", Owners: []string{"acme", "fork"}}
+	push := func(body string) (*httptest.ResponseRecorder, *stubGitMetrics) {
+		stub := &stubGitMetrics{}
+		req := httptest.NewRequest("POST", "/deployments", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant))
+		rec := httptest.NewRecorder()
+		handlePushDeployments(rec, req, stub)
+		return rec, stub
+	}
+	body := `{"repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"}`
+
+	// With several owners, the owner is the one whose commits include it.
+	stubCommitOwners(t, "fork")
+	rec, stub := push(body)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "fork", stub.savedDeployments[0].Owner)
+
+	for _, owners := range [][]string{nil, {"acme", "fork"}} {
+		stubCommitOwners(t, owners...)
+		rec, stub = push(body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "owner is required")
+		assert.Empty(t, stub.savedDeployments)
+	}
+
+	CommitOwnersFunc = func(ctx context.Context, repo, commitID string) ([]string, error) {
+		return nil, errors.New("database unavailable")
+	}
+	rec, _ = push(body)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandlePushDeployments_SaveError(t *testing.T) {
+	stubCommitOwners(t, "acme")
+	stub := &stubGitMetrics{saveErr: errors.New("write failed")}
+	body := `{"repo":"repo1","commit_id":"abc","status":"success","finished_at":"2024-01-01T12:00:00Z"}`
+
+	rec := httptest.NewRecorder()
+	handlePushDeployments(rec, httptest.NewRequest("POST", "/deployments", strings.NewReader(body)), stub)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "write failed")
+}
+
+func TestReconnectOnURIChange(t *testing.T) {
+	original := ReconnectMongoDBFunc
+	defer func() { ReconnectMongoDBFunc = original }()
+
+	var reconnected []string
+	var reconnectErr error
+	ReconnectMongoDBFunc = func(uri string) error {
+		reconnected = append(reconnected, uri)
+		return reconnectErr
+	}
+
+	previous := &config.Config{MongoDBURI: "mongodb://app:old@db", GitHubToken: "old"}
+	assert.NoError(t, reconnectOnURIChange(previous, &config.Config{MongoDBURI: "mongodb://app:old@db", GitHubToken: "new"}))
+	assert.Empty(t, reconnected)
+
+	assert.NoError(t, reconnectOnURIChange(previous, &config.Config{MongoDBURI: "mongodb://app:new@db"}))
+	assert.Equal(t, []string{"mongodb://app:new@db"}, reconnected)
+
+	reconnectErr = errors.New("authentication failed")
+	err := reconnectOnURIChange(previous, &config.Config{MongoDBURI: "mongodb://app:typo@db"})
+	assert.ErrorContains(t, err, "could not reconnect to MongoDB: authentication failed")
+}
+
+func TestDatabaseNames(t *testing.T) {
+	defer db.SetNames(db.Names{})
+	cfg := config.Defaults()
+	cfg.MongoDBPrefix = "staging_"
+	cfg.CommitsCollection = "commits"
+
+	db.SetNames(databaseNames(&cfg))
+
+	assert.Equal(t, "staging_dashboard", db.DatabaseName(context.Background()))
+	assert.Equal(t, "commits", db.CollectionName(db.CommitsCollection))
+	assert.Equal(t, "daily_rollups", db.CollectionName(db.RollupsCollection))
 }
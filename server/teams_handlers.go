@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lep13/git_metrics/internal/teams"
+)
+
+// Function variables to allow swapping with mocks in tests
+var SaveTeamFunc = teams.SaveTeam
+var DeleteTeamFunc = teams.DeleteTeam
+var ImportTeamsFunc = teams.ImportTeams
+var ImportTeamsFileFunc = teams.ImportTeamsFile
+
+func registerTeamRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/teams", handleTeams)
+	mux.HandleFunc("/teams/import", handleImportTeams)
+	mux.HandleFunc("/teams/", handleTeam)
+}
+
+// handleTeams lists the stored teams or creates one.
+func handleTeams(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stored, err := LoadTeamsFunc(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not load teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, stored)
+	case http.MethodPost:
+		team, ok := decodeTeam(w, r)
+		if !ok {
+			return
+		}
+		if err := SaveTeamFunc(r.Context(), team); err != nil {
+			http.Error(w, fmt.Sprintf("could not save team: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, team)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTeam reads, replaces or deletes the team named in the path.
+func handleTeam(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/teams/")
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		team, err := GetTeamFunc(r.Context(), name)
+		if err != nil {
+			writeTeamError(w, "could not load team", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, team)
+	case http.MethodPut:
+		team, ok := decodeTeam(w, r)
+		if !ok {
+			return
+		}
+		if team.Name != name {
+			http.Error(w, fmt.Sprintf("team name %q does not match path %q", team.Name, name), http.StatusBadRequest)
+			return
+		}
+		if err := SaveTeamFunc(r.Context(), team); err != nil {
+			http.Error(w, fmt.Sprintf("could not save team: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, team)
+	case http.MethodDelete:
+		if err := DeleteTeamFunc(r.Context(), name); err != nil {
+			writeTeamError(w, "could not delete team", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleImportTeams stores the teams of a YAML definitions file posted as
+// the request body.
+func handleImportTeams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	count, err := ImportTeamsFunc(r.Context(), body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not import teams: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"teams": count})
+}
+
+func decodeTeam(w http.ResponseWriter, r *http.Request) (teams.Team, bool) {
+	var team teams.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		http.Error(w, fmt.Sprintf("invalid team payload: %v", err), http.StatusBadRequest)
+		return team, false
+	}
+	if err := teams.Validate(&team); err != nil {
+		http.Error(w, fmt.Sprintf("invalid team: %v", err), http.StatusBadRequest)
+		return team, false
+	}
+	return team, true
+}
+
+func writeTeamError(w http.ResponseWriter, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, teams.ErrTeamNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", message, err), status)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lep13/git_metrics/internal/teams"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTeamsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	registerTeamRoutes(mux)
+	return mux
+}
+
+func TestHandleTeams_List(t *testing.T) {
+	originalLoadTeamsFunc := LoadTeamsFunc
+	defer func() { LoadTeamsFunc = originalLoadTeamsFunc }()
+	LoadTeamsFunc = func(ctx context.Context) ([]teams.Team, error) {
+		return []teams.Team{{Name: "platform", Members: []string{"@alice"}}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/teams", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var listed []teams.Team
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Equal(t, "platform", listed[0].Name)
+}
+
+func TestHandleTeams_Create(t *testing.T) {
+	originalSaveTeamFunc := SaveTeamFunc
+	defer func() { SaveTeamFunc = originalSaveTeamFunc }()
+
+	var saved teams.Team
+	SaveTeamFunc = func(ctx context.Context, team teams.Team) error {
+		saved = team
+		return nil
+	}
+
+	body := `{"name":" platform ","members":["@alice","@alice"],"repos":["git_metrics"]}`
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/teams", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, teams.Team{Name: "platform", Members: []string{"@alice"}, Repos: []string{"git_metrics"}}, saved)
+}
+
+func TestHandleTeams_CreateInvalid(t *testing.T) {
+	for _, body := range []string{`{"name":`, `{"members":["@alice"]}`} {
+		rec := httptest.NewRecorder()
+		newTeamsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/teams", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestHandleTeam_Get(t *testing.T) {
+	originalGetTeamFunc := GetTeamFunc
+	defer func() { GetTeamFunc = originalGetTeamFunc }()
+	GetTeamFunc = func(ctx context.Context, name string) (*teams.Team, error) {
+		if name == "platform" {
+			return &teams.Team{Name: name}, nil
+		}
+		return nil, fmt.Errorf("%w: %s", teams.ErrTeamNotFound, name)
+	}
+
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/teams/platform", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("GET", "/teams/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleTeam_Put(t *testing.T) {
+	originalSaveTeamFunc := SaveTeamFunc
+	defer func() { SaveTeamFunc = originalSaveTeamFunc }()
+	SaveTeamFunc = func(ctx context.Context, team teams.Team) error { return nil }
+
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("PUT", "/teams/platform", strings.NewReader(`{"name":"platform"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("PUT", "/teams/platform", strings.NewReader(`{"name":"web"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleTeam_Delete(t *testing.T) {
+	originalDeleteTeamFunc := DeleteTeamFunc
+	defer func() { DeleteTeamFunc = originalDeleteTeamFunc }()
+	DeleteTeamFunc = func(ctx context.Context, name string) error {
+		if name == "platform" {
+			return nil
+		}
+		return errors.New("database unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("DELETE", "/teams/platform", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("DELETE", "/teams/web", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	rec = httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("PATCH", "/teams/platform", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandleImportTeams(t *testing.T) {
+	originalImportTeamsFunc := ImportTeamsFunc
+	defer func() { ImportTeamsFunc = originalImportTeamsFunc }()
+	ImportTeamsFunc = func(ctx context.Context, data []byte) (int, error) {
+		if strings.Contains(string(data), "teams:") {
+			return 2, nil
+		}
+		return 0, errors.New("failed to parse teams")
+	}
+
+	rec := httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/teams/import", strings.NewReader("teams: []")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"teams":2}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	newTeamsMux().ServeHTTP(rec, httptest.NewRequest("POST", "/teams/import", strings.NewReader("nope")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lep13/git_metrics/config"
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/exporter"
+)
+
+// TenantHeader names the tenant of a request that doesn't use the
+// /tenants/{name}/ path prefix.
+const TenantHeader = "X-Tenant"
+
+const tenantPathPrefix = "/tenants/"
+
+type tenantKey struct{}
+
+// tenantFrom returns the tenant withTenant resolved for a request.
+func tenantFrom(ctx context.Context) config.Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(config.Tenant)
+	return tenant
+}
+
+// withTenant resolves the tenant of every request, from a /tenants/{name}/
+// path prefix or the X-Tenant header, and serves it with the tenant in its
+// context and the tenant's database selected. The prefix is removed before
+// routing. Without either, the only tenant is used; when several tenants
+// are configured such requests are rejected, except for the service metrics
+// at /metrics.
+func withTenant(store *config.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := store.Get()
+
+		name := r.Header.Get(TenantHeader)
+		path := r.URL.Path
+		if rest, ok := strings.CutPrefix(path, tenantPathPrefix); ok {
+			prefixed, route, _ := strings.Cut(rest, "/")
+			if name != "" && name != prefixed {
+				http.Error(w, fmt.Sprintf("tenant %q in the path doesn't match the %s header %q", prefixed, TenantHeader, name), http.StatusBadRequest)
+				return
+			}
+			name, path = prefixed, "/"+route
+		}
+
+		var tenant config.Tenant
+		switch tenants := cfg.TenantList(); {
+		case name != "":
+			var ok bool
+			if tenant, ok = cfg.Tenant(name); !ok {
+				http.Error(w, fmt.Sprintf("unknown tenant %q", name), http.StatusNotFound)
+				return
+			}
+		case len(tenants) == 1:
+			tenant = tenants[0]
+		case path != "/metrics":
+			http.Error(w, fmt.Sprintf("tenant required: prefix the path with %s{name}/ or set the %s header", tenantPathPrefix, TenantHeader), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantKey{}, tenant)
+		ctx = db.WithDatabase(ctx, tenant.Database)
+		r = r.Clone(ctx)
+		r.URL.Path, r.URL.RawPath = path, ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// syncOwners returns the owners a sync request covers: the user parameter,
+// which the tenant must allow, or else all of the tenant's owners. It writes
+// an error and returns false when there are none or the user isn't allowed.
+func syncOwners(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	tenant := tenantFrom(r.Context())
+	user := r.URL.Query().Get("user")
+	switch {
+	case user != "" && !tenant.AllowsOwner(user):
+		http.Error(w, fmt.Sprintf("tenant %q may not sync %s", tenant.Name, user), http.StatusForbidden)
+		return nil, false
+	case user != "":
+		return []string{user}, true
+	case len(tenant.Owners) > 0:
+		return tenant.Owners, true
+	}
+	http.Error(w, "Missing user parameter", http.StatusBadRequest)
+	return nil, false
+}
+
+// tenantExporter serves the git metrics exporter of the request's tenant,
+// creating each tenant's collector on first use so their caches and data
+// stay apart.
+func tenantExporter(opts exporter.Options) http.Handler {
+	var mu sync.Mutex
+	handlers := make(map[string]http.Handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := tenantFrom(r.Context())
+		mu.Lock()
+		handler, ok := handlers[tenant.Name]
+		if !ok {
+			tenantOpts := opts
+			tenantOpts.Database = tenant.Database
+			handler = exporter.Handler(exporter.NewCollector(tenantOpts))
+			handlers[tenant.Name] = handler
+		}
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// exporterOptions returns the exporter settings of the configuration.
+func exporterOptions(cfg *config.Config) exporter.Options {
+	return exporter.Options{
+		MaxLabels: cfg.ExporterMaxLabels,
+		CacheTTL:  time.Duration(cfg.ExporterCacheSeconds) * time.Second,
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lep13/git_metrics/config"
+	"github.com/lep13/git_metrics/internal/analytics"
+	"github.com/lep13/git_metrics/internal/db"
+	"github.com/lep13/git_metrics/internal/exporter"
+	"github.com/lep13/git_metrics/internal/gitmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func tenantStore() *config.Store {
+	return config.NewStaticStore(&config.Config{Tenants: []config.Tenant{
+		{Name: "payments", GitHubToken: "ghp_payments", Owners: []string{"payments-org"}},
+		{Name: "retail", GitHubToken: "ghp_retail", Database: "retail_metrics"},
+	}})
+}
+
+// tenantEcho records the tenant, database and path a request is served with.
+type tenantEcho struct {
+	tenant   config.Tenant
+	database string
+	path     string
+}
+
+func (e *tenantEcho) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.tenant = tenantFrom(r.Context())
+	e.database = db.DatabaseFrom(r.Context())
+	e.path = r.URL.Path
+}
+
+func TestWithTenant_PathPrefixAndHeader(t *testing.T) {
+	echo := &tenantEcho{}
+	handler := withTenant(tenantStore(), echo)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/tenants/retail/metrics/churn?repo=shop", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "retail", echo.tenant.Name)
+	assert.Equal(t, "ghp_retail", echo.tenant.GitHubToken)
+	assert.Equal(t, "retail_metrics", echo.database)
+	assert.Equal(t, "/metrics/churn", echo.path)
+
+	req := httptest.NewRequest("GET", "/commits?user=payments-org", nil)
+	req.Header.Set(TenantHeader, "payments")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "payments", echo.tenant.Name)
+	assert.Equal(t, "payments", echo.database)
+	assert.Equal(t, "/commits", echo.path)
+}
+
+func TestWithTenant_Errors(t *testing.T) {
+	handler := withTenant(tenantStore(), &tenantEcho{})
+
+	tests := []struct {
+		path, header string
+		status       int
+		message      string
+	}{
+		{"/tenants/wholesale/commits", "", http.StatusNotFound, `unknown tenant "wholesale"`},
+		{"/tenants/retail/commits", "payments", http.StatusBadRequest, "doesn't match"},
+		{"/metrics/churn", "", http.StatusBadRequest, "tenant required"},
+		{"/metrics", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(TenantHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.path)
+		assert.Contains(t, rec.Body.String(), tt.message, tt.path)
+	}
+}
+
+func TestWithTenant_SingleTenant(t *testing.T) {
+	echo := &tenantEcho{}
+	store := config.NewStaticStore(&config.Config{GitHubToken: "ghp_single"})
+
+	withTenant(store, echo).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics/churn", nil))
+
+	assert.Equal(t, config.DefaultTenant, echo.tenant.Name)
+	assert.Equal(t, "ghp_single", echo.tenant.GitHubToken)
+	assert.Equal(t, db.DefaultDatabase, echo.database)
+}
+
+func TestSyncOwners(t *testing.T) {
+	serve := func(target string, tenant config.Tenant) ([]string, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant))
+		rec := httptest.NewRecorder()
+		owners, _ := syncOwners(rec, req)
+		return owners, rec
+	}
+	payments := config.Tenant{Name: "payments", Owners: []string{"payments-org", "payments-labs"}}
+
+	owners, _ := serve("/commits", payments)
+	assert.Equal(t, []string{"payments-org", "payments-labs"}, owners)
+
+	owners, _ = serve("/commits?user=Payments-Org", payments)
+	assert.Equal(t, []string{"Payments-Org"}, owners)
+
+	_, rec := serve("/commits?user=retail-org", payments)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	_, rec = serve("/commits", config.Tenant{Name: config.DefaultTenant})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Missing user parameter")
+}
+
+func TestTenantExporter_ReadsTenantDatabase(t *testing.T) {
+	original := exporter.LoadRollupsFunc
+	defer func() { exporter.LoadRollupsFunc = original }()
+	var databases []string
+	exporter.LoadRollupsFunc = func(ctx context.Context, q analytics.Query) ([]gitmetrics.DailyRollup, error) {
+		databases = append(databases, db.DatabaseFrom(ctx))
+		return nil, nil
+	}
+
+	handler := withTenant(tenantStore(), tenantExporter(exporter.Options{}))
+	for _, path := range []string{"/tenants/retail/metrics/git", "/tenants/payments/metrics/git", "/tenants/retail/metrics/git"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Each tenant has its own cache, so retail's second scrape is cached.
+	assert.Equal(t, []string{"retail_metrics", "payments"}, databases)
+}